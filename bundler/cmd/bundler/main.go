@@ -16,6 +16,11 @@
 //   --output  path to write HTML file (default: bundle.html)
 //   --title   document title (default: "Published")
 //   --cache   path to cache.db (default: ~/.media-server-conf/cache.db)
+//   --server  media-server URL for live tag editing
+//   --token   media-server API token embedded for --server calls; use a
+//             tags-scoped, expiring one (media-server users token NAME
+//             --scope tags --expires 168h) and start the server with
+//             --cors-origin null so file:// artifacts may call it
 //
 // Compression:
 //   text/* file contents are gzip-compressed before base64 encoding.
@@ -69,6 +74,7 @@ type PublishManifest struct {
 	Title       string        `json:"title"`
 	PublishedAt int64         `json:"published_at"`
 	ServerURL   string        `json:"server_url,omitempty"`
+	ServerToken string        `json:"server_token,omitempty"` // Bearer token for ServerURL
 	Paths       []string      `json:"paths,omitempty"`
 	Files       []PublishFile `json:"files"`
 }
@@ -78,6 +84,7 @@ func main() {
 	title      := flag.String("title", "Published", "magazine title")
 	cachePath  := flag.String("cache", "", "path to cache.db (default: ~/.media-server-conf/cache.db)")
 	serverURL  := flag.String("server", "", "media-server base URL for live tag editing (e.g. http://localhost:9192)")
+	serverToken := flag.String("token", "", "media-server API token embedded for --server calls (prefer a tags-scoped, expiring one)")
 	passphrase := flag.String("passphrase", "", "encrypt document with this passphrase (AES-256-GCM + PBKDF2)")
 	mode       := flag.String("mode", "magazine", "output mode: magazine | wordcloud")
 	indexPath  := flag.String("index", "", "path to index.json (required for --mode wordcloud)")
@@ -86,7 +93,7 @@ func main() {
 	flag.Parse()
 
 	if *mode == "wordcloud" {
-		if err := wordcloudMode(*indexPath, *outputPath, *title, *serverURL); err != nil {
+		if err := wordcloudMode(*indexPath, *outputPath, *title, *serverURL, *serverToken); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
@@ -117,9 +124,19 @@ func main() {
 		db, err := sql.Open("sqlite3", resolvedCache+"?mode=ro&_foreign_keys=on")
 		if err == nil {
 			if pingErr := db.Ping(); pingErr == nil {
-				cacheDB = db
-				defer cacheDB.Close()
-				fmt.Fprintf(os.Stderr, "cache: using %s\n", resolvedCache)
+				version, verErr := cacheSchemaVersion(db)
+				switch {
+				case verErr != nil:
+					fmt.Fprintf(os.Stderr, "cache: failed to read schema version of %s: %v\n", resolvedCache, verErr)
+					db.Close()
+				case version > supportedCacheSchema:
+					fmt.Fprintf(os.Stderr, "cache: schema v%d is newer than this build understands (v%d)\n", version, supportedCacheSchema)
+					db.Close()
+				default:
+					cacheDB = db
+					defer cacheDB.Close()
+					fmt.Fprintf(os.Stderr, "cache: using %s (schema v%d)\n", resolvedCache, version)
+				}
 			}
 		}
 		if cacheDB == nil {
@@ -202,6 +219,7 @@ func main() {
 		Title:       *title,
 		PublishedAt: time.Now().Unix(),
 		ServerURL:   *serverURL,
+		ServerToken: *serverToken,
 		Paths:       paths,
 		Files:       files,
 	}
@@ -264,6 +282,26 @@ func gzipCompress(data []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// supportedCacheSchema is the newest media-server cache schema this tool reads.
+// enrichFromCache only uses files.id/abs_path/comment/os_birth_time and tags,
+// unchanged since v1; bump this after checking each new media-server migration.
+const supportedCacheSchema = 10
+
+// cacheSchemaVersion returns the schema version media-server recorded in cache.db
+// (0 for caches written before schema versioning).
+func cacheSchemaVersion(db *sql.DB) (int, error) {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&n); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
 // enrichFromCache pulls tags, comment, and birth time from cache.db.
 func enrichFromCache(db *sql.DB, absPath string, pf *PublishFile) {
 	var fileID int64
@@ -561,7 +599,7 @@ func readWordcloud2JS() string {
 }
 
 // wordcloudMode builds a self-contained wordcloud HTML artifact from index.json.
-func wordcloudMode(indexPath, outputPath, title, serverURL string) error {
+func wordcloudMode(indexPath, outputPath, title, serverURL, serverToken string) error {
 	if indexPath == "" {
 		return fmt.Errorf("--index is required for --mode wordcloud")
 	}
@@ -614,6 +652,7 @@ func wordcloudMode(indexPath, outputPath, title, serverURL string) error {
 	html = strings.Replace(html, "{{UNTAGGED_COUNT}}", fmt.Sprintf("%d", untaggedCount), 1)
 	html = strings.Replace(html, "{{INDEX_B64}}", indexB64, 1)
 	html = strings.Replace(html, "{{SERVER_URL}}", serverURL, 1)
+	html = strings.Replace(html, "{{SERVER_TOKEN}}", serverToken, 1)
 	html = strings.Replace(html, "{{WORDCLOUD2_JS}}", wc2js, 1)
 	fmt.Fprint(w, html)
 	if err := w.Flush(); err != nil {
@@ -627,7 +666,7 @@ func wordcloudMode(indexPath, outputPath, title, serverURL string) error {
 
 // wordcloudTemplate — self-contained offline wordcloud artifact.
 // Placeholders: {{TITLE}} (×2), {{FILE_COUNT}}, {{UNTAGGED_COUNT}},
-//               {{INDEX_B64}}, {{SERVER_URL}}, {{WORDCLOUD2_JS}}
+//               {{INDEX_B64}}, {{SERVER_URL}}, {{SERVER_TOKEN}}, {{WORDCLOUD2_JS}}
 const wordcloudTemplate = `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -740,6 +779,7 @@ body { background: #111; color: #ddd; font-family: Helvetica, Arial, sans-serif;
 <script>
 const INDEX_B64  = "{{INDEX_B64}}";
 const SERVER_URL = "{{SERVER_URL}}";
+const SERVER_TOKEN = "{{SERVER_TOKEN}}";
 
 var ALL_WORDS   = [];
 var taggedWords = new Set();
@@ -750,6 +790,13 @@ var GALLERY_LIMIT = 1500;
 var PORT     = SERVER_URL ? SERVER_URL.replace(/\/$/, '') : null;
 var TAG_PORT = PORT;
 
+// Headers for server calls, with the embedded API token when there is one
+function serverHeaders(extra) {
+  var h = Object.assign({}, extra || {});
+  if (SERVER_TOKEN) h['Authorization'] = 'Bearer ' + SERVER_TOKEN;
+  return h;
+}
+
 // ── Decompression (same as publisher magazine viewer) ─────────────────────────
 async function gzipDecompress(b64) {
   const compressed = Uint8Array.from(atob(b64), c => c.charCodeAt(0));
@@ -892,7 +939,7 @@ function showGallery(word, paths) {
         '<img src="' + imgUrl + '" loading="lazy" title="' + p.split('/').pop() + '">' +
         '</a>';
       if (groupTag && TAG_PORT) {
-        fetch(TAG_PORT + '/api/filetags?path=' + encodeURIComponent(p))
+        fetch(TAG_PORT + '/api/filetags?path=' + encodeURIComponent(p), { headers: serverHeaders() })
           .then(function(r) { return r.json(); })
           .then(function(data) {
             if ((data.tags || []).indexOf(groupTag) === -1) {
@@ -953,10 +1000,13 @@ function tagThisGroup(word, paths) {
 
   fetch(PORT + '/api/batchaddtag', {
     method:  'POST',
-    headers: {'Content-Type': 'application/json'},
+    headers: serverHeaders({'Content-Type': 'application/json'}),
     body:    JSON.stringify({ tag: word, filePaths: paths })
   })
-  .then(function(r) { return r.json(); })
+  .then(function(r) {
+    if (!r.ok) throw new Error('HTTP ' + r.status);
+    return r.json();
+  })
   .then(function(data) {
     var n = data.count || paths.length;
     btn.textContent       = '\u2713 tagged ' + n.toLocaleString() + ' files';
@@ -1063,7 +1113,7 @@ async function boot() {
     // Server status badge
     var badge = document.getElementById('server-badge');
     if (PORT) {
-      fetch(PORT + '/api/alltags', { signal: AbortSignal.timeout(3000) })
+      fetch(PORT + '/api/alltags', { signal: AbortSignal.timeout(3000), headers: serverHeaders() })
         .then(function() {
           badge.textContent = 'server live';
           badge.className   = '';
@@ -1480,6 +1530,13 @@ function esc(s) {
 
 // --- Tag editing (requires DATA.server_url) ---
 
+// Headers for tag writes, with the embedded API token when there is one
+function serverHeaders() {
+  const h = {'Content-Type': 'application/json'};
+  if (DATA.server_token) h['Authorization'] = 'Bearer ' + DATA.server_token;
+  return h;
+}
+
 async function addTag(fileId, tag) {
   tag = tag.trim();
   if (!tag) return;
@@ -1489,11 +1546,12 @@ async function addTag(fileId, tag) {
   if (activeID === fileId) openFile(fileId);
   renderSidebar();
   try {
-    await fetch(DATA.server_url + '/api/addtag', {
+    const r = await fetch(DATA.server_url + '/api/addtag', {
       method: 'POST',
-      headers: {'Content-Type': 'application/json'},
+      headers: serverHeaders(),
       body: JSON.stringify({filePath: f.path, tag})
     });
+    if (!r.ok) throw new Error('HTTP ' + r.status);
   } catch(e) {
     f.tags = f.tags.filter(t => t !== tag);
     if (activeID === fileId) openFile(fileId);
@@ -1509,11 +1567,12 @@ async function removeTag(fileId, tag) {
   if (activeID === fileId) openFile(fileId);
   renderSidebar();
   try {
-    await fetch(DATA.server_url + '/api/removetag', {
+    const r = await fetch(DATA.server_url + '/api/removetag', {
       method: 'POST',
-      headers: {'Content-Type': 'application/json'},
+      headers: serverHeaders(),
       body: JSON.stringify({filePath: f.path, tag})
     });
+    if (!r.ok) throw new Error('HTTP ' + r.status);
   } catch(e) {
     f.tags = prev;
     if (activeID === fileId) openFile(fileId);
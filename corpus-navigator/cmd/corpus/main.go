@@ -15,6 +15,12 @@
 // Usage:
 //   corpus --server http://localhost:8898 --output corpus.html
 //   corpus --server http://localhost:8898 --output corpus.html --title "VFP Corpus"
+//   corpus --server http://localhost:8898 --token mst_... --output corpus.html
+//
+// When the server has user accounts, --token authenticates the API reads and
+// is embedded for tag writes: use a tags-scoped, expiring token (media-server
+// users token NAME --scope tags --expires 168h), and start the server with
+// --cors-origin null so the file:// artifact may call it.
 //
 // Data embedded:
 //   { "paths": [...], "tags": { "tagname": [idx,...] }, "freqs": [[tag,count],...] }
@@ -49,6 +55,7 @@ func main() {
 	outputPath := flag.String("output", "corpus.html", "output HTML file")
 	title      := flag.String("title", "Corpus Navigator", "page title")
 	serverURL  := flag.String("server", "", "media-server base URL (required, e.g. http://localhost:8898)")
+	token      := flag.String("token", "", "media-server API token for reads and embedded tag writes")
 	flag.Parse()
 
 	if *serverURL == "" {
@@ -60,7 +67,7 @@ func main() {
 	fmt.Fprintf(os.Stderr, "server: %s\n", base)
 
 	// Build path list and tag index from live server API
-	manifest, err := buildManifestFromAPI(base)
+	manifest, err := buildManifestFromAPI(base, *token)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error building manifest: %v\n", err)
 		os.Exit(1)
@@ -106,6 +113,7 @@ func main() {
 	html = strings.Replace(html, "{{PATH_COUNT}}", fmt.Sprintf("%d", len(manifest.Paths)), 1)
 	html = strings.Replace(html, "{{DATA_B64}}", dataB64, 1)
 	html = strings.Replace(html, "{{SERVER_URL}}", *serverURL, 1)
+	html = strings.Replace(html, "{{SERVER_TOKEN}}", *token, 1)
 	html = strings.Replace(html, "{{WORDCLOUD2_JS}}", wc2js, 1)
 	fmt.Fprint(w, html)
 	if err := w.Flush(); err != nil {
@@ -121,9 +129,9 @@ func main() {
 // buildManifestFromAPI fetches tag→paths from a live media-server using its API.
 // Uses /api/alltags to get tag list, then /api/filelist?category=<tag> for each tag.
 // Concurrent fetches (up to 20 at a time) to keep total time under a few seconds.
-func buildManifestFromAPI(base string) (*CorpusManifest, error) {
+func buildManifestFromAPI(base, token string) (*CorpusManifest, error) {
 	// 1. Fetch tag list
-	resp, err := http.Get(base + "/api/alltags")
+	resp, err := apiGet(base+"/api/alltags", token)
 	if err != nil {
 		return nil, fmt.Errorf("GET /api/alltags: %w", err)
 	}
@@ -156,7 +164,7 @@ func buildManifestFromAPI(base string) (*CorpusManifest, error) {
 			defer func() { <-sem }()
 
 			u := base + "/api/filelist?category=" + url.QueryEscape(tag)
-			r, err := http.Get(u)
+			r, err := apiGet(u, token)
 			if err != nil {
 				results[i] = tagResult{tag: tag, err: err}
 				return
@@ -226,6 +234,27 @@ func buildManifestFromAPI(base string) (*CorpusManifest, error) {
 	}, nil
 }
 
+// apiGet fetches a media-server API URL, with the bearer token when set.
+// Refused requests are errors, so a missing token is reported clearly.
+func apiGet(u, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s (pass --token)", resp.Status)
+	}
+	return resp, nil
+}
+
 func gzipCompress(data []byte) ([]byte, error) {
 	var buf bytes.Buffer
 	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
@@ -281,7 +310,7 @@ func formatSize(n int64) string {
 
 // corpusTemplate — self-contained corpus navigator artifact.
 // Placeholders: {{TITLE}} (×2), {{TAG_COUNT}}, {{PATH_COUNT}},
-//               {{DATA_B64}}, {{SERVER_URL}}, {{WORDCLOUD2_JS}}
+//               {{DATA_B64}}, {{SERVER_URL}}, {{SERVER_TOKEN}}, {{WORDCLOUD2_JS}}
 const corpusTemplate = `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -388,8 +417,16 @@ body { background: #111; color: #ddd; font-family: Helvetica, Arial, sans-serif;
 <script>
 const DATA_B64   = "{{DATA_B64}}";
 const SERVER_URL = "{{SERVER_URL}}";
+const SERVER_TOKEN = "{{SERVER_TOKEN}}";
 var PORT = SERVER_URL ? SERVER_URL.replace(/\/$/, '') : null;
 
+// Headers for tag writes, with the embedded API token when there is one
+function serverHeaders() {
+  var h = {'Content-Type': 'application/json'};
+  if (SERVER_TOKEN) h['Authorization'] = 'Bearer ' + SERVER_TOKEN;
+  return h;
+}
+
 var INDEX          = null;
 var PATH_INDEX     = {};   // path → array index (built at boot)
 var PATH_TAGS      = {};   // array index → [tag, ...] (built at boot)
@@ -539,8 +576,10 @@ function addTagToFile() {
   document.getElementById('add-tag-input').value = '';
   if (PORT) {
     fetch(PORT + '/api/addtag', {
-      method: 'POST', headers: {'Content-Type': 'application/json'},
+      method: 'POST', headers: serverHeaders(),
       body: JSON.stringify({ filePath: path, tag: tag })
+    }).then(function(r) {
+      if (!r.ok) alert('tag write refused (' + r.status + ') — token missing or expired?');
     }).catch(function() { alert('tag write failed — is server running?'); });
   }
   showCurrent();
@@ -555,7 +594,7 @@ function removeTag(tag) {
   }
   if (PORT) {
     fetch(PORT + '/api/removetag', {
-      method: 'POST', headers: {'Content-Type': 'application/json'},
+      method: 'POST', headers: serverHeaders(),
       body: JSON.stringify({ filePath: path, tag: tag })
     }).catch(function() {});
   }
@@ -16,7 +16,7 @@ echo ""
 pkill -9 media-server 2>/dev/null || true
 
 echo "Building server..."
-go build -o media-server ./cmd/media-server
+go build -tags sqlite_fts5 -o media-server ./cmd/media-server
 
 echo "✅ Build complete!"
 echo ""
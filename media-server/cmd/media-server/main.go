@@ -1,25 +1,37 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"crypto/tls"
 	"embed"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/tdsanchez/PostMac/internal/auth"
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/events"
 	"github.com/tdsanchez/PostMac/internal/handlers"
+	"github.com/tdsanchez/PostMac/internal/library"
+	"github.com/tdsanchez/PostMac/internal/metrics"
 	"github.com/tdsanchez/PostMac/internal/persistence"
 	"github.com/tdsanchez/PostMac/internal/scanner"
+	"github.com/tdsanchez/PostMac/internal/search"
 	"github.com/tdsanchez/PostMac/internal/state"
+	"github.com/tdsanchez/PostMac/internal/tlscert"
 	"github.com/tdsanchez/PostMac/internal/watcher"
 )
 
-//go:embed main_template.html main_template.js index_template.html gallery_template.html train_template.html
+//go:embed main_template.html main_template.js index_template.html gallery_template.html train_template.html login_template.html
 var embeddedFiles embed.FS
 
 func init() {
@@ -27,24 +39,152 @@ func init() {
 	state.Initialize()
 }
 
+// stringList is a repeatable string flag (--root a --root b)
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "maintenance" {
+		runMaintenance(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		runUsers(os.Args[2:])
+		return
+	}
+
 	port := flag.String("port", "8080", "Port to serve on")
 	noWatch := flag.Bool("no-watch", false, "Disable filesystem watcher")
 	useStdin := flag.Bool("stdin", false, "Read file paths from stdin (one absolute path per line)")
+	nulStdin := flag.Bool("null", false, "With --stdin, paths are NUL-delimited (find -print0)")
+	scanWorkers := flag.Int("scan-workers", 4, "Scanner workers per pipeline stage (stat, xattr, comment, exif)")
+	volumeWorkers := flag.String("volume-workers", "", "Per-volume scanner workers, e.g. /Volumes/SSD=16,/mnt/sshfs=2")
+
+	var rootFlags, includeFlags, excludeFlags stringList
+	flag.Var(&rootFlags, "root", "Directory to walk recursively (repeatable)")
+	flag.Var(&includeFlags, "include", "gitignore-style pattern files under --root must match (repeatable)")
+	flag.Var(&excludeFlags, "exclude", "gitignore-style pattern to skip under --root (repeatable)")
+	rootsConfig := flag.String("roots-config", "", "JSON file listing directory roots with per-root rules")
+	symlinks := flag.String("symlinks", library.SymlinksSkip, "Symlink policy for --root walks: skip, files or follow")
+	includeHidden := flag.Bool("include-hidden", false, "Include hidden files and directories in --root walks")
+	maxDepth := flag.Int("max-depth", 0, "Maximum directory depth for --root walks (0 = unlimited)")
+	textIndexLimit := flag.Int64("text-index-limit", cache.TextIndexLimit, "Bytes of each text file's contents to add to the full-text index")
+	backupInterval := flag.Duration("backup-interval", 24*time.Hour, "Automatic online backup interval for the cache databases (0 disables)")
+	backupKeep := flag.Int("backup-keep", 7, "Automatic backups to keep per database")
+	backupDir := flag.String("backup-dir", "", "Automatic backup directory (default ~/.media-server-conf/backups)")
+	migrateOnly := flag.Bool("migrate-only", false, "Migrate the cache and ML databases for --port to the current schema, print versions and exit")
+	checkSchema := flag.Bool("check-schema", false, "Print current and target schema versions for --port and exit (status 1 if a migration is pending)")
+	cameraTZ := flag.String("camera-tz", "", "Zone of camera clocks for dates without an EXIF offset, e.g. Europe/Paris or +02:00 (default MST, UTC-7)")
+	cameraTZConfig := flag.String("camera-tz-config", "", "JSON file with per-folder and per-camera-model default timezones")
+	integrityInterval := flag.Duration("integrity-interval", 6*time.Hour, "Background integrity check interval for new and changed files (0 disables)")
+	integrityFull := flag.Bool("integrity-full", false, "Fully decode JPEG, PNG and GIF image data during integrity checks (slower)")
+	sessionTTL := flag.Duration("session-ttl", 30*24*time.Hour, "How long a browser login lasts")
+	var corsOrigins stringList
+	flag.Var(&corsOrigins, "cors-origin", `Origin allowed to call /api/* from another page, e.g. "null" for file:// artifacts or https://host (repeatable, "*" = any)`)
+	tlsCert := flag.String("tls-cert", "", "PEM certificate (chain) file to serve HTTPS with; needs --tls-key")
+	tlsKey := flag.String("tls-key", "", "PEM private key file for --tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Serve HTTPS with a certificate from a local CA created and kept in ~/.media-server-conf/tls")
+	var tlsHosts stringList
+	flag.Var(&tlsHosts, "tls-host", "Extra host name or IP address for the --tls-self-signed certificate (repeatable)")
+	httpRedirect := flag.String("http-redirect", "", "With HTTPS, also listen on this port and redirect plain HTTP to HTTPS")
+	relocate := flag.String("relocate", "", "Rewrite cached paths from one prefix to another before starting, e.g. /Volumes/Old=/Volumes/New")
 	flag.Parse()
 
+	// Schema maintenance modes run before anything else touches the databases
+	if *checkSchema || *migrateOnly {
+		if *migrateOnly {
+			c, err := cache.New(*port)
+			if err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			c.Close()
+		}
+		statuses, err := cache.CheckSchema(*port)
+		if err != nil {
+			log.Fatalf("Schema check failed: %v", err)
+		}
+		pending := false
+		for _, st := range statuses {
+			note := "up to date"
+			switch {
+			case !st.Exists:
+				note = "not created yet"
+			case st.Unsupported():
+				note = "newer than this build"
+				pending = true
+			case st.Pending():
+				note = "migration pending"
+				pending = true
+			}
+			fmt.Printf("%-12s v%d → v%d  %s  (%s)\n", st.Name, st.Current, st.Target, note, st.Path)
+		}
+		if pending {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// HTTPS certificate, checked before the slow startup work
+	certFile, keyFile := *tlsCert, *tlsKey
+	switch {
+	case (certFile == "") != (keyFile == ""):
+		log.Fatal("--tls-cert and --tls-key must be given together")
+	case *tlsSelfSigned && certFile != "":
+		log.Fatal("--tls-self-signed cannot be combined with --tls-cert")
+	case *tlsSelfSigned:
+		dir, err := tlscert.DefaultDir()
+		if err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		if certFile, keyFile, err = tlscert.EnsureSelfSigned(dir, tlscert.Hosts(tlsHosts)); err != nil {
+			log.Fatalf("Failed to set up self-signed TLS: %v", err)
+		}
+	}
+	if certFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+	} else if *httpRedirect != "" {
+		log.Fatal("--http-redirect needs HTTPS (--tls-cert/--tls-key or --tls-self-signed)")
+	}
+
+	volumes, err := scanner.ParseVolumeWorkers(*volumeWorkers)
+	if err != nil {
+		log.Fatalf("Invalid --volume-workers: %v", err)
+	}
+	scanner.SetScanOptions(scanner.ScanOptions{
+		DefaultWorkers: *scanWorkers,
+		VolumeWorkers:  volumes,
+	})
+	cache.TextIndexLimit = *textIndexLimit
+
+	// Camera clock zones for date analysis
+	tzRules := &scanner.TimezoneRules{}
+	if *cameraTZConfig != "" {
+		if tzRules, err = scanner.LoadTimezoneRules(*cameraTZConfig); err != nil {
+			log.Fatalf("Failed to load camera timezone config: %v", err)
+		}
+	}
+	if *cameraTZ != "" {
+		tzRules.Default = *cameraTZ
+	}
+	if err := tzRules.Prepare(); err != nil {
+		log.Fatalf("Invalid camera timezone: %v", err)
+	}
+	scanner.SetTimezoneRules(tzRules)
+
 	// Read stdin paths (required for incremental scanning mode)
 	var stdinPaths []string
 	if *useStdin {
 		log.Println("📥 Reading file paths from stdin...")
-		stdinScanner := bufio.NewScanner(os.Stdin)
-		for stdinScanner.Scan() {
-			path := strings.TrimSpace(stdinScanner.Text())
-			if path != "" {
-				stdinPaths = append(stdinPaths, path)
-			}
-		}
-		if err := stdinScanner.Err(); err != nil {
+		stdinPaths, err = library.ReadPaths(os.Stdin, *nulStdin)
+		if err != nil {
 			log.Fatalf("Error reading from stdin: %v", err)
 		}
 		log.Printf("📥 Read %d file paths from stdin\n", len(stdinPaths))
@@ -53,12 +193,74 @@ func main() {
 		state.SetStdinPaths(stdinPaths)
 	}
 
-	// Load from cache or process stdin paths
-	dbCache, err := scanner.LoadOrScan(stdinPaths, *port)
+	// Collect directory roots from flags and the roots config file
+	var roots []library.Root
+	for _, dir := range rootFlags {
+		roots = append(roots, library.Root{
+			Path:          dir,
+			Include:       includeFlags,
+			Exclude:       excludeFlags,
+			Symlinks:      *symlinks,
+			IncludeHidden: *includeHidden,
+			MaxDepth:      *maxDepth,
+		})
+	}
+	if *rootsConfig != "" {
+		fileRoots, err := library.LoadRootsFile(*rootsConfig)
+		if err != nil {
+			log.Fatalf("Failed to load roots config: %v", err)
+		}
+		roots = append(roots, fileRoots...)
+	}
+
+	// Rewrite cached paths for a volume mounted somewhere new
+	if *relocate != "" {
+		from, to, ok := strings.Cut(*relocate, "=")
+		if !ok || from == "" || to == "" {
+			log.Fatalf("Invalid --relocate %q (want OLD=NEW)", *relocate)
+		}
+		c, err := cache.New(*port)
+		if err != nil {
+			log.Fatalf("Failed to open cache: %v", err)
+		}
+		files, decisions, err := c.RelocatePrefix(from, to)
+		c.Close()
+		if err != nil {
+			log.Fatalf("Relocation failed: %v", err)
+		}
+		log.Printf("🔀 Relocated %s → %s (%d files, %d date decisions)", from, to, files, decisions)
+
+		// Stdin paths and roots under the old mount point move too
+		state.SetRoots(roots)
+		state.RelocateLibraryPaths(filepath.Clean(from), filepath.Clean(to))
+		roots, stdinPaths = state.GetRoots(), state.GetStdinPaths()
+	}
+
+	for i := range roots {
+		if err := roots[i].Prepare(); err != nil {
+			if os.IsNotExist(err) && !library.VolumeOnline(library.VolumeRoot(roots[i].Path)) {
+				log.Printf("💤 Root %s is on an offline volume; cached files are kept", roots[i].Path)
+				continue
+			}
+			log.Fatalf("Invalid root %s: %v", roots[i].Path, err)
+		}
+	}
+
+	// Walk roots and merge with stdin paths
+	libraryPaths := stdinPaths
+	if len(roots) > 0 {
+		state.SetRoots(roots)
+		log.Printf("📂 Walking %d directory roots...", len(roots))
+		rootPaths := library.WalkRoots(roots)
+		log.Printf("📂 Found %d files under directory roots", len(rootPaths))
+		libraryPaths = library.MergePaths(stdinPaths, rootPaths)
+	}
+
+	// Load from cache or process library paths
+	dbCache, err := scanner.LoadOrScan(libraryPaths, *port)
 	if err != nil {
 		log.Fatalf("Failed to load/scan: %v", err)
 	}
-	defer dbCache.Close()
 
 	fmt.Printf("✅ Found %d media files\n", state.GetFileCount())
 	fmt.Printf("✅ Found %d tag categories\n\n", state.GetCategoryCount())
@@ -66,9 +268,57 @@ func main() {
 	// Set cache for persistence layer
 	state.SetCache(dbCache)
 
+	// Accounts, sessions and API tokens live in the cache database
+	authOptions := auth.Options{Port: *port, SessionTTL: *sessionTTL, AllowedOrigins: corsOrigins}
+	if err := auth.Init(dbCache, authOptions); err != nil {
+		log.Fatalf("Failed to load user accounts: %v", err)
+	}
+	if auth.Enabled() {
+		log.Println("🔐 Authentication on: log in at /login or send an API token")
+	} else {
+		log.Printf("🔓 Authentication off: anyone who can reach port %s can edit and delete files", *port)
+		log.Printf("   Create an admin with: media-server users add NAME --role admin --port %s", *port)
+	}
+	if len(corsOrigins) > 0 {
+		log.Printf("🌍 Cross-origin API access allowed from: %s", corsOrigins.String())
+	}
+
+	// text:"..." search predicates query the full-text index
+	if dbCache.TextSearchAvailable() {
+		search.TextMatcher = dbCache.MatchText
+	}
+
+	// SIGINT/SIGTERM (or /api/shutdown) stop the background workers and the
+	// server, then pending writes are flushed and the databases closed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var workers []<-chan struct{}
+
+	// Track external volumes going offline and coming back
+	workers = append(workers, scanner.StartVolumeMonitor(ctx, 30*time.Second))
+
+	// Flag truncated and corrupt files under ⚠️ Broken Files
+	if *integrityInterval > 0 {
+		workers = append(workers, scanner.StartIntegrityValidator(ctx, dbCache, *integrityInterval, *integrityFull))
+	}
+
+	// Scheduled online backups of the cache and ML databases
+	if *backupInterval > 0 {
+		dir := *backupDir
+		if dir == "" {
+			if dir, err = cache.DefaultBackupDir(); err != nil {
+				log.Printf("⚠️  Auto-backup disabled: %v", err)
+			}
+		}
+		if dir != "" {
+			workers = append(workers, dbCache.StartAutoBackup(ctx, dir, *backupInterval, *backupKeep))
+		}
+	}
+
 	// Start filesystem watcher for auto-rescan (unless disabled)
-	if !*noWatch && len(stdinPaths) > 0 {
-		fsWatcher, err := watcher.NewFromPaths(stdinPaths, dbCache)
+	var fsWatcher *watcher.Watcher
+	if !*noWatch && len(libraryPaths) > 0 {
+		fsWatcher, err = watcher.NewFromPaths(libraryPaths, dbCache)
 		if err != nil {
 			log.Printf("⚠️  Warning: Failed to start filesystem watcher: %v", err)
 			log.Println("   Auto-rescan disabled, but manual rescan button still available")
@@ -83,35 +333,71 @@ func main() {
 	// Set embedded files for handlers
 	handlers.SetEmbeddedFiles(embeddedFiles)
 
-	// Register routes
-	http.HandleFunc("/", handlers.HandleRoot)
-	http.HandleFunc("/tag/", handlers.HandleTag)
-	http.HandleFunc("/view/", handlers.HandleViewer)
-	http.HandleFunc("/train", handlers.HandleTraining)
-	http.HandleFunc("/viewer.js", handlers.HandleViewerJS)
-	http.HandleFunc("/file/", handlers.HandleFile)
-	http.HandleFunc("/api/addtag", handlers.HandleAddTag)
-	http.HandleFunc("/api/removetag", handlers.HandleRemoveTag)
-	http.HandleFunc("/api/batchaddtag", handlers.HandleBatchAddTag)
-	http.HandleFunc("/api/alltags", handlers.HandleGetAllTags)
-	http.HandleFunc("/api/filelist", handlers.HandleGetFileList)
-	http.HandleFunc("/api/comment", handlers.HandleUpdateComment)
-	http.HandleFunc("/api/shutdown", handlers.HandleShutdown)
-	http.HandleFunc("/api/rescan", handlers.HandleRescan)
-	http.HandleFunc("/api/scanstatus", handlers.HandleScanStatus)
-	http.HandleFunc("/api/deletefile", handlers.HandleDeleteFile)
-	http.HandleFunc("/api/metadata", handlers.HandleMetadata)
-	http.HandleFunc("/api/quicklook", handlers.HandleQuickLook)
-	http.HandleFunc("/api/convert/", handlers.HandleConvert)
-	http.HandleFunc("/api/search", handlers.HandleSearch)
-	http.HandleFunc("/api/log-invalid-path", handlers.HandleLogInvalidPath)
-	http.HandleFunc("/api/datedecision", handlers.HandleSaveDateDecision)
-	http.HandleFunc("/api/datestats", handlers.HandleGetDateStats)
-	http.HandleFunc("/api/datepredict", handlers.HandleGetDatePrediction)
-	http.HandleFunc("/api/scan-progress", handlers.HandleScanProgress)
+	// Register routes; each names the least role that may use it (see auth.Roles)
+	http.HandleFunc("/login", handlers.HandleLogin)
+	http.HandleFunc("/healthz", handlers.HandleHealthz)
+	http.HandleFunc("/readyz", handlers.HandleReadyz)
+	http.HandleFunc("/metrics", auth.Require(auth.RoleViewer, handlers.HandleMetrics))
+	http.HandleFunc("/logout", auth.Require(auth.RoleViewer, handlers.HandleLogout))
+	http.HandleFunc("/", auth.Require(auth.RoleViewer, handlers.HandleRoot))
+	http.HandleFunc("/tag/", auth.Require(auth.RoleViewer, handlers.HandleTag))
+	http.HandleFunc("/view/", auth.Require(auth.RoleViewer, handlers.HandleViewer))
+	http.HandleFunc("/train", auth.Require(auth.RoleViewer, handlers.HandleTraining))
+	http.HandleFunc("/viewer.js", auth.Require(auth.RoleViewer, handlers.HandleViewerJS))
+	http.HandleFunc("/file/", auth.Require(auth.RoleViewer, handlers.HandleFile))
+	http.HandleFunc("/api/addtag", auth.RequireScope(auth.RoleTagger, auth.ScopeTags, handlers.HandleAddTag))
+	http.HandleFunc("/api/removetag", auth.RequireScope(auth.RoleTagger, auth.ScopeTags, handlers.HandleRemoveTag))
+	http.HandleFunc("/api/batchaddtag", auth.RequireScope(auth.RoleTagger, auth.ScopeTags, handlers.HandleBatchAddTag))
+	http.HandleFunc("/api/rating", auth.Require(auth.RoleTagger, handlers.HandleSetRating))
+	http.HandleFunc("/api/batchrating", auth.Require(auth.RoleTagger, handlers.HandleBatchSetRating))
+	http.HandleFunc("/api/collections", auth.Require(auth.RoleViewer, handlers.HandleListCollections))
+	http.HandleFunc("/api/collection", auth.Require(auth.RoleViewer, handlers.HandleGetCollection))
+	http.HandleFunc("/api/collection/create", auth.Require(auth.RoleTagger, handlers.HandleCreateCollection))
+	http.HandleFunc("/api/collection/delete", auth.Require(auth.RoleTagger, handlers.HandleDeleteCollection))
+	http.HandleFunc("/api/collection/append", auth.Require(auth.RoleTagger, handlers.HandleAppendCollection))
+	http.HandleFunc("/api/collection/remove", auth.Require(auth.RoleTagger, handlers.HandleRemoveFromCollection))
+	http.HandleFunc("/api/collection/reorder", auth.Require(auth.RoleTagger, handlers.HandleReorderCollection))
+	http.HandleFunc("/api/collection/note", auth.Require(auth.RoleTagger, handlers.HandleSetCollectionNote))
+	http.HandleFunc("/api/collection/export", auth.Require(auth.RoleViewer, handlers.HandleExportCollection))
+	http.HandleFunc("/api/alltags", auth.Require(auth.RoleViewer, handlers.HandleGetAllTags))
+	http.HandleFunc("/api/filelist", auth.Require(auth.RoleViewer, handlers.HandleGetFileList))
+	http.HandleFunc("/api/comment", auth.Require(auth.RoleTagger, handlers.HandleUpdateComment))
+	http.HandleFunc("/api/shutdown", auth.Require(auth.RoleAdmin, handlers.HandleShutdown))
+	http.HandleFunc("/api/rescan", auth.Require(auth.RoleTagger, handlers.HandleRescan))
+	http.HandleFunc("/api/scanstatus", auth.Require(auth.RoleViewer, handlers.HandleScanStatus))
+	http.HandleFunc("/api/events", auth.Require(auth.RoleViewer, handlers.HandleEvents))
+	http.HandleFunc(handlers.APIV1Prefix, auth.Require(auth.RoleViewer, handlers.HandleAPIV1))
+	http.HandleFunc("/api/deletefile", auth.Require(auth.RoleAdmin, handlers.HandleDeleteFile))
+	http.HandleFunc("/api/metadata", auth.Require(auth.RoleViewer, handlers.HandleMetadata))
+	http.HandleFunc("/api/quicklook", auth.Require(auth.RoleViewer, handlers.HandleQuickLook))
+	http.HandleFunc("/api/convert/", auth.Require(auth.RoleViewer, handlers.HandleConvert))
+	http.HandleFunc("/api/search", auth.Require(auth.RoleViewer, handlers.HandleSearch))
+	http.HandleFunc("/api/textsearch", auth.Require(auth.RoleViewer, handlers.HandleTextSearch))
+	http.HandleFunc("/api/geojson", auth.Require(auth.RoleViewer, handlers.HandleGeoJSON))
+	http.HandleFunc("/api/timeline", auth.Require(auth.RoleViewer, handlers.HandleTimelineHistogram))
+	http.HandleFunc("/api/log-invalid-path", auth.Require(auth.RoleViewer, handlers.HandleLogInvalidPath))
+	http.HandleFunc("/api/datedecision", auth.Require(auth.RoleTagger, handlers.HandleSaveDateDecision))
+	http.HandleFunc("/api/datestats", auth.Require(auth.RoleViewer, handlers.HandleGetDateStats))
+	http.HandleFunc("/api/datepredict", auth.Require(auth.RoleViewer, handlers.HandleGetDatePrediction))
+	http.HandleFunc("/api/scan-progress", auth.Require(auth.RoleViewer, handlers.HandleScanProgress))
+	http.HandleFunc("/api/volumes", auth.Require(auth.RoleViewer, handlers.HandleVolumes))
+	http.HandleFunc("/api/integrity", auth.RequireWrite(auth.RoleViewer, auth.RoleAdmin, handlers.HandleIntegrity))
+	http.HandleFunc("/api/relocate", auth.Require(auth.RoleAdmin, handlers.HandleRelocate))
+	http.HandleFunc("/api/whoami", auth.Require(auth.RoleViewer, handlers.HandleWhoAmI))
+	http.HandleFunc("/api/tokens", auth.Require(auth.RoleViewer, handlers.HandleListTokens))
+	http.HandleFunc("/api/token/create", auth.Require(auth.RoleViewer, handlers.HandleCreateToken))
+	http.HandleFunc("/api/token/revoke", auth.Require(auth.RoleViewer, handlers.HandleRevokeToken))
+	http.HandleFunc("/api/users", auth.Require(auth.RoleAdmin, handlers.HandleListUsers))
+	http.HandleFunc("/api/user/create", auth.Require(auth.RoleAdmin, handlers.HandleCreateUser))
+	http.HandleFunc("/api/user/update", auth.Require(auth.RoleAdmin, handlers.HandleUpdateUser))
+	http.HandleFunc("/api/user/delete", auth.Require(auth.RoleAdmin, handlers.HandleDeleteUser))
+	http.HandleFunc("/api/audit", auth.Require(auth.RoleAdmin, handlers.HandleAuditLog))
 
 	addr := ":" + *port
 	url := "http://localhost" + addr
+	if certFile != "" {
+		url = "https://localhost" + addr
+	}
 
 	fmt.Printf("🚀 Media Server Started\n")
 	fmt.Printf("🌐 URL: %s\n", url)
@@ -124,7 +410,107 @@ func main() {
 	}()
 
 	// Start background batch write processor
-	go persistence.StartBatchProcessor()
+	workers = append(workers, persistence.StartBatchProcessor(ctx))
+
+	server := &http.Server{Addr: addr, Handler: auth.CORS(metrics.Instrument(http.DefaultServeMux))}
+	server.RegisterOnShutdown(events.DisconnectAll) // Open event streams would hold up Shutdown
+	handlers.SetShutdownFunc(stop)
+
+	serveErr := make(chan error, 1)
+	var redirect *http.Server
+	if certFile == "" {
+		go func() { serveErr <- server.ListenAndServe() }()
+	} else {
+		// ServeTLS negotiates HTTP/2 ("h2") over ALPN, falling back to HTTP/1.1
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("🔒 HTTPS with HTTP/2 on port %s (certificate %s)", *port, certFile)
+		if *httpRedirect != "" {
+			redirect = serveHTTPSRedirect(*httpRedirect, *port)
+		}
+		go func() { serveErr <- server.ListenAndServeTLS(certFile, keyFile) }()
+	}
 
-	log.Fatal(http.ListenAndServe(addr, nil))
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop() // A second Ctrl+C exits immediately
+	shutdown(server, redirect, fsWatcher, workers, dbCache)
+}
+
+// shutdownTimeout bounds each step of the graceful shutdown
+const shutdownTimeout = 10 * time.Second
+
+// shutdown stops the server gracefully: in-flight requests finish, the
+// watcher, freshness check and background workers stop, pending tag and
+// rating writes are flushed, and the databases are closed
+func shutdown(server, redirect *http.Server, fsWatcher *watcher.Watcher, workers []<-chan struct{}, dbCache *cache.Cache) {
+	log.Println("🛑 Shutting down (Ctrl+C again to force)...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  Requests still open at shutdown: %v", err)
+	}
+	if redirect != nil {
+		redirect.Shutdown(ctx)
+	}
+	cancel()
+
+	if fsWatcher != nil {
+		fsWatcher.Stop()
+	}
+	if fs := scanner.GetFreshnessScanner(); fs != nil {
+		fs.Stop()
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	for _, done := range workers {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		log.Println("⚠️  Background workers did not stop in time")
+	}
+	cancel()
+
+	// The flush gets its own timeout, so slow workers can't use it up
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	flushed := persistence.FlushWriteQueue(ctx)
+	log.Printf("💾 Flushed %d tag and %d rating writes (%d failed)", flushed.Tags, flushed.Ratings, flushed.Failed)
+	if flushed.Pending > 0 {
+		log.Printf("⚠️  %d writes could not be saved and are lost", flushed.Pending)
+	}
+
+	if err := dbCache.Close(); err != nil {
+		log.Printf("⚠️  Failed to close cache: %v", err)
+	}
+	log.Println("👋 Server shutdown complete")
+}
+
+// serveHTTPSRedirect answers plain HTTP on port with a redirect to the same
+// URL over HTTPS on httpsPort, keeping the method (308)
+func serveHTTPSRedirect(port, httpsPort string) *http.Server {
+	log.Printf("↪️  Redirecting http://:%s to HTTPS", port)
+	redirect := &http.Server{Addr: ":" + port, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Trim(r.Host, "[]")
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 literal
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})}
+	go func() {
+		if err := redirect.ListenAndServe(); err != http.ErrServerClosed {
+			log.Printf("⚠️  HTTP redirect listener stopped: %v", err)
+		}
+	}()
+	return redirect
 }
@@ -1,5 +1,8 @@
 const filePath = '{{.File.Path | jsEscape}}';
-const isText = {{isTextFile .File.Name}};
+// Revision of the tags and comment shown; sent with edits so a change made
+// elsewhere since the page loaded is reported instead of overwritten
+let fileETag = '{{fileETag .File}}';
+const isText = {{and (isTextFile .File.Name) (not .File.Offline)}};
 const isConvertible = {{isConvertibleFile .File.Name}};
 const currentTag = '{{.Tag | jsEscape}}';
 const totalFiles = {{.Total}};
@@ -268,6 +271,12 @@ fetch('/api/metadata?file=' + encodeURIComponent(filePath))
 		if (data.width && data.height) {
 			parts.push(data.width + '×' + data.height);
 		}
+		if (data.duration) {
+			parts.push(data.duration);
+		}
+		if (data.videoCodec) {
+			parts.push(data.audioCodec ? data.videoCodec + '/' + data.audioCodec : data.videoCodec);
+		}
 		if (data.fileSize) {
 			const sizeInMB = data.fileSize / (1024*1024);
 			const size = (sizeInMB >= 1)
@@ -278,6 +287,18 @@ fetch('/api/metadata?file=' + encodeURIComponent(filePath))
 		if (data.created) {
 			parts.push(new Date(data.created).toLocaleDateString());
 		}
+		if (data.location) {
+			parts.push('📍 ' + data.location.latitude.toFixed(5) + ', ' + data.location.longitude.toFixed(5));
+		}
+		if (data.rating) {
+			parts.push('★'.repeat(data.rating) + '☆'.repeat(5 - data.rating));
+		}
+		if (data.colorLabel) {
+			parts.push('🎨 ' + data.colorLabel);
+		}
+		if (data.broken) {
+			parts.push('⚠️ ' + data.broken);
+		}
 
 		metadataEl.textContent = parts.length > 0 ? '[' + parts.join(' | ') + ']' : '[No metadata]';
 	})
@@ -352,13 +373,18 @@ function addTag(tagName) {
 	fetch('/api/addtag', {
 		method: 'POST',
 		headers: { 'Content-Type': 'application/json' },
-		body: JSON.stringify({ filePath: filePath, tag: tagName })
+		body: JSON.stringify({ filePath: filePath, tag: tagName, etag: fileETag })
 	})
 	.then(r => r.json())
 	.then(data => {
 		if (data.success) {
+			fileETag = data.etag || fileETag;
 			showNotification('✅ Tag added: ' + tagName);
 			updateTagsDisplay(data.tags);
+		} else if (data.conflict) {
+			showConflict(data.current);
+		} else if (data.error) {
+			showNotification('❌ ' + data.error);
 		}
 	})
 	.catch(err => console.error('Error adding tag:', err));
@@ -368,18 +394,36 @@ function removeTag(tagName) {
 	fetch('/api/removetag', {
 		method: 'POST',
 		headers: { 'Content-Type': 'application/json' },
-		body: JSON.stringify({ filePath: filePath, tag: tagName })
+		body: JSON.stringify({ filePath: filePath, tag: tagName, etag: fileETag })
 	})
 	.then(r => r.json())
 	.then(data => {
 		if (data.success) {
+			fileETag = data.etag || fileETag;
 			showNotification('✅ Tag removed: ' + tagName);
 			updateTagsDisplay(data.tags);
+		} else if (data.conflict) {
+			showConflict(data.current);
+		} else if (data.error) {
+			showNotification('❌ ' + data.error);
 		}
 	})
 	.catch(err => console.error('Error removing tag:', err));
 }
 
+// showConflict shows the file as it is now after an edit was rejected because
+// the file changed since it was loaded; the user can redo the edit on top
+function showConflict(current) {
+	fileETag = current.etag;
+	updateTagsDisplay(current.tags || []);
+	const display = document.getElementById('comment-display');
+	if (display) {
+		display.textContent = current.comment;
+		display.classList.toggle('empty', current.comment === '');
+	}
+	showNotification('⚠️ File was changed elsewhere - reloaded, please redo your edit');
+}
+
 function updateTagsDisplay(tags) {
 	const container = document.getElementById('tags-container');
 	container.innerHTML = '';
@@ -638,7 +682,8 @@ async function saveComment() {
 	try {
 		const payload = {
 			filepath: filePath,
-			comment: newComment
+			comment: newComment,
+			etag: fileETag
 		};
 		console.log('Sending payload:', JSON.stringify(payload));
 
@@ -653,9 +698,14 @@ async function saveComment() {
 		console.log('Response status:', response.status);
 		console.log('Response ok:', response.ok);
 
+		if (response.status === 409) {
+			showConflict((await response.json()).current);
+			return;
+		}
 		if (!response.ok) {
 			throw new Error('Failed to update comment');
 		}
+		fileETag = (await response.json()).etag || fileETag;
 
 		// Update UI
 		display.textContent = newComment;
@@ -729,11 +779,19 @@ async function confirmShutdown() {
 		});
 
 		if (response.ok) {
+			const data = await response.json();
+			const flushed = data.flushed || {};
+			const saved = (flushed.tags || 0) + (flushed.ratings || 0);
+			let detail = saved ? `Saved ${saved} pending edit${saved === 1 ? '' : 's'}.` : '';
+			if (flushed.pending) {
+				detail += ` ${flushed.pending} could not be written to disk; see the server log.`;
+			}
+
 			// Update modal to show shutdown message
 			const modal = document.querySelector('.modal');
 			modal.innerHTML = `
 				<div class="modal-title">👋 Shutting Down</div>
-				<div class="modal-message">Media server is shutting down...</div>
+				<div class="modal-message">Media server is shutting down... ${detail}</div>
 			`;
 
 			// Give server time to shutdown, then close window
@@ -795,10 +853,13 @@ async function confirmDelete() {
 			headers: {
 				'Content-Type': 'application/json',
 			},
-			body: JSON.stringify({ filePath: filePath })
+			body: JSON.stringify({ filePath: filePath, etag: fileETag })
 		});
 
-		if (response.ok) {
+		if (response.status === 409) {
+			hideDeleteModal();
+			showConflict((await response.json()).current);
+		} else if (response.ok) {
 			const data = await response.json();
 
 			// Update modal to show success message
@@ -858,3 +919,43 @@ document.getElementById('deleteModal').addEventListener('click', function(e) {
 		}
 	}
 })();
+
+// ============================================================================
+// LIVE UPDATES (server-sent events from /api/events)
+// ============================================================================
+
+// Tag and comment edits made in another tab, in Finder or by a script show up
+// without a reload. EventSource reconnects on its own and resumes with
+// Last-Event-ID, so nothing is missed across a brief disconnect.
+if (window.EventSource) {
+	const events = new EventSource('/api/events');
+
+	events.addEventListener('tags-changed', e => {
+		const data = JSON.parse(e.data);
+		if (data.path === filePath) {
+			fileETag = data.etag || fileETag;
+			updateTagsDisplay(data.tags || []);
+		}
+	});
+
+	events.addEventListener('comment-changed', e => {
+		const data = JSON.parse(e.data);
+		// While editing, keep the old ETag so saving reports the conflict
+		if (data.path !== filePath || isEditingComment) {
+			return;
+		}
+		fileETag = data.etag || fileETag;
+		const display = document.getElementById('comment-display');
+		if (display) {
+			display.textContent = data.comment;
+			display.classList.toggle('empty', data.comment === '');
+		}
+	});
+
+	events.addEventListener('file-deleted', e => {
+		const data = JSON.parse(e.data);
+		if (data.path === filePath) {
+			showNotification('🗑️ This file was deleted or moved');
+		}
+	});
+}
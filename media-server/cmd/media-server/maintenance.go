@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/library"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/scanner"
+)
+
+const maintenanceUsage = `Usage: media-server maintenance [flags] <operation>...
+
+Operations:
+  backup     Online backup of the cache and ML databases (safe while serving)
+  check      PRAGMA integrity_check on both databases
+  cleanup    Delete tag rows that point at no file
+  vacuum     Rebuild both database files to reclaim space
+  missing    List cached files that no longer exist on disk (--prune deletes them)
+  rebuild    Re-read tags, comments and dates from the files' xattrs and rewrite the cache
+             (with --stdin, the cache is rewritten to exactly the listed files)
+  all        backup, check, cleanup, missing, vacuum
+
+Flags:
+`
+
+// runMaintenance implements "media-server maintenance ..."
+func runMaintenance(args []string) {
+	fs := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	port := fs.String("port", "8080", "Port whose cache-PORT.db / ml-training-PORT.db to operate on")
+	backupDir := fs.String("backup-dir", "", "Backup directory (default ~/.media-server-conf/backups)")
+	keep := fs.Int("keep", 0, "With backup, keep only the newest N backups per database (0 = keep all)")
+	prune := fs.Bool("prune", false, "With missing, delete the rows of files that no longer exist")
+	useStdin := fs.Bool("stdin", false, "With rebuild, read the file list from stdin instead of the cache")
+	nulStdin := fs.Bool("null", false, "With --stdin, paths are NUL-delimited (find -print0)")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, maintenanceUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ops := fs.Args()
+	if len(ops) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if len(ops) == 1 && ops[0] == "all" {
+		ops = []string{"backup", "check", "cleanup", "missing", "vacuum"}
+	}
+
+	c, err := cache.New(*port)
+	if err != nil {
+		log.Fatalf("Failed to open cache: %v", err)
+	}
+	defer c.Close()
+
+	failed := false
+	for _, op := range ops {
+		var err error
+		switch op {
+		case "backup":
+			err = maintenanceBackup(c, *backupDir, *keep)
+		case "check":
+			err = maintenanceCheck(c)
+		case "cleanup":
+			var n int64
+			if n, err = c.CleanupOrphanTags(); err == nil {
+				fmt.Printf("🧹 Removed %d orphaned tag rows\n", n)
+			}
+		case "vacuum":
+			if err = c.Vacuum(); err == nil {
+				fmt.Println("🧹 Vacuumed both databases")
+			}
+		case "missing":
+			err = maintenanceMissing(c, *prune)
+		case "rebuild":
+			err = maintenanceRebuild(c, *useStdin, *nulStdin)
+		default:
+			fs.Usage()
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", op, err)
+			failed = true
+		}
+	}
+	if failed {
+		c.Close()
+		os.Exit(1)
+	}
+}
+
+func maintenanceBackup(c *cache.Cache, dir string, keep int) error {
+	if dir == "" {
+		var err error
+		if dir, err = cache.DefaultBackupDir(); err != nil {
+			return err
+		}
+	}
+	written, err := c.Backup(dir)
+	if err != nil {
+		return err
+	}
+	for _, path := range written {
+		fmt.Printf("🗄️  Backed up to %s\n", path)
+	}
+	if keep > 0 {
+		removed, err := c.PruneBackups(dir, keep)
+		if err != nil {
+			return err
+		}
+		for _, path := range removed {
+			fmt.Printf("🗑  Pruned %s\n", path)
+		}
+	}
+	return nil
+}
+
+func maintenanceCheck(c *cache.Cache) error {
+	problems, err := c.IntegrityCheck()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Println("✅ Integrity check passed")
+		return nil
+	}
+	for name, lines := range problems {
+		for _, line := range lines {
+			fmt.Printf("⚠️  %s: %s\n", name, line)
+		}
+	}
+	return fmt.Errorf("integrity check found problems (restore a backup or run rebuild)")
+}
+
+// maintenanceMissing lists rows whose files are gone. Files on unmounted
+// volumes are reported separately and never pruned.
+func maintenanceMissing(c *cache.Cache, prune bool) error {
+	paths, err := c.FilePaths()
+	if err != nil {
+		return err
+	}
+
+	volumes := make(library.VolumeStatus)
+	var missing, offline int
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+		if !volumes.Online(path) {
+			offline++
+			continue
+		}
+		missing++
+		fmt.Println(path)
+		if prune {
+			if err := c.DeleteFile(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	action := "missing"
+	if prune {
+		action = "missing (pruned)"
+	}
+	fmt.Printf("📊 %d of %d cached files %s, %d on offline volumes\n", missing, len(paths), action, offline)
+	return nil
+}
+
+// maintenanceRebuild re-scans every file (tags and comments come from the
+// xattrs on disk, which are the source of truth) and rewrites the cache. Rows
+// on offline volumes are kept as they are.
+func maintenanceRebuild(c *cache.Cache, useStdin, nulStdin bool) error {
+	var paths []string
+	var err error
+	if useStdin {
+		paths, err = library.ReadPaths(os.Stdin, nulStdin)
+	} else {
+		paths, err = c.FilePaths()
+	}
+	if err != nil {
+		return err
+	}
+
+	volumes := make(library.VolumeStatus)
+	files := make([]models.FileInfo, 0, len(paths))
+	tagSet := make(map[string]bool)
+	var dropped int
+	for i, path := range paths {
+		f, err := scanner.ScanFile(path)
+		if err != nil {
+			if os.IsNotExist(err) && !volumes.Online(path) {
+				if cached := c.GetFile(path); cached != nil {
+					files = append(files, *cached)
+					continue
+				}
+			}
+			dropped++
+			continue
+		}
+		files = append(files, f)
+		for _, tag := range f.Tags {
+			tagSet[tag] = true
+		}
+		if (i+1)%1000 == 0 {
+			fmt.Printf("   %d/%d files read\n", i+1, len(paths))
+		}
+	}
+
+	stats, err := c.SaveFiles(files, len(tagSet))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔧 Rebuilt cache from %d files: %d inserted, %d updated, %d deleted, %d unchanged (%d unreadable)\n",
+		len(files), stats.Inserted, stats.Updated, stats.Deleted, stats.Unchanged, dropped)
+
+	if c.TextSearchAvailable() {
+		textStats, err := c.SyncTextIndex(files)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🔎 Text index: %d indexed, %d removed, %d unchanged\n",
+			textStats.Indexed, textStats.Removed, textStats.Unchanged)
+	}
+	return nil
+}
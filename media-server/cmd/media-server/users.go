@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/auth"
+	"github.com/tdsanchez/PostMac/internal/cache"
+)
+
+const usersUsage = `Usage: media-server users <command> [args] [flags]
+
+Commands:
+  list                 List user accounts
+  add NAME             Create an account (password read from the terminal or stdin)
+  passwd NAME          Set a new password; ends the user's browser sessions
+  role NAME ROLE       Change a user's role (viewer, tagger or admin)
+  delete NAME          Delete an account with its sessions and tokens
+  token NAME           Create an API token for scripts acting as NAME (printed once)
+  tokens [NAME]        List API tokens
+  revoke ID            Revoke an API token
+  audit                Show the newest audit log entries
+
+Authentication is on once any account exists; the first must be an admin.
+Restart a running server after adding the first or deleting the last account.
+
+Flags:
+`
+
+// runUsers implements "media-server users ..."
+func runUsers(args []string) {
+	fs := flag.NewFlagSet("users", flag.ExitOnError)
+	port := fs.String("port", "8080", "Port whose cache-PORT.db holds the accounts")
+	role := fs.String("role", "", "With add, the role (default viewer); with token, the token's role (default the user's)")
+	tokenName := fs.String("name", "", "With token, a label for the token (default cli-DATE)")
+	expires := fs.Duration("expires", 0, "With token, lifetime such as 720h (0 = never expires)")
+	scope := fs.String("scope", "", "With token, limit its writes to a scope (tags) for embedding in artifacts")
+	limit := fs.Int("limit", 50, "With audit, number of entries")
+	user := fs.String("user", "", "With audit, only this user's entries")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usersUsage)
+		fs.PrintDefaults()
+	}
+
+	// Allow flags before and after the command's arguments
+	var pos []string
+	for rest := args; ; {
+		fs.Parse(rest)
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+	if len(pos) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	want := func(n int) {
+		if len(pos) != n+1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+
+	c, err := cache.New(*port)
+	if err != nil {
+		log.Fatalf("Failed to open cache: %v", err)
+	}
+	defer c.Close()
+
+	switch pos[0] {
+	case "list":
+		want(0)
+		err = usersList(c)
+	case "add":
+		want(1)
+		err = usersAdd(c, pos[1], *role)
+	case "passwd":
+		want(1)
+		var hash string
+		if hash, err = readNewPassword(); err == nil {
+			if err = c.SetUserPassword(pos[1], hash); err == nil {
+				fmt.Printf("🔐 Password changed for %s\n", pos[1])
+			}
+		}
+	case "role":
+		want(2)
+		if !auth.ValidRole(pos[2]) {
+			err = fmt.Errorf("role must be one of %s", strings.Join(auth.Roles, ", "))
+		} else if err = c.SetUserRole(pos[1], pos[2]); err == nil {
+			fmt.Printf("👤 %s is now %s\n", pos[1], pos[2])
+		}
+	case "delete":
+		want(1)
+		if err = c.DeleteUser(pos[1]); err == nil {
+			fmt.Printf("👤 Deleted %s\n", pos[1])
+		}
+	case "token":
+		want(1)
+		err = usersToken(c, pos[1], *tokenName, *role, *scope, *expires)
+	case "tokens":
+		if len(pos) > 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = usersTokens(c, strings.Join(pos[1:], ""))
+	case "revoke":
+		want(1)
+		var id int64
+		if id, err = strconv.ParseInt(pos[1], 10, 64); err == nil {
+			if err = c.RevokeAPIToken(id, ""); err == nil {
+				fmt.Printf("🔑 Revoked token %d\n", id)
+			}
+		}
+	case "audit":
+		want(0)
+		err = usersAudit(c, *limit, *user)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", pos[0], err)
+		c.Close()
+		os.Exit(1)
+	}
+}
+
+func usersList(c *cache.Cache) error {
+	users, err := c.Users()
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		fmt.Println("No accounts: authentication is off")
+		return nil
+	}
+	for _, u := range users {
+		fmt.Printf("%-20s %-7s created %s\n", u.Name, u.Role, u.CreatedAt.Format("2006-01-02"))
+	}
+	return nil
+}
+
+func usersAdd(c *cache.Cache, name, role string) error {
+	n, err := c.UserCount()
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		role = auth.RoleViewer
+		if n == 0 {
+			role = auth.RoleAdmin
+		}
+	}
+	if !auth.ValidRole(role) {
+		return fmt.Errorf("role must be one of %s", strings.Join(auth.Roles, ", "))
+	}
+	if n == 0 && role != auth.RoleAdmin {
+		return fmt.Errorf("the first user must be an admin")
+	}
+	hash, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	if err := c.CreateUser(name, hash, role); err != nil {
+		return err
+	}
+	fmt.Printf("👤 Created %s user %s\n", role, name)
+	if n == 0 {
+		fmt.Println("🔐 Authentication is now on (restart a running server to apply)")
+	}
+	return nil
+}
+
+func usersToken(c *cache.Cache, user, name, role, scope string, ttl time.Duration) error {
+	u, err := c.GetUser(user)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		role = u.Role
+	}
+	if !auth.ValidRole(role) || !auth.Allows(u.Role, role) {
+		return fmt.Errorf("role must be a known role no higher than %s's (%s)", u.Name, u.Role)
+	}
+	if !auth.ValidScope(scope) {
+		return fmt.Errorf("scope must be one of %s", strings.Join(auth.Scopes, ", "))
+	}
+	if name == "" {
+		name = "cli-" + time.Now().Format("2006-01-02")
+	}
+	secret, id, err := auth.CreateToken(c, u.Name, name, role, scope, ttl)
+	if err != nil {
+		return err
+	}
+	kind := role
+	if scope != "" {
+		kind += " " + scope + "-scoped"
+	}
+	fmt.Fprintf(os.Stderr, "🔑 Created %s token %d %q for %s; it is shown only once:\n", kind, id, name, u.Name)
+	fmt.Println(secret)
+	return nil
+}
+
+func usersTokens(c *cache.Cache, user string) error {
+	tokens, err := c.APITokens(user)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		expires, used := "never expires", "never used"
+		if !t.ExpiresAt.IsZero() {
+			expires = "expires " + t.ExpiresAt.Format("2006-01-02 15:04")
+		}
+		if !t.LastUsedAt.IsZero() {
+			used = "used " + t.LastUsedAt.Format("2006-01-02 15:04")
+		}
+		scope := t.Scope
+		if scope == "" {
+			scope = "-"
+		}
+		fmt.Printf("%4d  %-16s %-20s %-7s %-5s %s, %s\n", t.ID, t.User, t.Name, t.Role, scope, expires, used)
+	}
+	return nil
+}
+
+func usersAudit(c *cache.Cache, limit int, user string) error {
+	entries, err := c.AuditLog(limit, user)
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		who := e.User
+		if who == "" {
+			who = "-"
+		}
+		fmt.Printf("%s  %-16s %-7s %3d  %s %s  %s  %s\n",
+			e.Time.Format("2006-01-02 15:04:05"), who, e.Role, e.Status, e.Method, e.Path, e.Remote, e.Detail)
+	}
+	return nil
+}
+
+// readNewPassword reads a password, twice without echo from a terminal or
+// once from piped stdin, and returns its hash
+func readNewPassword() (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return "", err
+	}
+	in := bufio.NewReader(os.Stdin)
+	if info.Mode()&os.ModeCharDevice == 0 {
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("no password on stdin")
+		}
+		return auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	}
+
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-echo")
+	defer stty("echo")
+	read := func(prompt string) string {
+		fmt.Fprint(os.Stderr, prompt)
+		line, _ := in.ReadString('\n')
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimRight(line, "\r\n")
+	}
+	password := read("Password: ")
+	if read("Repeat password: ") != password {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return auth.HashPassword(password)
+}
@@ -0,0 +1,467 @@
+// Package auth implements local user accounts, browser sessions, bearer API
+// tokens, role checks and the audit log.
+//
+// Authentication is on as soon as one user account exists (see "media-server
+// users add"). Until then every request is allowed, as before accounts
+// existed, and the audit log records requests without a user.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+)
+
+// Roles, lowest first. Each role can do everything the ones below it can.
+const (
+	RoleViewer = "viewer" // Browse, search and view files
+	RoleTagger = "tagger" // Also edit tags, comments, ratings and collections, and rescan
+	RoleAdmin  = "admin"  // Also delete files, relocate, shut down and manage users
+)
+
+// Roles lists the roles, lowest first
+var Roles = []string{RoleViewer, RoleTagger, RoleAdmin}
+
+// Token scopes. A scoped token reads what its role allows but only writes
+// through routes registered with RequireScope for that scope, so a token
+// embedded in a shared artifact cannot delete, rate or manage anything.
+const (
+	ScopeTags = "tags" // Add and remove tags
+)
+
+// Scopes lists the token scopes; "" is an unscoped token
+var Scopes = []string{ScopeTags}
+
+// ErrUnauthenticated is returned for a request without a valid session or token
+var ErrUnauthenticated = errors.New("authentication required")
+
+// Identity is who a request acts as
+type Identity struct {
+	User  string `json:"user"`            // "" while authentication is off
+	Role  string `json:"role"`            // Effective role
+	Token string `json:"token,omitempty"` // Name of the API token used, "" for a session
+	Scope string `json:"scope,omitempty"` // The token's scope, "" if unscoped
+
+	csrf string // CSRF token a session's writes must carry ("" for tokens)
+}
+
+// Options configure sessions and cross-origin access
+type Options struct {
+	Port           string        // Server port, part of the cookie name so instances do not share sessions
+	SessionTTL     time.Duration // How long a login lasts
+	AllowedOrigins []string      // Origins allowed to call /api/* from other pages ("null" for file://, "*" for any)
+}
+
+var (
+	store   *cache.Cache
+	options Options
+	enabled atomic.Bool
+)
+
+// maxAuditBody is how much of a request body is kept as audit detail
+const maxAuditBody = 1024
+
+type contextKey struct{}
+
+// Init sets the account store and turns authentication on if accounts exist
+func Init(c *cache.Cache, opts Options) error {
+	store, options = c, opts
+	if options.SessionTTL <= 0 {
+		options.SessionTTL = 30 * 24 * time.Hour
+	}
+	if err := Refresh(); err != nil {
+		return err
+	}
+	if Enabled() {
+		if n, err := store.DeleteExpiredSessions(); err == nil && n > 0 {
+			log.Printf("🔐 Removed %d expired sessions", n)
+		}
+	}
+	return nil
+}
+
+// Refresh re-reads whether any accounts exist, after users are added or deleted
+func Refresh() error {
+	if store == nil {
+		return nil
+	}
+	n, err := store.UserCount()
+	if err != nil {
+		return err
+	}
+	enabled.Store(n > 0)
+	return nil
+}
+
+// Enabled reports whether requests must authenticate
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Store returns the account store (nil before Init)
+func Store() *cache.Cache {
+	return store
+}
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role string) bool {
+	return rank(role) > 0
+}
+
+// ValidScope reports whether scope is "" or one of Scopes
+func ValidScope(scope string) bool {
+	if scope == "" {
+		return true
+	}
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether role includes the permissions of need
+func Allows(role, need string) bool {
+	return rank(role) > 0 && rank(role) >= rank(need)
+}
+
+func rank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// CookieName is the session cookie of this server's port
+func CookieName() string {
+	return "media_server_session_" + options.Port
+}
+
+// ============================================================================
+// Sessions and tokens
+// ============================================================================
+
+// Login checks a user's password and starts a browser session
+func Login(w http.ResponseWriter, r *http.Request, name, password string) (*Identity, error) {
+	user, err := store.GetUser(name)
+	if err != nil {
+		CheckPassword(dummyHash, password)
+		if errors.Is(err, cache.ErrUserNotFound) {
+			return nil, ErrUnauthenticated
+		}
+		return nil, err
+	}
+	if !CheckPassword(user.PasswordHash, password) {
+		return nil, ErrUnauthenticated
+	}
+
+	secret, err := newSecret("mss_")
+	if err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(options.SessionTTL)
+	if err := store.CreateSession(hashSecret(secret), user.Name, expires); err != nil {
+		return nil, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName(),
+		Value:    secret,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return &Identity{User: user.Name, Role: user.Role}, nil
+}
+
+// Logout ends the request's browser session
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(CookieName()); err == nil && store != nil {
+		store.DeleteSession(hashSecret(c.Value))
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CreateToken issues a bearer token in c acting for user with at most role,
+// limited to scope unless it is "". A zero ttl never expires. The secret is
+// returned once and only its hash is kept.
+func CreateToken(c *cache.Cache, user, name, role, scope string, ttl time.Duration) (string, int64, error) {
+	secret, err := newSecret("mst_")
+	if err != nil {
+		return "", 0, err
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	id, err := c.CreateAPIToken(user, name, hashSecret(secret), role, scope, expires)
+	return secret, id, err
+}
+
+// authenticate resolves the request's bearer token or session cookie
+func authenticate(r *http.Request) (*Identity, error) {
+	if !Enabled() {
+		return &Identity{Role: RoleAdmin}, nil
+	}
+
+	if h := r.Header.Get("Authorization"); h != "" {
+		secret, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			return nil, ErrUnauthenticated
+		}
+		user, token, err := store.TokenUser(hashSecret(strings.TrimSpace(secret)))
+		if err != nil {
+			if errors.Is(err, cache.ErrTokenNotFound) {
+				return nil, ErrUnauthenticated
+			}
+			return nil, err
+		}
+		// A token never acts above its user's current role
+		role := token.Role
+		if rank(user.Role) < rank(role) {
+			role = user.Role
+		}
+		return &Identity{User: user.Name, Role: role, Token: token.Name, Scope: token.Scope}, nil
+	}
+
+	if c, err := r.Cookie(CookieName()); err == nil {
+		user, err := store.SessionUser(hashSecret(c.Value))
+		if err != nil {
+			if errors.Is(err, cache.ErrUserNotFound) {
+				return nil, ErrUnauthenticated
+			}
+			return nil, err
+		}
+		return &Identity{User: user.Name, Role: user.Role, csrf: csrfToken(c.Value)}, nil
+	}
+	return nil, ErrUnauthenticated
+}
+
+// FromRequest returns who a request passed through Require acts as (nil otherwise)
+func FromRequest(r *http.Request) *Identity {
+	id, _ := r.Context().Value(contextKey{}).(*Identity)
+	return id
+}
+
+// Allowed reports whether the request's identity has at least role, for
+// handlers whose required role depends on the operation
+func Allowed(r *http.Request, role string) bool {
+	id := FromRequest(r)
+	return id != nil && Allows(id.Role, role)
+}
+
+// ============================================================================
+// Middleware
+// ============================================================================
+
+// Require wraps a handler so it only runs for identities with at least role.
+// Every request that could change something (anything but GET and HEAD) is
+// written to the audit log with its outcome. Writes from a browser session
+// must carry its CSRF token, and scoped tokens may not write.
+func Require(role string, h http.HandlerFunc) http.HandlerFunc {
+	return RequireWrite(role, role, h)
+}
+
+// RequireWrite is Require with one role for GET and HEAD and another for
+// every other method, for routes that both report and act
+func RequireWrite(readRole, writeRole string, h http.HandlerFunc) http.HandlerFunc {
+	return require(readRole, writeRole, "", h)
+}
+
+// RequireScope is Require for a route that tokens limited to scope may also
+// write through
+func RequireScope(role, scope string, h http.HandlerFunc) http.HandlerFunc {
+	return require(role, role, scope, h)
+}
+
+func require(readRole, writeRole, scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mutating := r.Method != http.MethodGet && r.Method != http.MethodHead
+		need := readRole
+		if mutating {
+			need = writeRole
+		}
+
+		id, err := authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrUnauthenticated) {
+				log.Printf("❌ Authentication failed: %v", err)
+				http.Error(w, "Authentication unavailable", http.StatusInternalServerError)
+				return
+			}
+			if mutating {
+				Audit(r, "", "", http.StatusUnauthorized, auditBody(r))
+			}
+			deny(w, r, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, id))
+		if !Allows(id.Role, need) {
+			Audit(r, id.User, id.Role, http.StatusForbidden, auditBody(r))
+			deny(w, r, http.StatusForbidden, "Requires the "+need+" role")
+			return
+		}
+		if !mutating {
+			h(w, r)
+			return
+		}
+		detail := auditBody(r)
+		if id.Scope != "" && id.Scope != scope {
+			Audit(r, id.User, id.Role, http.StatusForbidden, detail)
+			deny(w, r, http.StatusForbidden, "Token is limited to the "+id.Scope+" scope")
+			return
+		}
+		if !checkCSRF(r, id) {
+			Audit(r, id.User, id.Role, http.StatusForbidden, detail)
+			deny(w, r, http.StatusForbidden, "Missing or invalid CSRF token; reload the page")
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		Audit(r, id.User, id.Role, rec.status, detail)
+	}
+}
+
+// deny refuses a request: pages redirect to the login form, API callers get JSON
+func deny(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if status == http.StatusUnauthorized && r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="media-server"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
+
+// statusRecorder remembers the status a handler wrote, for the audit log
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = status, true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ============================================================================
+// Audit log
+// ============================================================================
+
+// Audit records a request in the audit log. The identity is passed in because
+// logins and refusals happen before the request carries one.
+func Audit(r *http.Request, user, role string, status int, detail string) {
+	if store == nil {
+		return
+	}
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	path := r.URL.Path
+	if id := FromRequest(r); id != nil && id.Token != "" {
+		detail = strings.TrimSpace("token=" + id.Token + " " + detail)
+	}
+	err := store.AddAuditEntry(cache.AuditEntry{
+		Time:   time.Now(),
+		User:   user,
+		Role:   role,
+		Method: r.Method,
+		Path:   path,
+		Detail: detail,
+		Status: status,
+		Remote: remote,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to write audit log: %v", err)
+	}
+}
+
+// auditBody returns the start of a request body for the audit log, with
+// password fields removed, and leaves the body readable by the handler
+func auditBody(r *http.Request) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r.URL.RawQuery
+	}
+	head, _ := io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+	var v interface{}
+	if json.Unmarshal(head, &v) == nil {
+		redactPasswords(v)
+		if b, err := json.Marshal(v); err == nil {
+			head = b
+		}
+	} else if bytes.Contains(bytes.ToLower(head), []byte("password")) {
+		return "(body withheld)"
+	}
+	detail := string(head)
+	if len(detail) > maxAuditBody {
+		detail = detail[:maxAuditBody] + "…"
+	}
+	return detail
+}
+
+// redactPasswords replaces password values in decoded JSON
+func redactPasswords(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if strings.Contains(strings.ToLower(k), "password") {
+				v[k] = "***"
+			} else {
+				redactPasswords(child)
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			redactPasswords(child)
+		}
+	}
+}
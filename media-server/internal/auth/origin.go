@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CSRFHeader and CSRFField carry a browser session's CSRF token on writes:
+// the header from scripts, the field from HTML forms
+const (
+	CSRFHeader = "X-CSRF-Token"
+	CSRFField  = "csrf_token"
+)
+
+// csrfToken derives a session's CSRF token from its secret, so it needs no
+// storage and changes with every login
+func csrfToken(sessionSecret string) string {
+	return hashSecret("csrf:" + sessionSecret)
+}
+
+// CSRFToken returns the token the request's pages must send with writes, ""
+// when the request is not from a browser session
+func CSRFToken(r *http.Request) string {
+	if id := FromRequest(r); id != nil {
+		return id.csrf
+	}
+	return ""
+}
+
+// checkCSRF reports whether a write may go ahead: it did not come from a
+// session, or carries the session's CSRF token
+func checkCSRF(r *http.Request, id *Identity) bool {
+	if id.csrf == "" {
+		return true
+	}
+	sent := r.Header.Get(CSRFHeader)
+	if sent == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		sent = r.PostFormValue(CSRFField)
+	}
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(id.csrf)) == 1
+}
+
+// CORS applies the cross-origin policy in front of every route. Requests
+// from the server's own pages pass through. Pages on other origins (a
+// publisher or bundler artifact opened from file://, which sends Origin
+// "null") may call /api/* only if their origin is in AllowedOrigins; for
+// those, preflights are answered and responses carry CORS headers. Cookies
+// are never allowed cross-origin, so such pages authenticate with a bearer
+// token. Writes from any other origin are refused even when authentication
+// is off, so a web page the user visits cannot post to the library.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		api := strings.HasPrefix(r.URL.Path, "/api/")
+		allowed := api && originAllowed(origin)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				log.Printf("🚫 Refused cross-origin preflight for %s from %s", r.URL.Path, origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Add("Vary", "Origin")
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, Last-Event-ID")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+		} else if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			log.Printf("🚫 Refused cross-origin %s %s from %s", r.Method, r.URL.Path, origin)
+			http.Error(w, "Cross-origin request refused", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin reports whether origin is the host the request was sent to
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// originAllowed reports whether origin is in the configured allowed list
+func originAllowed(origin string) bool {
+	for _, o := range options.AllowedOrigins {
+		if o == "*" || strings.EqualFold(strings.TrimRight(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
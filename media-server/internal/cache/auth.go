@@ -0,0 +1,380 @@
+package cache
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// authSchema holds local user accounts, browser sessions, API tokens and the
+// audit log (schema version 9). Sessions and tokens are stored as SHA-256
+// hashes of the secret, so a copy of the database cannot be used to log in.
+const authSchema = `
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    role TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL DEFAULT 0,
+    last_used_at INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    at INTEGER NOT NULL,
+    user TEXT NOT NULL,
+    role TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL,
+    remote TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log(at);
+`
+
+// Account errors reported to API callers
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrUserExists    = errors.New("user already exists")
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// User is a local account. Role is one of the auth package's roles.
+type User struct {
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+	PasswordHash string    `json:"-"`
+}
+
+// APIToken describes a bearer token; the secret itself is only shown once,
+// when it is created. A zero ExpiresAt never expires. A Scope other than ""
+// limits the token's writes to one group of routes (schema version 10).
+type APIToken struct {
+	ID         int64     `json:"id"`
+	User       string    `json:"user"`
+	Name       string    `json:"name"`
+	Role       string    `json:"role"`
+	Scope      string    `json:"scope,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// AuditEntry records one request that changed something, or was refused
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Role   string    `json:"role"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Detail string    `json:"detail,omitempty"` // Request body, passwords removed
+	Status int       `json:"status"`
+	Remote string    `json:"remote,omitempty"`
+}
+
+// unixTime converts a stored timestamp, 0 meaning unset
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// UserCount returns the number of user accounts
+func (c *Cache) UserCount() (int, error) {
+	var n int
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&n)
+	return n, err
+}
+
+// Users returns every account, sorted by name
+func (c *Cache) Users() ([]User, error) {
+	rows, err := c.db.Query(`SELECT name, role, created_at FROM users ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var u User
+		var created int64
+		if err := rows.Scan(&u.Name, &u.Role, &created); err != nil {
+			return nil, err
+		}
+		u.CreatedAt = time.Unix(created, 0)
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetUser returns an account with its password hash
+func (c *Cache) GetUser(name string) (*User, error) {
+	var u User
+	var created int64
+	err := c.db.QueryRow(`SELECT name, role, password_hash, created_at FROM users WHERE name = ?`, name).
+		Scan(&u.Name, &u.Role, &u.PasswordHash, &created)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.CreatedAt = time.Unix(created, 0)
+	return &u, nil
+}
+
+// CreateUser adds an account
+func (c *Cache) CreateUser(name, passwordHash, role string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("user name is required")
+	}
+	_, err := c.db.Exec(`INSERT INTO users (name, password_hash, role, created_at) VALUES (?, ?, ?, ?)`,
+		name, passwordHash, role, time.Now().Unix())
+	if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+		return ErrUserExists
+	}
+	return err
+}
+
+// SetUserPassword replaces an account's password hash and ends its sessions
+func (c *Cache) SetUserPassword(name, passwordHash string) error {
+	return c.editUser(name, `UPDATE users SET password_hash = ? WHERE name = ?`, passwordHash,
+		`DELETE FROM sessions WHERE user_id = (SELECT id FROM users WHERE name = ?)`)
+}
+
+// SetUserRole changes an account's role. Tokens keep theirs but never act
+// above the user's current role.
+func (c *Cache) SetUserRole(name, role string) error {
+	return c.editUser(name, `UPDATE users SET role = ? WHERE name = ?`, role, "")
+}
+
+// editUser runs an update of one account, then an optional follow-up
+// statement taking the name, in a transaction
+func (c *Cache) editUser(name, update, value, followUp string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(update, value, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	if followUp != "" {
+		if _, err := tx.Exec(followUp, name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteUser removes an account with its sessions and tokens (audit entries stay)
+func (c *Cache) DeleteUser(name string) error {
+	res, err := c.db.Exec(`DELETE FROM users WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CreateSession stores a browser session for a user
+func (c *Cache) CreateSession(tokenHash, user string, expires time.Time) error {
+	res, err := c.db.Exec(`
+		INSERT INTO sessions (token_hash, user_id, created_at, expires_at)
+		SELECT ?, id, ?, ? FROM users WHERE name = ?
+	`, tokenHash, time.Now().Unix(), expires.Unix(), user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SessionUser returns the account of an unexpired session
+func (c *Cache) SessionUser(tokenHash string) (*User, error) {
+	var u User
+	var created int64
+	err := c.db.QueryRow(`
+		SELECT u.name, u.role, u.created_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND s.expires_at > ?
+	`, tokenHash, time.Now().Unix()).Scan(&u.Name, &u.Role, &created)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.CreatedAt = time.Unix(created, 0)
+	return &u, nil
+}
+
+// DeleteSession ends a browser session
+func (c *Cache) DeleteSession(tokenHash string) error {
+	_, err := c.db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions past their expiry
+func (c *Cache) DeleteExpiredSessions() (int64, error) {
+	res, err := c.db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CreateAPIToken stores a bearer token for a user and returns its id
+func (c *Cache) CreateAPIToken(user, name, tokenHash, role, scope string, expires time.Time) (int64, error) {
+	var expiresAt int64
+	if !expires.IsZero() {
+		expiresAt = expires.Unix()
+	}
+	res, err := c.db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_hash, role, scope, created_at, expires_at)
+		SELECT id, ?, ?, ?, ?, ?, ? FROM users WHERE name = ?
+	`, name, tokenHash, role, scope, time.Now().Unix(), expiresAt, user)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, ErrUserNotFound
+	}
+	return res.LastInsertId()
+}
+
+// TokenUser returns an unexpired token with its account, and records its use
+func (c *Cache) TokenUser(tokenHash string) (*User, *APIToken, error) {
+	var u User
+	var t APIToken
+	var userCreated, created, expires, lastUsed int64
+	err := c.db.QueryRow(`
+		SELECT u.name, u.role, u.created_at, t.id, t.name, t.role, t.scope, t.created_at, t.expires_at, t.last_used_at
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND (t.expires_at = 0 OR t.expires_at > ?)
+	`, tokenHash, time.Now().Unix()).Scan(&u.Name, &u.Role, &userCreated, &t.ID, &t.Name, &t.Role, &t.Scope, &created, &expires, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	u.CreatedAt = time.Unix(userCreated, 0)
+	t.User = u.Name
+	t.CreatedAt, t.ExpiresAt, t.LastUsedAt = time.Unix(created, 0), unixTime(expires), unixTime(lastUsed)
+
+	// Record use at most once a minute, so busy scripts do not write on every request
+	now := time.Now()
+	if now.Sub(t.LastUsedAt) > time.Minute {
+		c.db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now.Unix(), t.ID)
+	}
+	return &u, &t, nil
+}
+
+// APITokens lists a user's tokens, or every token when user is empty
+func (c *Cache) APITokens(user string) ([]APIToken, error) {
+	rows, err := c.db.Query(`
+		SELECT t.id, u.name, t.name, t.role, t.scope, t.created_at, t.expires_at, t.last_used_at
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE ? = '' OR u.name = ?
+		ORDER BY t.id
+	`, user, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var created, expires, lastUsed int64
+		if err := rows.Scan(&t.ID, &t.User, &t.Name, &t.Role, &t.Scope, &created, &expires, &lastUsed); err != nil {
+			return nil, err
+		}
+		t.CreatedAt, t.ExpiresAt, t.LastUsedAt = time.Unix(created, 0), unixTime(expires), unixTime(lastUsed)
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken deletes a token; with user set, only that user's token
+func (c *Cache) RevokeAPIToken(id int64, user string) error {
+	res, err := c.db.Exec(`
+		DELETE FROM api_tokens
+		WHERE id = ? AND (? = '' OR user_id = (SELECT id FROM users WHERE name = ?))
+	`, id, user, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// AddAuditEntry appends to the audit log
+func (c *Cache) AddAuditEntry(e AuditEntry) error {
+	_, err := c.db.Exec(`
+		INSERT INTO audit_log (at, user, role, method, path, detail, status, remote)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.Time.Unix(), e.User, e.Role, e.Method, e.Path, e.Detail, e.Status, e.Remote)
+	return err
+}
+
+// AuditLog returns the newest entries first, optionally for one user
+func (c *Cache) AuditLog(limit int, user string) ([]AuditEntry, error) {
+	rows, err := c.db.Query(`
+		SELECT at, user, role, method, path, detail, status, remote
+		FROM audit_log
+		WHERE ? = '' OR user = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, user, user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var at int64
+		if err := rows.Scan(&at, &e.User, &e.Role, &e.Method, &e.Path, &e.Detail, &e.Status, &e.Remote); err != nil {
+			return nil, err
+		}
+		e.Time = time.Unix(at, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,70 @@
+//go:build cgo
+
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// backupStepPages and backupStepPause pace the online backup: each step copies
+// a few pages, and the pause between steps lets writers take the lock
+const (
+	backupStepPages = 256
+	backupStepPause = 10 * time.Millisecond
+)
+
+// onlineBackup copies the main database of src into a new file at dest
+func onlineBackup(src *sql.DB, dest string) error {
+	ctx := context.Background()
+
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			destSQLite, ok := destRaw.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("unexpected driver connection type")
+			}
+
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			// Copy in steps, pausing between them so writers are only blocked briefly
+			for {
+				done, err := backup.Step(backupStepPages)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				time.Sleep(backupStepPause)
+			}
+			return backup.Finish()
+		})
+	})
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/tdsanchez/PostMac/internal/library"
 	"github.com/tdsanchez/PostMac/internal/models"
 )
 
+// schema is the original (version 1) cache layout; later changes are migrations
 const schema = `
 CREATE TABLE IF NOT EXISTS files (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -49,6 +52,7 @@ CREATE TABLE IF NOT EXISTS scan_metadata (
 );
 `
 
+// mlSchema is the original (version 1) ML training layout
 const mlSchema = `
 CREATE TABLE IF NOT EXISTS date_decisions (
     rel_path TEXT PRIMARY KEY,
@@ -72,69 +76,270 @@ CREATE TABLE IF NOT EXISTS date_decisions (
 CREATE INDEX IF NOT EXISTS idx_date_decisions_decision ON date_decisions(decision);
 `
 
+// fileColumns is the column list shared by every files-table read (see scanFileRow)
+const fileColumns = `id, abs_path, name, size_bytes, mtime_ns, created, comment,
+		       os_mod_time, os_birth_time, exif_create_date, exif_modify_date,
+		       earliest_date, needs_date_correction, large_discrepancy,
+		       inode, device, content_hash, volume,
+		       latitude, longitude, altitude, timezone_mismatch,
+		       rating, color_label`
+
+// fileInsertColumns is the column list written by every files-table insert (see fileValues)
+const fileInsertColumns = `abs_path, name, size_bytes, mtime_ns, created, comment,
+		                   os_mod_time, os_birth_time, exif_create_date, exif_modify_date,
+		                   earliest_date, needs_date_correction, large_discrepancy,
+		                   inode, device, content_hash, volume,
+		                   latitude, longitude, altitude, timezone_mismatch,
+		                   rating, color_label`
+
+const fileInsertPlaceholders = `?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?`
+
 type Cache struct {
-	db   *sql.DB
-	mlDB *sql.DB
+	db         *sql.DB
+	mlDB       *sql.DB
+	textDB     *sql.DB // nil without FTS5 (see openTextIndex)
+	dbPath     string
+	mlDBPath   string
+	textDBPath string
 }
 
-// New creates or opens a port-isolated cache database in ~/.media-server-conf/
-// Each port gets its own cache-PORT.db, preventing data stomping when multiple
-// instances share the host.
-func New(port string) (*Cache, error) {
+// Paths returns the cache and ML database paths for a port in ~/.media-server-conf/,
+// creating the directory if needed
+func Paths(port string) (dbPath, mlDBPath string, err error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return "", "", fmt.Errorf("failed to get home directory: %w", err)
 	}
 
 	confDir := filepath.Join(homeDir, ".media-server-conf")
 	if err := os.MkdirAll(confDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create conf directory: %w", err)
+		return "", "", fmt.Errorf("failed to create conf directory: %w", err)
 	}
 
 	dbName := "cache.db"
+	mlDBName := "ml-training.db"
 	if port != "" {
 		dbName = "cache-" + port + ".db"
+		mlDBName = "ml-training-" + port + ".db"
 	}
-	dbPath := filepath.Join(confDir, dbName)
+	return filepath.Join(confDir, dbName), filepath.Join(confDir, mlDBName), nil
+}
+
+// New creates or opens a port-isolated cache database in ~/.media-server-conf/
+// Each port gets its own cache-PORT.db, preventing data stomping when multiple
+// instances share the host.
+func New(port string) (*Cache, error) {
+	dbPath, mlDBPath, err := Paths(port)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := sql.Open("sqlite3", dbPath+"?cache=shared&mode=rwc&_journal_mode=WAL&_foreign_keys=on")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Create schema
-	if _, err := db.Exec(schema); err != nil {
+	// Bring the schema up to date (backs up the file first if it changes)
+	if err := migrate(db, dbPath, cacheMigrations); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create schema: %w", err)
+		return nil, err
 	}
 
-	mlDBName := "ml-training.db"
-	if port != "" {
-		mlDBName = "ml-training-" + port + ".db"
-	}
-	mlDBPath := filepath.Join(confDir, mlDBName)
 	mlDB, err := sql.Open("sqlite3", mlDBPath+"?cache=shared&mode=rwc&_journal_mode=WAL")
 	if err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to open ML database: %w", err)
 	}
 
-	// Create ML schema
-	if _, err := mlDB.Exec(mlSchema); err != nil {
+	if err := migrate(mlDB, mlDBPath, mlMigrations); err != nil {
+		db.Close()
+		mlDB.Close()
+		return nil, err
+	}
+
+	textDB, textDBPath, err := openTextIndex(dbPath)
+	if err != nil {
 		db.Close()
 		mlDB.Close()
-		return nil, fmt.Errorf("failed to create ML schema: %w", err)
+		return nil, err
 	}
 
 	return &Cache{
-		db:   db,
-		mlDB: mlDB,
+		db:         db,
+		mlDB:       mlDB,
+		textDB:     textDB,
+		dbPath:     dbPath,
+		mlDBPath:   mlDBPath,
+		textDBPath: textDBPath,
 	}, nil
 }
 
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanFileRow reads one files-table row selected with fileColumns
+func scanFileRow(row rowScanner) (int64, models.FileInfo, error) {
+	var id int64
+	var file models.FileInfo
+	var mtimeNs int64
+	var created int64
+	var comment sql.NullString
+	var osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate sql.NullInt64
+	var needsDateCorrection, largeDiscrepancy, timezoneMismatch sql.NullInt64
+	var inode, device sql.NullInt64
+	var contentHash, volume sql.NullString
+	var latitude, longitude, altitude sql.NullFloat64
+	var rating sql.NullInt64
+	var colorLabel sql.NullString
+
+	err := row.Scan(&id, &file.Path, &file.Name, &file.Size, &mtimeNs, &created, &comment,
+		&osModTime, &osBirthTime, &exifCreateDate, &exifModifyDate,
+		&earliestDate, &needsDateCorrection, &largeDiscrepancy,
+		&inode, &device, &contentHash, &volume,
+		&latitude, &longitude, &altitude, &timezoneMismatch,
+		&rating, &colorLabel)
+	if err != nil {
+		return 0, file, err
+	}
+
+	file.Created = time.Unix(created, 0)
+	if comment.Valid {
+		file.Comment = comment.String
+	}
+
+	// Load date analysis fields (mtime_ns keeps full precision, so a loaded
+	// row compares equal to a fresh scan of an unchanged file)
+	if mtimeNs != 0 {
+		file.OSModTime = time.Unix(0, mtimeNs)
+	} else if osModTime.Valid {
+		file.OSModTime = time.Unix(osModTime.Int64, 0)
+	}
+	if osBirthTime.Valid {
+		file.OSBirthTime = time.Unix(osBirthTime.Int64, 0)
+	}
+	if exifCreateDate.Valid {
+		file.EXIFCreateDate = time.Unix(exifCreateDate.Int64, 0)
+	}
+	if exifModifyDate.Valid {
+		file.EXIFModifyDate = time.Unix(exifModifyDate.Int64, 0)
+	}
+	if earliestDate.Valid {
+		file.EarliestDate = time.Unix(earliestDate.Int64, 0)
+	}
+	if needsDateCorrection.Valid {
+		file.NeedsDateCorrection = needsDateCorrection.Int64 == 1
+	}
+	if largeDiscrepancy.Valid {
+		file.LargeDiscrepancy = largeDiscrepancy.Int64 == 1
+	}
+	if timezoneMismatch.Valid {
+		file.TimezoneMismatch = timezoneMismatch.Int64 == 1
+	}
+
+	// Load identity fields (move detection)
+	if inode.Valid {
+		file.Inode = uint64(inode.Int64)
+	}
+	if device.Valid {
+		file.Device = uint64(device.Int64)
+	}
+	if contentHash.Valid {
+		file.ContentHash = contentHash.String
+	}
+	if volume.Valid {
+		file.Volume = volume.String
+	}
+
+	// Load GPS location
+	if latitude.Valid && longitude.Valid {
+		file.Location = &models.GeoLocation{Latitude: latitude.Float64, Longitude: longitude.Float64}
+		if altitude.Valid {
+			file.Location.Altitude = altitude.Float64
+			file.Location.HasAltitude = true
+		}
+	}
+
+	// Load curation fields
+	if rating.Valid {
+		file.Rating = int(rating.Int64)
+	}
+	if colorLabel.Valid {
+		file.ColorLabel = colorLabel.String
+	}
+
+	return id, file, nil
+}
+
+// fileValues returns the insert arguments matching fileInsertColumns
+func fileValues(f models.FileInfo) []interface{} {
+	// Convert date analysis fields to nullable integers
+	var osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate sql.NullInt64
+	var needsDateCorrection, largeDiscrepancy, timezoneMismatch int64
+
+	if !f.OSModTime.IsZero() {
+		osModTime = sql.NullInt64{Int64: f.OSModTime.Unix(), Valid: true}
+	}
+	if !f.OSBirthTime.IsZero() {
+		osBirthTime = sql.NullInt64{Int64: f.OSBirthTime.Unix(), Valid: true}
+	}
+	if !f.EXIFCreateDate.IsZero() {
+		exifCreateDate = sql.NullInt64{Int64: f.EXIFCreateDate.Unix(), Valid: true}
+	}
+	if !f.EXIFModifyDate.IsZero() {
+		exifModifyDate = sql.NullInt64{Int64: f.EXIFModifyDate.Unix(), Valid: true}
+	}
+	if !f.EarliestDate.IsZero() {
+		earliestDate = sql.NullInt64{Int64: f.EarliestDate.Unix(), Valid: true}
+	}
+	if f.NeedsDateCorrection {
+		needsDateCorrection = 1
+	}
+	if f.LargeDiscrepancy {
+		largeDiscrepancy = 1
+	}
+	if f.TimezoneMismatch {
+		timezoneMismatch = 1
+	}
+
+	var inode, device sql.NullInt64
+	if f.Inode != 0 {
+		inode = sql.NullInt64{Int64: int64(f.Inode), Valid: true}
+		device = sql.NullInt64{Int64: int64(f.Device), Valid: true}
+	}
+	var contentHash sql.NullString
+	if f.ContentHash != "" {
+		contentHash = sql.NullString{String: f.ContentHash, Valid: true}
+	}
+
+	var latitude, longitude, altitude sql.NullFloat64
+	if f.Location != nil {
+		latitude = sql.NullFloat64{Float64: f.Location.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: f.Location.Longitude, Valid: true}
+		altitude = sql.NullFloat64{Float64: f.Location.Altitude, Valid: f.Location.HasAltitude}
+	}
+
+	// Get mtime in nanoseconds for freshness check
+	mtimeNs := f.OSModTime.UnixNano()
+
+	return []interface{}{
+		f.Path, f.Name, f.Size, mtimeNs, f.Created.Unix(), f.Comment,
+		osModTime, osBirthTime, exifCreateDate, exifModifyDate,
+		earliestDate, needsDateCorrection, largeDiscrepancy,
+		inode, device, contentHash, f.Volume,
+		latitude, longitude, altitude, timezoneMismatch,
+		f.Rating, f.ColorLabel,
+	}
+}
+
 // Close closes the database connections
 func (c *Cache) Close() error {
 	err1 := c.db.Close()
 	err2 := c.mlDB.Close()
+	if c.textDB != nil {
+		c.textDB.Close()
+	}
 	if err1 != nil {
 		return err1
 	}
@@ -165,9 +370,7 @@ func (c *Cache) GetScanMetadata() (lastScan time.Time, totalFiles int, totalTags
 // LoadFiles loads all files and their tags from the cache
 func (c *Cache) LoadFiles() ([]models.FileInfo, error) {
 	rows, err := c.db.Query(`
-		SELECT id, abs_path, name, size_bytes, mtime_ns, created, comment,
-		       os_mod_time, os_birth_time, exif_create_date, exif_modify_date,
-		       earliest_date, needs_date_correction, large_discrepancy
+		SELECT ` + fileColumns + `
 		FROM files
 		ORDER BY abs_path
 	`)
@@ -180,49 +383,11 @@ func (c *Cache) LoadFiles() ([]models.FileInfo, error) {
 	fileOrder := []int64{} // Track insertion order
 
 	for rows.Next() {
-		var id int64
-		var file models.FileInfo
-		var mtimeNs int64
-		var created int64
-		var comment sql.NullString
-		var osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate sql.NullInt64
-		var needsDateCorrection, largeDiscrepancy sql.NullInt64
-
-		err := rows.Scan(&id, &file.Path, &file.Name, &file.Size, &mtimeNs, &created, &comment,
-			&osModTime, &osBirthTime, &exifCreateDate, &exifModifyDate,
-			&earliestDate, &needsDateCorrection, &largeDiscrepancy)
+		id, file, err := scanFileRow(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		file.Created = time.Unix(created, 0)
-		if comment.Valid {
-			file.Comment = comment.String
-		}
-
-		// Load date analysis fields
-		if osModTime.Valid {
-			file.OSModTime = time.Unix(osModTime.Int64, 0)
-		}
-		if osBirthTime.Valid {
-			file.OSBirthTime = time.Unix(osBirthTime.Int64, 0)
-		}
-		if exifCreateDate.Valid {
-			file.EXIFCreateDate = time.Unix(exifCreateDate.Int64, 0)
-		}
-		if exifModifyDate.Valid {
-			file.EXIFModifyDate = time.Unix(exifModifyDate.Int64, 0)
-		}
-		if earliestDate.Valid {
-			file.EarliestDate = time.Unix(earliestDate.Int64, 0)
-		}
-		if needsDateCorrection.Valid {
-			file.NeedsDateCorrection = needsDateCorrection.Int64 == 1
-		}
-		if largeDiscrepancy.Valid {
-			file.LargeDiscrepancy = largeDiscrepancy.Int64 == 1
-		}
-
 		file.Tags = []string{} // Will be populated below
 
 		fileMap[id] = &file
@@ -264,125 +429,23 @@ func (c *Cache) LoadFiles() ([]models.FileInfo, error) {
 	return files, nil
 }
 
-// SaveFiles saves all files and their tags to the cache
-func (c *Cache) SaveFiles(files []models.FileInfo, totalTags int) error {
-	tx, err := c.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// Clear existing data
-	if _, err := tx.Exec("DELETE FROM tags"); err != nil {
-		return err
-	}
-	if _, err := tx.Exec("DELETE FROM files"); err != nil {
-		return err
-	}
-
-	// Prepare statements
-	fileStmt, err := tx.Prepare(`
-		INSERT INTO files (abs_path, name, size_bytes, mtime_ns, created, comment,
-		                   os_mod_time, os_birth_time, exif_create_date, exif_modify_date,
-		                   earliest_date, needs_date_correction, large_discrepancy)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`)
-	if err != nil {
-		return err
-	}
-	defer fileStmt.Close()
-
-	tagStmt, err := tx.Prepare(`
-		INSERT INTO tags (file_id, tag_name)
-		VALUES (?, ?)
-	`)
-	if err != nil {
-		return err
-	}
-	defer tagStmt.Close()
-
-	// Insert files and tags
-	for _, file := range files {
-		// Convert date analysis fields to nullable integers
-		var osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate sql.NullInt64
-		var needsDateCorrection int64
-
-		if !file.OSModTime.IsZero() {
-			osModTime = sql.NullInt64{Int64: file.OSModTime.Unix(), Valid: true}
-		}
-		if !file.OSBirthTime.IsZero() {
-			osBirthTime = sql.NullInt64{Int64: file.OSBirthTime.Unix(), Valid: true}
-		}
-		if !file.EXIFCreateDate.IsZero() {
-			exifCreateDate = sql.NullInt64{Int64: file.EXIFCreateDate.Unix(), Valid: true}
-		}
-		if !file.EXIFModifyDate.IsZero() {
-			exifModifyDate = sql.NullInt64{Int64: file.EXIFModifyDate.Unix(), Valid: true}
-		}
-		if !file.EarliestDate.IsZero() {
-			earliestDate = sql.NullInt64{Int64: file.EarliestDate.Unix(), Valid: true}
-		}
-		if file.NeedsDateCorrection {
-			needsDateCorrection = 1
-		}
-
-		var largeDiscrepancy int64
-		if file.LargeDiscrepancy {
-			largeDiscrepancy = 1
-		}
-
-		// Get mtime in nanoseconds for freshness check
-		mtimeNs := file.OSModTime.UnixNano()
-
-		result, err := fileStmt.Exec(
-			file.Path,
-			file.Name,
-			file.Size,
-			mtimeNs,
-			file.Created.Unix(),
-			file.Comment,
-			osModTime,
-			osBirthTime,
-			exifCreateDate,
-			exifModifyDate,
-			earliestDate,
-			needsDateCorrection,
-			largeDiscrepancy,
-		)
-		if err != nil {
-			return err
-		}
-
-		fileID, err := result.LastInsertId()
-		if err != nil {
-			return err
-		}
-
-		// Insert tags for this file
-		for _, tag := range file.Tags {
-			if _, err := tagStmt.Exec(fileID, tag); err != nil {
-				return err
-			}
-		}
-	}
-
-	// Update scan metadata
-	_, err = tx.Exec(`
-		INSERT OR REPLACE INTO scan_metadata (id, last_scan_time, total_files, total_tags)
-		VALUES (1, ?, ?, ?)
-	`, time.Now().Unix(), len(files), totalTags)
+// UpdateFileComment updates a file's comment in the cache
+func (c *Cache) UpdateFileComment(absPath, comment string) error {
+	_, err := c.db.Exec(`
+		UPDATE files SET comment = ? WHERE abs_path = ?
+	`, comment, absPath)
 	if err != nil {
 		return err
 	}
-
-	return tx.Commit()
+	c.textIndexComment(absPath, comment)
+	return nil
 }
 
-// UpdateFileComment updates a file's comment in the cache
-func (c *Cache) UpdateFileComment(absPath, comment string) error {
+// UpdateFileRating updates a file's star rating and color label in the cache
+func (c *Cache) UpdateFileRating(absPath string, rating int, label string) error {
 	_, err := c.db.Exec(`
-		UPDATE files SET comment = ? WHERE abs_path = ?
-	`, comment, absPath)
+		UPDATE files SET rating = ?, color_label = ? WHERE abs_path = ?
+	`, rating, label, absPath)
 	return err
 }
 
@@ -425,132 +488,160 @@ func (c *Cache) UpdateFileTags(absPath string, tags []string) error {
 // DeleteFile removes a file from the cache
 func (c *Cache) DeleteFile(absPath string) error {
 	// Tags are automatically deleted via CASCADE foreign key constraint
-	_, err := c.db.Exec("DELETE FROM files WHERE abs_path = ?", absPath)
-	return err
+	if _, err := c.db.Exec("DELETE FROM files WHERE abs_path = ?", absPath); err != nil {
+		return err
+	}
+	c.textIndexDelete(absPath)
+	return nil
 }
 
-// UpsertFile inserts or updates a file in the cache
-func (c *Cache) UpsertFile(f models.FileInfo) error {
+// RelocatePath re-keys a file's rows from oldPath to newPath, keeping its id,
+// tags and date decision. Any row already at newPath is replaced.
+func (c *Cache) RelocatePath(oldPath, newPath string) error {
 	tx, err := c.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Convert date analysis fields to nullable integers
-	var osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate sql.NullInt64
-	var needsDateCorrection int64
+	if _, err := tx.Exec("DELETE FROM files WHERE abs_path = ?", newPath); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE files SET abs_path = ?, name = ?, volume = ? WHERE abs_path = ?",
+		newPath, filepath.Base(newPath), library.VolumeRoot(newPath), oldPath); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.textIndexRelocate(oldPath, newPath, false)
 
-	if !f.OSModTime.IsZero() {
-		osModTime = sql.NullInt64{Int64: f.OSModTime.Unix(), Valid: true}
+	// date_decisions is keyed by absolute path in the ML database
+	_, err = c.mlDB.Exec("UPDATE OR REPLACE date_decisions SET rel_path = ? WHERE rel_path = ?", newPath, oldPath)
+	return err
+}
+
+// RelocatePrefix rewrites every path under oldPrefix to live under newPrefix,
+// in both the files table and date_decisions. Used when a volume is mounted at a
+// new location. Rows already present at a rewritten path are replaced. Both
+// prefixes must be absolute; relocating a prefix onto itself does nothing.
+func (c *Cache) RelocatePrefix(oldPrefix, newPrefix string) (files int, decisions int, err error) {
+	oldPrefix = filepath.Clean(oldPrefix)
+	newPrefix = filepath.Clean(newPrefix)
+	if !filepath.IsAbs(oldPrefix) || !filepath.IsAbs(newPrefix) {
+		return 0, 0, fmt.Errorf("relocation prefixes must be absolute paths")
 	}
-	if !f.OSBirthTime.IsZero() {
-		osBirthTime = sql.NullInt64{Int64: f.OSBirthTime.Unix(), Valid: true}
+	if oldPrefix == newPrefix {
+		return 0, 0, nil
 	}
-	if !f.EXIFCreateDate.IsZero() {
-		exifCreateDate = sql.NullInt64{Int64: f.EXIFCreateDate.Unix(), Valid: true}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, 0, err
 	}
-	if !f.EXIFModifyDate.IsZero() {
-		exifModifyDate = sql.NullInt64{Int64: f.EXIFModifyDate.Unix(), Valid: true}
+	defer tx.Rollback()
+
+	paths, err := pathsUnder(tx, "SELECT abs_path FROM files", "abs_path", oldPrefix)
+	if err != nil {
+		return 0, 0, err
 	}
-	if !f.EarliestDate.IsZero() {
-		earliestDate = sql.NullInt64{Int64: f.EarliestDate.Unix(), Valid: true}
+	for _, oldPath := range paths {
+		newPath := newPrefix + strings.TrimPrefix(oldPath, oldPrefix)
+		if _, err := tx.Exec("DELETE FROM files WHERE abs_path = ?", newPath); err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.Exec("UPDATE files SET abs_path = ?, volume = ? WHERE abs_path = ?",
+			newPath, library.VolumeRoot(newPath), oldPath); err != nil {
+			return 0, 0, err
+		}
 	}
-	if f.NeedsDateCorrection {
-		needsDateCorrection = 1
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
 	}
+	c.textIndexRelocate(oldPrefix, newPrefix, true)
 
-	var largeDiscrepancy int64
-	if f.LargeDiscrepancy {
-		largeDiscrepancy = 1
+	mlTx, err := c.mlDB.Begin()
+	if err != nil {
+		return len(paths), 0, err
 	}
+	defer mlTx.Rollback()
 
-	mtimeNs := f.OSModTime.UnixNano()
+	decisionPaths, err := pathsUnder(mlTx, "SELECT rel_path FROM date_decisions", "rel_path", oldPrefix)
+	if err != nil {
+		return len(paths), 0, err
+	}
+	for _, oldPath := range decisionPaths {
+		newPath := newPrefix + strings.TrimPrefix(oldPath, oldPrefix)
+		if _, err := mlTx.Exec("UPDATE OR REPLACE date_decisions SET rel_path = ? WHERE rel_path = ?", newPath, oldPath); err != nil {
+			return len(paths), 0, err
+		}
+	}
+	if err := mlTx.Commit(); err != nil {
+		return len(paths), 0, err
+	}
 
-	// Insert or replace file
-	result, err := tx.Exec(`
-		INSERT OR REPLACE INTO files (abs_path, name, size_bytes, mtime_ns, created, comment,
-		                              os_mod_time, os_birth_time, exif_create_date, exif_modify_date,
-		                              earliest_date, needs_date_correction, large_discrepancy)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, f.Path, f.Name, f.Size, mtimeNs, f.Created.Unix(), f.Comment,
-		osModTime, osBirthTime, exifCreateDate, exifModifyDate,
-		earliestDate, needsDateCorrection, largeDiscrepancy)
+	return len(paths), len(decisionPaths), nil
+}
+
+// pathsUnder returns the values of column equal to prefix or below prefix + "/".
+// The range comparison is bytewise, so it is exact for any UTF-8 path.
+func pathsUnder(tx *sql.Tx, selectSQL, column, prefix string) ([]string, error) {
+	rows, err := tx.Query(selectSQL+" WHERE "+column+" = ? OR ("+column+" >= ? AND "+column+" < ?)",
+		prefix, prefix+"/", prefix+"0") // '0' sorts immediately after '/'
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	fileID, err := result.LastInsertId()
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// UpsertFile inserts or updates a file in the cache
+func (c *Cache) UpsertFile(f models.FileInfo) error {
+	tx, err := c.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// Delete existing tags and insert new ones
-	if _, err := tx.Exec("DELETE FROM tags WHERE file_id = ?", fileID); err != nil {
+	// Insert or update in place so the row keeps its id
+	var fileID int64
+	if err := tx.QueryRow(fileUpsertSQL, fileValues(f)...).Scan(&fileID); err != nil {
 		return err
 	}
 
-	for _, tag := range f.Tags {
-		if _, err := tx.Exec("INSERT INTO tags (file_id, tag_name) VALUES (?, ?)", fileID, tag); err != nil {
-			return err
-		}
+	if err := replaceTags(tx, fileID, f.Tags); err != nil {
+		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.textIndexFile(f)
+	return nil
 }
 
 // GetFile retrieves a file by its absolute path
 func (c *Cache) GetFile(absPath string) *models.FileInfo {
 	row := c.db.QueryRow(`
-		SELECT id, abs_path, name, size_bytes, mtime_ns, created, comment,
-		       os_mod_time, os_birth_time, exif_create_date, exif_modify_date,
-		       earliest_date, needs_date_correction, large_discrepancy
+		SELECT `+fileColumns+`
 		FROM files
 		WHERE abs_path = ?
 	`, absPath)
 
-	var id int64
-	var file models.FileInfo
-	var mtimeNs int64
-	var created int64
-	var comment sql.NullString
-	var osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate sql.NullInt64
-	var needsDateCorrection, largeDiscrepancy sql.NullInt64
-
-	err := row.Scan(&id, &file.Path, &file.Name, &file.Size, &mtimeNs, &created, &comment,
-		&osModTime, &osBirthTime, &exifCreateDate, &exifModifyDate,
-		&earliestDate, &needsDateCorrection, &largeDiscrepancy)
+	id, file, err := scanFileRow(row)
 	if err != nil {
 		return nil
 	}
 
-	file.Created = time.Unix(created, 0)
-	if comment.Valid {
-		file.Comment = comment.String
-	}
-
-	if osModTime.Valid {
-		file.OSModTime = time.Unix(osModTime.Int64, 0)
-	}
-	if osBirthTime.Valid {
-		file.OSBirthTime = time.Unix(osBirthTime.Int64, 0)
-	}
-	if exifCreateDate.Valid {
-		file.EXIFCreateDate = time.Unix(exifCreateDate.Int64, 0)
-	}
-	if exifModifyDate.Valid {
-		file.EXIFModifyDate = time.Unix(exifModifyDate.Int64, 0)
-	}
-	if earliestDate.Valid {
-		file.EarliestDate = time.Unix(earliestDate.Int64, 0)
-	}
-	if needsDateCorrection.Valid {
-		file.NeedsDateCorrection = needsDateCorrection.Int64 == 1
-	}
-	if largeDiscrepancy.Valid {
-		file.LargeDiscrepancy = largeDiscrepancy.Int64 == 1
-	}
-
 	// Load tags
 	tagRows, err := c.db.Query("SELECT tag_name FROM tags WHERE file_id = ?", id)
 	if err != nil {
@@ -568,6 +659,29 @@ func (c *Cache) GetFile(absPath string) *models.FileInfo {
 	return &file
 }
 
+// GetFileIdentity returns the cached mtime of a file and whether its
+// inode/device identity has been recorded (rows from older caches lack it)
+func (c *Cache) GetFileIdentity(absPath string) (mtimeNs int64, hasIdentity bool, ok bool) {
+	var inode sql.NullInt64
+	err := c.db.QueryRow("SELECT mtime_ns, inode FROM files WHERE abs_path = ?", absPath).Scan(&mtimeNs, &inode)
+	if err != nil {
+		return 0, false, false
+	}
+	return mtimeNs, inode.Valid, true
+}
+
+// GetContentHash returns the stored content hash of a file, but only while
+// its size and mtime still match the row (otherwise the hash is stale)
+func (c *Cache) GetContentHash(absPath string, size, mtimeNs int64) (string, bool) {
+	var hash sql.NullString
+	err := c.db.QueryRow("SELECT content_hash FROM files WHERE abs_path = ? AND size_bytes = ? AND mtime_ns = ?",
+		absPath, size, mtimeNs).Scan(&hash)
+	if err != nil || !hash.Valid || hash.String == "" {
+		return "", false
+	}
+	return hash.String, true
+}
+
 // GetFileMtime returns the stored mtime_ns for freshness checking
 func (c *Cache) GetFileMtime(absPath string) (int64, bool) {
 	var mtimeNs int64
@@ -610,6 +724,46 @@ func (c *Cache) GetDateDecision(relPath string) (decision string, exists bool, e
 	return decision, true, nil
 }
 
+// CorrectedDates returns the date the user picked for each file with a
+// use_* decision, keyed by path. Skipped and not_chosen files are omitted.
+func (c *Cache) CorrectedDates() (map[string]time.Time, error) {
+	rows, err := c.mlDB.Query(`
+		SELECT rel_path, decision, os_mod_time, os_birth_time, exif_create_time, exif_modify_time
+		FROM date_decisions
+		WHERE decision LIKE 'use_%'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := make(map[string]time.Time)
+	for rows.Next() {
+		var path, decision string
+		var osMod, osBirth int64
+		var exifCreate, exifModify sql.NullInt64
+		if err := rows.Scan(&path, &decision, &osMod, &osBirth, &exifCreate, &exifModify); err != nil {
+			return nil, err
+		}
+
+		var chosen int64
+		switch decision {
+		case "use_os_mod":
+			chosen = osMod
+		case "use_os_birth":
+			chosen = osBirth
+		case "use_exif_create":
+			chosen = exifCreate.Int64
+		case "use_exif_modify":
+			chosen = exifModify.Int64
+		}
+		if chosen > 0 {
+			dates[path] = time.Unix(chosen, 0)
+		}
+	}
+	return dates, rows.Err()
+}
+
 // DateDecisionStats represents training progress statistics
 type DateDecisionStats struct {
 	TotalDecisions     int
@@ -0,0 +1,90 @@
+package cache
+
+import "time"
+
+// fileChecksSchema holds integrity check results (schema version 6). A result
+// is only valid for the mtime and size it was checked at, so a changed file is
+// checked again; full records whether image data was decoded.
+const fileChecksSchema = `
+CREATE TABLE IF NOT EXISTS file_checks (
+    file_id INTEGER PRIMARY KEY,
+    mtime_ns INTEGER NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    full INTEGER NOT NULL,
+    checked_at INTEGER NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+);
+`
+
+// FileCheck is the integrity check result for one file. Reason is empty when
+// the file checked out intact.
+type FileCheck struct {
+	Path      string
+	MtimeNs   int64
+	Size      int64
+	Reason    string
+	Full      bool // Image data was fully decoded (see metadata.Validate)
+	CheckedAt time.Time
+}
+
+// Current reports whether the check still applies to a file with this mtime
+// and size. A header-only check is stale once full decoding is wanted.
+func (fc FileCheck) Current(mtime time.Time, size int64, full bool) bool {
+	return fc.MtimeNs == mtime.UnixNano() && fc.Size == size && (fc.Full || !full)
+}
+
+// FileChecks returns every stored integrity check result, keyed by path
+func (c *Cache) FileChecks() (map[string]FileCheck, error) {
+	rows, err := c.db.Query(`
+		SELECT f.abs_path, fc.mtime_ns, fc.size_bytes, fc.reason, fc.full, fc.checked_at
+		FROM file_checks fc
+		JOIN files f ON f.id = fc.file_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := make(map[string]FileCheck)
+	for rows.Next() {
+		var fc FileCheck
+		var checkedAt int64
+		if err := rows.Scan(&fc.Path, &fc.MtimeNs, &fc.Size, &fc.Reason, &fc.Full, &checkedAt); err != nil {
+			return nil, err
+		}
+		fc.CheckedAt = time.Unix(checkedAt, 0)
+		checks[fc.Path] = fc
+	}
+	return checks, rows.Err()
+}
+
+// SaveFileChecks stores integrity check results, replacing earlier results for
+// the same files. Paths not in the cache are skipped.
+func (c *Cache) SaveFileChecks(checks []FileCheck) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO file_checks (file_id, mtime_ns, size_bytes, reason, full, checked_at)
+		SELECT id, ?, ?, ?, ?, ? FROM files WHERE abs_path = ?
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, fc := range checks {
+		checkedAt := fc.CheckedAt
+		if checkedAt.IsZero() {
+			checkedAt = time.Now()
+		}
+		if _, err := stmt.Exec(fc.MtimeNs, fc.Size, fc.Reason, fc.Full, checkedAt.Unix(), fc.Path); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
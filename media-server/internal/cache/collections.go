@@ -0,0 +1,294 @@
+package cache
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// collectionsSchema holds named, ordered collections of files (schema version
+// 8). Items reference files by id, so they follow moves and renames and are
+// dropped with the file.
+const collectionsSchema = `
+CREATE TABLE IF NOT EXISTS collections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS collection_items (
+    collection_id INTEGER NOT NULL,
+    file_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (collection_id, file_id),
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_collection_items_order ON collection_items(collection_id, position);
+`
+
+// Collection errors reported to API callers
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrCollectionExists   = errors.New("collection already exists")
+)
+
+// Collection is a named, ordered list of files. An item's note (a caption or
+// review comment) belongs to the collection, not to the file.
+type Collection struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Items       []models.CollectionItem `json:"items"`
+	CreatedAt   time.Time               `json:"createdAt"`
+	UpdatedAt   time.Time               `json:"updatedAt"`
+}
+
+// Collections returns every collection with its items in order, sorted by name
+func (c *Cache) Collections() ([]Collection, error) {
+	rows, err := c.db.Query(`SELECT id, name, description, created_at, updated_at FROM collections ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var collections []Collection
+	byID := make(map[int64]int)
+	for rows.Next() {
+		var id, created, updated int64
+		var col Collection
+		if err := rows.Scan(&id, &col.Name, &col.Description, &created, &updated); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		col.CreatedAt, col.UpdatedAt = time.Unix(created, 0), time.Unix(updated, 0)
+		col.Items = []models.CollectionItem{}
+		byID[id] = len(collections)
+		collections = append(collections, col)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	itemRows, err := c.db.Query(`
+		SELECT ci.collection_id, f.abs_path, ci.note
+		FROM collection_items ci
+		JOIN files f ON f.id = ci.file_id
+		ORDER BY ci.collection_id, ci.position
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var id int64
+		var item models.CollectionItem
+		if err := itemRows.Scan(&id, &item.Path, &item.Note); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[id]; ok {
+			collections[i].Items = append(collections[i].Items, item)
+		}
+	}
+	return collections, itemRows.Err()
+}
+
+// GetCollection returns one collection with its items in order
+func (c *Cache) GetCollection(name string) (*Collection, error) {
+	collections, err := c.Collections()
+	if err != nil {
+		return nil, err
+	}
+	for i := range collections {
+		if collections[i].Name == name {
+			return &collections[i], nil
+		}
+	}
+	return nil, ErrCollectionNotFound
+}
+
+// CreateCollection adds an empty collection
+func (c *Cache) CreateCollection(name, description string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("collection name is required")
+	}
+	now := time.Now().Unix()
+	_, err := c.db.Exec(`INSERT INTO collections (name, description, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		name, description, now, now)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+		return ErrCollectionExists
+	}
+	return err
+}
+
+// DeleteCollection removes a collection and its items (not the files)
+func (c *Cache) DeleteCollection(name string) error {
+	res, err := c.db.Exec(`DELETE FROM collections WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
+
+// AppendCollectionItems adds files to the end of a collection in the given
+// order. Files already in the collection keep their place (and get the new
+// note if one is given). Returns the paths that are not in the cache.
+func (c *Cache) AppendCollectionItems(name string, items []models.CollectionItem) (missing []string, err error) {
+	err = c.editCollection(name, func(tx *sql.Tx, id int64) error {
+		var next int64
+		if err := tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM collection_items WHERE collection_id = ?`, id).Scan(&next); err != nil {
+			return err
+		}
+		for _, item := range items {
+			fileID, ok, err := fileIDByPath(tx, item.Path)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				missing = append(missing, item.Path)
+				continue
+			}
+			res, err := tx.Exec(`INSERT OR IGNORE INTO collection_items (collection_id, file_id, position, note) VALUES (?, ?, ?, ?)`,
+				id, fileID, next, item.Note)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				next++
+			} else if item.Note != "" {
+				if _, err := tx.Exec(`UPDATE collection_items SET note = ? WHERE collection_id = ? AND file_id = ?`, item.Note, id, fileID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return missing, err
+}
+
+// RemoveCollectionItems removes files from a collection and returns how many were in it
+func (c *Cache) RemoveCollectionItems(name string, paths []string) (removed int, err error) {
+	err = c.editCollection(name, func(tx *sql.Tx, id int64) error {
+		for _, path := range paths {
+			res, err := tx.Exec(`
+				DELETE FROM collection_items
+				WHERE collection_id = ? AND file_id = (SELECT id FROM files WHERE abs_path = ?)
+			`, id, path)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			removed += int(n)
+		}
+		return renumberCollection(tx, id)
+	})
+	return removed, err
+}
+
+// ReorderCollection puts a collection's items in the order of paths. Items not
+// listed keep their relative order after the listed ones, so moving a few
+// files to the front only needs those paths.
+func (c *Cache) ReorderCollection(name string, paths []string) error {
+	return c.editCollection(name, func(tx *sql.Tx, id int64) error {
+		// Listed items get negative positions, in order, ahead of the rest
+		for i, path := range paths {
+			_, err := tx.Exec(`
+				UPDATE collection_items SET position = ?
+				WHERE collection_id = ? AND file_id = (SELECT id FROM files WHERE abs_path = ?)
+			`, i-len(paths), id, path)
+			if err != nil {
+				return err
+			}
+		}
+		return renumberCollection(tx, id)
+	})
+}
+
+// SetCollectionNote sets the note of one item in a collection
+func (c *Cache) SetCollectionNote(name, path, note string) error {
+	return c.editCollection(name, func(tx *sql.Tx, id int64) error {
+		res, err := tx.Exec(`
+			UPDATE collection_items SET note = ?
+			WHERE collection_id = ? AND file_id = (SELECT id FROM files WHERE abs_path = ?)
+		`, note, id, path)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("%s is not in collection %q", path, name)
+		}
+		return nil
+	})
+}
+
+// editCollection runs fn in a transaction with the collection's id and bumps
+// its updated_at
+func (c *Cache) editCollection(name string, fn func(tx *sql.Tx, id int64) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(`SELECT id FROM collections WHERE name = ?`, name).Scan(&id); err == sql.ErrNoRows {
+		return ErrCollectionNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := fn(tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE collections SET updated_at = ? WHERE id = ?`, time.Now().Unix(), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// renumberCollection rewrites positions as 0..n-1 in their current order
+func renumberCollection(tx *sql.Tx, id int64) error {
+	rows, err := tx.Query(`SELECT file_id FROM collection_items WHERE collection_id = ? ORDER BY position`, id)
+	if err != nil {
+		return err
+	}
+	var fileIDs []int64
+	for rows.Next() {
+		var fileID int64
+		if err := rows.Scan(&fileID); err != nil {
+			rows.Close()
+			return err
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, fileID := range fileIDs {
+		if _, err := tx.Exec(`UPDATE collection_items SET position = ? WHERE collection_id = ? AND file_id = ?`, i, id, fileID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileIDByPath looks up a file's id inside a transaction
+func fileIDByPath(tx *sql.Tx, path string) (int64, bool, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM files WHERE abs_path = ?`, path).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
@@ -0,0 +1,441 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/tdsanchez/PostMac/internal/config"
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// TextIndexLimit is the number of bytes of each text file's contents that are
+// indexed; larger files are indexed by name and comment plus their first
+// TextIndexLimit bytes
+var TextIndexLimit int64 = 1 << 20
+
+// textSchema is the original (version 1) full-text index layout. docs maps
+// paths to the rowids of file_text and records what was indexed, so unchanged
+// files are skipped on the next sync.
+const textSchema = `
+CREATE TABLE IF NOT EXISTS docs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    abs_path TEXT UNIQUE NOT NULL,
+    mtime_ns INTEGER NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    comment TEXT NOT NULL
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS file_text USING fts5(
+    name, comment, body,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+`
+
+// textMigrations upgrade text-index-PORT.db
+var textMigrations = []migration{
+	{1, "initial full-text index", execSQL(textSchema)},
+}
+
+// Snippet highlight markers; swapped for <mark> after HTML-escaping the snippet
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// openTextIndex opens the full-text index that sits next to the cache database.
+// It is a separate file because it is derived data (rebuilt by the next scan
+// if deleted) and because builds without FTS5 cannot read FTS5 tables. Returns
+// nil when this binary was built without the sqlite_fts5 tag.
+func openTextIndex(dbPath string) (*sql.DB, string, error) {
+	textPath := filepath.Join(filepath.Dir(dbPath), "text-index"+strings.TrimPrefix(filepath.Base(dbPath), "cache"))
+
+	db, err := sql.Open("sqlite3", textPath+"?cache=shared&mode=rwc&_journal_mode=WAL")
+	if err != nil {
+		return nil, textPath, fmt.Errorf("failed to open text index: %w", err)
+	}
+
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil || !fts5 {
+		db.Close()
+		log.Println("ℹ️  Full-text search disabled (build with -tags sqlite_fts5 to enable)")
+		return nil, textPath, nil
+	}
+
+	if err := migrate(db, textPath, textMigrations); err != nil {
+		db.Close()
+		return nil, textPath, err
+	}
+	return db, textPath, nil
+}
+
+// TextSearchAvailable reports whether the full-text index is enabled
+func (c *Cache) TextSearchAvailable() bool {
+	return c.textDB != nil
+}
+
+// TextIndexStats summarises a SyncTextIndex run
+type TextIndexStats struct {
+	Indexed   int
+	Removed   int
+	Unchanged int
+}
+
+// indexedDoc is what the text index recorded for a path
+type indexedDoc struct {
+	id      int64
+	mtimeNs int64
+	size    int64
+	comment string
+}
+
+// SyncTextIndex makes the full-text index match files: new or changed files
+// (mtime, size or comment) are re-indexed and paths no longer present are
+// dropped. Text file contents are read from disk here.
+func (c *Cache) SyncTextIndex(files []models.FileInfo) (TextIndexStats, error) {
+	var stats TextIndexStats
+	if c.textDB == nil {
+		return stats, nil
+	}
+
+	indexed := make(map[string]indexedDoc)
+	rows, err := c.textDB.Query("SELECT id, abs_path, mtime_ns, size_bytes, comment FROM docs")
+	if err != nil {
+		return stats, err
+	}
+	for rows.Next() {
+		var path string
+		var doc indexedDoc
+		if err := rows.Scan(&doc.id, &path, &doc.mtimeNs, &doc.size, &doc.comment); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		indexed[path] = doc
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	var changed []models.FileInfo
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		if seen[f.Path] {
+			continue
+		}
+		seen[f.Path] = true
+		doc, ok := indexed[f.Path]
+		if ok && doc.mtimeNs == f.OSModTime.UnixNano() && doc.size == f.Size && doc.comment == f.Comment {
+			stats.Unchanged++
+			continue
+		}
+		changed = append(changed, f)
+	}
+	var removed []int64
+	for path, doc := range indexed {
+		if !seen[path] {
+			removed = append(removed, doc.id)
+		}
+	}
+
+	// Same chunking as SaveFiles: short write locks, amortized fsyncs
+	for start := 0; start < len(changed); start += saveChunkSize {
+		end := start + saveChunkSize
+		if end > len(changed) {
+			end = len(changed)
+		}
+		if err := c.indexFiles(changed[start:end]); err != nil {
+			return stats, err
+		}
+		stats.Indexed += end - start
+	}
+
+	if len(removed) > 0 {
+		tx, err := c.textDB.Begin()
+		if err != nil {
+			return stats, err
+		}
+		defer tx.Rollback()
+		for _, id := range removed {
+			if err := removeDoc(tx, id); err != nil {
+				return stats, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return stats, err
+		}
+		stats.Removed = len(removed)
+	}
+
+	return stats, nil
+}
+
+// indexFiles (re-)indexes files in one transaction
+func (c *Cache) indexFiles(files []models.FileInfo) error {
+	tx, err := c.textDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, f := range files {
+		var id int64
+		err := tx.QueryRow(`
+			INSERT INTO docs (abs_path, mtime_ns, size_bytes, comment) VALUES (?, ?, ?, ?)
+			ON CONFLICT(abs_path) DO UPDATE SET mtime_ns = excluded.mtime_ns,
+				size_bytes = excluded.size_bytes, comment = excluded.comment
+			RETURNING id
+		`, f.Path, f.OSModTime.UnixNano(), f.Size, f.Comment).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM file_text WHERE rowid = ?", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO file_text (rowid, name, comment, body) VALUES (?, ?, ?, ?)",
+			id, f.Name, f.Comment, readTextBody(f)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// readTextBody returns the indexed contents of a text file (empty for other
+// files, and for files on offline volumes or that cannot be read)
+func readTextBody(f models.FileInfo) string {
+	if f.Offline || !config.IsTextFile(f.Name) {
+		return ""
+	}
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, TextIndexLimit))
+	if err != nil {
+		return ""
+	}
+	return strings.ToValidUTF8(string(data), "")
+}
+
+func removeDoc(tx *sql.Tx, id int64) error {
+	if _, err := tx.Exec("DELETE FROM file_text WHERE rowid = ?", id); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM docs WHERE id = ?", id)
+	return err
+}
+
+// updateTextIndex applies a single-file change to the text index. The index is
+// derived data, so failures are logged rather than failing the cache write; the
+// next SyncTextIndex repairs it.
+func (c *Cache) updateTextIndex(what string, fn func(tx *sql.Tx) error) {
+	if c.textDB == nil {
+		return
+	}
+	tx, err := c.textDB.Begin()
+	if err == nil {
+		defer tx.Rollback()
+		if err = fn(tx); err == nil {
+			err = tx.Commit()
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️  Text index %s failed: %v", what, err)
+	}
+}
+
+// textIndexFile re-indexes one file after UpsertFile
+func (c *Cache) textIndexFile(f models.FileInfo) {
+	if c.textDB == nil {
+		return
+	}
+	if err := c.indexFiles([]models.FileInfo{f}); err != nil {
+		log.Printf("⚠️  Text index update failed for %s: %v", f.Path, err)
+	}
+}
+
+// textIndexComment updates the indexed comment of one file
+func (c *Cache) textIndexComment(absPath, comment string) {
+	c.updateTextIndex("comment update", func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRow("SELECT id FROM docs WHERE abs_path = ?", absPath).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil // Indexed by the next sync
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE docs SET comment = ? WHERE id = ?", comment, id); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE file_text SET comment = ? WHERE rowid = ?", comment, id)
+		return err
+	})
+}
+
+// textIndexDelete drops one file from the text index
+func (c *Cache) textIndexDelete(absPath string) {
+	c.updateTextIndex("delete", func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRow("SELECT id FROM docs WHERE abs_path = ?", absPath).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return removeDoc(tx, id)
+	})
+}
+
+// textIndexRelocate re-keys indexed paths after RelocatePath or RelocatePrefix
+func (c *Cache) textIndexRelocate(oldPrefix, newPrefix string, subtree bool) {
+	c.updateTextIndex("relocate", func(tx *sql.Tx) error {
+		paths := []string{oldPrefix}
+		if subtree {
+			var err error
+			if paths, err = pathsUnder(tx, "SELECT abs_path FROM docs", "abs_path", oldPrefix); err != nil {
+				return err
+			}
+		}
+		for _, oldPath := range paths {
+			newPath := newPrefix + strings.TrimPrefix(oldPath, oldPrefix)
+			var existing int64
+			err := tx.QueryRow("SELECT id FROM docs WHERE abs_path = ?", newPath).Scan(&existing)
+			if err == nil {
+				if err := removeDoc(tx, existing); err != nil {
+					return err
+				}
+			} else if err != sql.ErrNoRows {
+				return err
+			}
+			var id int64
+			err = tx.QueryRow("UPDATE docs SET abs_path = ? WHERE abs_path = ? RETURNING id", newPath, oldPath).Scan(&id)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE file_text SET name = ? WHERE rowid = ?", filepath.Base(newPath), id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TextHit is one ranked full-text search result
+type TextHit struct {
+	Path    string  `json:"path"`
+	Score   float64 `json:"score"`   // Higher is better
+	Snippet string  `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+}
+
+// textRankSQL ranks name matches above comment matches above body matches
+const textRankSQL = "bm25(file_text, 10.0, 5.0, 1.0)"
+
+// SearchText runs a full-text query and returns up to limit hits, best first
+func (c *Cache) SearchText(query string, limit int) ([]TextHit, error) {
+	if c.textDB == nil {
+		return nil, fmt.Errorf("full-text search is not available in this build")
+	}
+	match := TextQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("empty text query")
+	}
+
+	rows, err := c.textDB.Query(`
+		SELECT d.abs_path, `+textRankSQL+`,
+		       snippet(file_text, -1, ?, ?, '…', 16)
+		FROM file_text
+		JOIN docs d ON d.id = file_text.rowid
+		WHERE file_text MATCH ?
+		ORDER BY `+textRankSQL+`
+		LIMIT ?
+	`, snippetOpen, snippetClose, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []TextHit
+	for rows.Next() {
+		var hit TextHit
+		var rank float64
+		if err := rows.Scan(&hit.Path, &rank, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		hit.Score = -rank // bm25() is lower-is-better
+		hit.Snippet = highlightSnippet(hit.Snippet)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// MatchText returns the set of paths matching a full-text query, for the
+// text:"..." search predicate
+func (c *Cache) MatchText(query string) (map[string]bool, error) {
+	if c.textDB == nil {
+		return nil, fmt.Errorf("full-text search is not available in this build")
+	}
+	match := TextQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("empty text query")
+	}
+
+	rows, err := c.textDB.Query(`
+		SELECT d.abs_path FROM file_text
+		JOIN docs d ON d.id = file_text.rowid
+		WHERE file_text MATCH ?
+	`, match)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string]bool)
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths[p] = true
+	}
+	return paths, rows.Err()
+}
+
+// TextQuery turns user input into an FTS5 query: every word must match, a
+// trailing * makes a word a prefix match, and all other punctuation is
+// literal (FTS5 operators are not exposed)
+func TextQuery(input string) string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(input, unicode.IsSpace) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimRight(word, "*")
+		if word == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// highlightSnippet escapes a snippet for HTML and turns the match markers into <mark> tags
+func highlightSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, snippetOpen, "<mark>")
+	return strings.ReplaceAll(s, snippetClose, "</mark>")
+}
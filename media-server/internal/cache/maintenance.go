@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the timestamp embedded in backup file names
+const backupTimeFormat = "20060102-150405"
+
+// DefaultBackupDir returns ~/.media-server-conf/backups
+func DefaultBackupDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".media-server-conf", "backups"), nil
+}
+
+// Backup copies both databases into dir using SQLite's online backup API, so it
+// is safe while the server is reading and writing. Returns the files written.
+func (c *Cache) Backup(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	stamp := time.Now().Format(backupTimeFormat)
+	var written []string
+	for _, src := range []struct {
+		db   *sql.DB
+		path string
+	}{{c.db, c.dbPath}, {c.mlDB, c.mlDBPath}} {
+		dest := filepath.Join(dir, backupName(src.path, stamp))
+		if err := onlineBackup(src.db, dest); err != nil {
+			os.Remove(dest)
+			return written, fmt.Errorf("failed to back up %s: %w", filepath.Base(src.path), err)
+		}
+		written = append(written, dest)
+	}
+	return written, nil
+}
+
+// backupName turns cache-8080.db into cache-8080-STAMP.db
+func backupName(dbPath, stamp string) string {
+	base := strings.TrimSuffix(filepath.Base(dbPath), ".db")
+	return base + "-" + stamp + ".db"
+}
+
+// PruneBackups keeps the newest keep backups of each database in dir and
+// deletes the rest. Only files belonging to this cache's port are touched.
+func (c *Cache) PruneBackups(dir string, keep int) ([]string, error) {
+	var removed []string
+	for _, dbPath := range []string{c.dbPath, c.mlDBPath} {
+		matches, err := c.backupsOf(dir, dbPath)
+		if err != nil {
+			return removed, err
+		}
+		if len(matches) <= keep {
+			continue
+		}
+		// Names embed a sortable timestamp; oldest first
+		for _, old := range matches[:len(matches)-keep] {
+			if err := os.Remove(old); err != nil {
+				return removed, err
+			}
+			removed = append(removed, old)
+		}
+	}
+	return removed, nil
+}
+
+// backupsOf lists backups of dbPath in dir, oldest first
+func (c *Cache) backupsOf(dir, dbPath string) ([]string, error) {
+	prefix := strings.TrimSuffix(filepath.Base(dbPath), ".db") + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+		// cache-8080-STAMP.db must not match cache-80800-STAMP.db
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".db")
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		matches = append(matches, filepath.Join(dir, name))
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// StartAutoBackup backs up both databases every interval and prunes old
+// backups to keep per database. The first run is scheduled relative to the
+// newest existing backup, so restarts don't reset the schedule. It stops when
+// ctx is done (a backup in progress is finished first); the returned channel
+// is closed once it has.
+func (c *Cache) StartAutoBackup(ctx context.Context, dir string, interval time.Duration, keep int) <-chan struct{} {
+	next := interval
+	if existing, err := c.backupsOf(dir, c.dbPath); err == nil && len(existing) > 0 {
+		if info, err := os.Stat(existing[len(existing)-1]); err == nil {
+			next = interval - time.Since(info.ModTime())
+		}
+	}
+	if next < time.Minute {
+		next = time.Minute // Give startup scans room before the first copy
+	}
+	log.Printf("🗄️  Auto-backup every %v to %s (keeping %d), next in %v", interval, dir, keep, next.Round(time.Second))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(next)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
+			}
+			written, err := c.Backup(dir)
+			if err != nil {
+				log.Printf("⚠️  Auto-backup failed: %v", err)
+			} else {
+				log.Printf("🗄️  Auto-backup wrote %d files", len(written))
+				if removed, err := c.PruneBackups(dir, keep); err != nil {
+					log.Printf("⚠️  Failed to prune old backups: %v", err)
+				} else if len(removed) > 0 {
+					log.Printf("🗄️  Pruned %d old backups", len(removed))
+				}
+			}
+			timer.Reset(interval)
+		}
+	}()
+	return done
+}
+
+// Ping checks that both databases can still be queried
+func (c *Cache) Ping(ctx context.Context) error {
+	for _, db := range []*sql.DB{c.db, c.mlDB} {
+		var one int
+		if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IntegrityCheck runs PRAGMA integrity_check on both databases and returns the
+// problems found, keyed by database file name (empty when both are "ok")
+func (c *Cache) IntegrityCheck() (map[string][]string, error) {
+	problems := make(map[string][]string)
+	for _, src := range []struct {
+		db   *sql.DB
+		path string
+	}{{c.db, c.dbPath}, {c.mlDB, c.mlDBPath}} {
+		rows, err := src.db.Query("PRAGMA integrity_check")
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if line != "ok" {
+				name := filepath.Base(src.path)
+				problems[name] = append(problems[name], line)
+			}
+		}
+		rows.Close()
+	}
+	return problems, nil
+}
+
+// CleanupOrphanTags deletes tag rows whose file no longer exists. Foreign keys
+// prevent these normally, but older builds and external tools could leave them.
+func (c *Cache) CleanupOrphanTags() (int64, error) {
+	result, err := c.db.Exec("DELETE FROM tags WHERE file_id NOT IN (SELECT id FROM files)")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Vacuum rebuilds both database files to reclaim free pages
+func (c *Cache) Vacuum() error {
+	if _, err := c.db.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(c.dbPath), err)
+	}
+	if _, err := c.mlDB.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(c.mlDBPath), err)
+	}
+	return nil
+}
+
+// FilePaths returns the absolute path of every cached file
+func (c *Cache) FilePaths() ([]string, error) {
+	rows, err := c.db.Query("SELECT abs_path FROM files ORDER BY abs_path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// migration is one ordered, forward-only schema change. Each runs in its own
+// transaction and is recorded in schema_version when it commits.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// cacheMigrations upgrade cache-PORT.db. Append new migrations; never edit or
+// reorder released ones.
+var cacheMigrations = []migration{
+	{1, "initial schema", execSQL(schema)},
+	{2, "file identity for move tracking", func(tx *sql.Tx) error {
+		for _, col := range [][2]string{{"inode", "INTEGER"}, {"device", "INTEGER"}, {"content_hash", "TEXT"}} {
+			if err := addColumn(tx, "files", col[0], col[1]); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_files_inode ON files(device, inode)")
+		return err
+	}},
+	{3, "volume for offline tracking", func(tx *sql.Tx) error {
+		return addColumn(tx, "files", "volume", "TEXT")
+	}},
+	{4, "gps location", func(tx *sql.Tx) error {
+		for _, col := range []string{"latitude", "longitude", "altitude"} {
+			if err := addColumn(tx, "files", col, "REAL"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{5, "timezone mismatch classification", func(tx *sql.Tx) error {
+		return addColumn(tx, "files", "timezone_mismatch", "INTEGER")
+	}},
+	{6, "file integrity checks", execSQL(fileChecksSchema)},
+	{7, "star rating and color label", func(tx *sql.Tx) error {
+		if err := addColumn(tx, "files", "rating", "INTEGER"); err != nil {
+			return err
+		}
+		return addColumn(tx, "files", "color_label", "TEXT")
+	}},
+	{8, "ordered collections", execSQL(collectionsSchema)},
+	{9, "users, sessions, API tokens and audit log", execSQL(authSchema)},
+	{10, "API token scopes", func(tx *sql.Tx) error {
+		return addColumn(tx, "api_tokens", "scope", "TEXT NOT NULL DEFAULT ''")
+	}},
+}
+
+// mlMigrations upgrade ml-training-PORT.db
+var mlMigrations = []migration{
+	{1, "initial schema", execSQL(mlSchema)},
+}
+
+// CacheSchemaVersion and MLSchemaVersion are the versions this build migrates to
+var (
+	CacheSchemaVersion = cacheMigrations[len(cacheMigrations)-1].version
+	MLSchemaVersion    = mlMigrations[len(mlMigrations)-1].version
+)
+
+const versionTableSQL = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    description TEXT NOT NULL,
+    applied_at INTEGER NOT NULL
+);`
+
+// SchemaStatus reports the schema version of one database file
+type SchemaStatus struct {
+	Name    string
+	Path    string
+	Exists  bool
+	Current int
+	Target  int
+}
+
+// Pending reports whether opening the database would run migrations
+func (s SchemaStatus) Pending() bool {
+	return s.Current < s.Target
+}
+
+// Unsupported reports whether the database was written by a newer build
+func (s SchemaStatus) Unsupported() bool {
+	return s.Current > s.Target
+}
+
+// CheckSchema reports the current and target schema versions of both databases
+// for a port without opening them for writing or migrating anything
+func CheckSchema(port string) ([]SchemaStatus, error) {
+	dbPath, mlDBPath, err := Paths(port)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []SchemaStatus{
+		{Name: "cache", Path: dbPath, Target: CacheSchemaVersion},
+		{Name: "ml-training", Path: mlDBPath, Target: MLSchemaVersion},
+	}
+	for i := range statuses {
+		st := &statuses[i]
+		if _, err := os.Stat(st.Path); os.IsNotExist(err) {
+			continue
+		}
+		st.Exists = true
+
+		db, err := sql.Open("sqlite3", st.Path+"?mode=ro")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", st.Path, err)
+		}
+		st.Current, err = schemaVersion(db)
+		db.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema version of %s: %w", st.Path, err)
+		}
+	}
+	return statuses, nil
+}
+
+// migrate brings db up to the latest version in migrations, copying the file
+// aside first when it already holds data
+func migrate(db *sql.DB, path string, migrations []migration) error {
+	name := filepath.Base(path)
+	current, err := schemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version of %s: %w", name, err)
+	}
+	target := migrations[len(migrations)-1].version
+
+	if current > target {
+		return fmt.Errorf("%s has schema version %d, newer than this build supports (%d)", name, current, target)
+	}
+	if current == target {
+		return nil
+	}
+
+	hasData, err := hasTables(db)
+	if err != nil {
+		return err
+	}
+	if hasData {
+		backupPath := fmt.Sprintf("%s.v%d-%s.bak", path, current, time.Now().Format("20060102-150405"))
+		if _, err := db.Exec("VACUUM INTO ?", backupPath); err != nil {
+			return fmt.Errorf("failed to back up %s before migrating: %w", name, err)
+		}
+		log.Printf("🗄️  Backed up %s (schema v%d) to %s", name, current, backupPath)
+	}
+
+	if _, err := db.Exec(versionTableSQL); err != nil {
+		return fmt.Errorf("failed to create schema_version in %s: %w", name, err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("%s migration %d (%s) failed: %w", name, m.version, m.description, err)
+		}
+		log.Printf("🗄️  Migrated %s to schema v%d: %s", name, m.version, m.description)
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)",
+		m.version, m.description, time.Now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion returns the highest applied migration, or 0 for a new or
+// pre-versioning database (whose migrations are written to be idempotent)
+func schemaVersion(db *sql.DB) (int, error) {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&n); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// hasTables reports whether the database holds any user tables
+func hasTables(db *sql.DB) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&n)
+	return n > 0, err
+}
+
+// execSQL returns a migration step that runs a fixed SQL script
+func execSQL(script string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(script)
+		return err
+	}
+}
+
+// addColumn adds a column unless it already exists (caches from builds before
+// schema versioning may have it)
+func addColumn(tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	exists := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == column {
+			exists = true
+		}
+	}
+	rows.Close()
+
+	if exists {
+		return nil
+	}
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + decl)
+	return err
+}
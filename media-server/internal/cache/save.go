@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// saveChunkSize is the number of row changes written per transaction by SaveFiles.
+// Small enough to keep write locks short, large enough to amortize fsyncs.
+const saveChunkSize = 500
+
+// fileUpsertSQL inserts a file or updates it in place, keeping its id (and so
+// its tags' foreign keys) stable. Returns the row id either way.
+var fileUpsertSQL = buildFileUpsertSQL()
+
+func buildFileUpsertSQL() string {
+	var sets []string
+	for _, col := range strings.Split(fileInsertColumns, ",") {
+		col = strings.TrimSpace(col)
+		if col != "abs_path" {
+			sets = append(sets, col+" = excluded."+col)
+		}
+	}
+	return `INSERT INTO files (` + fileInsertColumns + `)
+		VALUES (` + fileInsertPlaceholders + `)
+		ON CONFLICT(abs_path) DO UPDATE SET ` + strings.Join(sets, ", ") + `
+		RETURNING id`
+}
+
+// SaveStats summarises the diff written by SaveFiles
+type SaveStats struct {
+	Inserted  int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// storedRow is the persisted form of a file, used to diff against new scan results
+type storedRow struct {
+	id     int64
+	values []interface{}
+	tags   []string
+}
+
+// fileChange is one pending write computed by SaveFiles
+type fileChange struct {
+	file       models.FileInfo
+	values     []interface{}
+	tagsDirty  bool
+	deletePath string // Set for deletions
+}
+
+// SaveFiles makes the cache match files by writing only the difference against
+// what is stored: new and changed rows are upserted in place (ids stay stable),
+// rows no longer present are deleted, and identical rows are left untouched.
+// Changes are committed in chunks; scan_metadata is updated in the final chunk.
+func (c *Cache) SaveFiles(files []models.FileInfo, totalTags int) (SaveStats, error) {
+	var stats SaveStats
+
+	stored, err := c.loadStoredRows()
+	if err != nil {
+		return stats, err
+	}
+
+	var changes []fileChange
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		if seen[f.Path] {
+			continue
+		}
+		seen[f.Path] = true
+
+		values := normalizeValues(fileValues(f))
+		old, exists := stored[f.Path]
+		switch {
+		case !exists:
+			stats.Inserted++
+			changes = append(changes, fileChange{file: f, values: values, tagsDirty: true})
+		case !equalValues(old.values, values):
+			stats.Updated++
+			changes = append(changes, fileChange{file: f, values: values, tagsDirty: !equalTags(old.tags, f.Tags)})
+		case !equalTags(old.tags, f.Tags):
+			stats.Updated++
+			changes = append(changes, fileChange{file: f, values: values, tagsDirty: true})
+		default:
+			stats.Unchanged++
+		}
+	}
+	for path := range stored {
+		if !seen[path] {
+			stats.Deleted++
+			changes = append(changes, fileChange{deletePath: path})
+		}
+	}
+
+	for start := 0; ; start += saveChunkSize {
+		end := start + saveChunkSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+		final := end == len(changes)
+		if err := c.writeChanges(changes[start:end], final, len(seen), totalTags); err != nil {
+			return stats, err
+		}
+		if final {
+			break
+		}
+	}
+
+	return stats, nil
+}
+
+// writeChanges applies one chunk of changes in a single transaction. The final
+// chunk also records scan_metadata, so the metadata never claims a save that
+// did not fully land.
+func (c *Cache) writeChanges(changes []fileChange, final bool, totalFiles, totalTags int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertStmt, err := tx.Prepare(fileUpsertSQL)
+	if err != nil {
+		return err
+	}
+	defer upsertStmt.Close()
+
+	for _, ch := range changes {
+		if ch.deletePath != "" {
+			// Tags are automatically deleted via CASCADE foreign key constraint
+			if _, err := tx.Exec("DELETE FROM files WHERE abs_path = ?", ch.deletePath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var fileID int64
+		if err := upsertStmt.QueryRow(ch.values...).Scan(&fileID); err != nil {
+			return err
+		}
+		if ch.tagsDirty {
+			if err := replaceTags(tx, fileID, ch.file.Tags); err != nil {
+				return err
+			}
+		}
+	}
+
+	if final {
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO scan_metadata (id, last_scan_time, total_files, total_tags)
+			VALUES (1, ?, ?, ?)
+		`, time.Now().Unix(), totalFiles, totalTags); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// replaceTags rewrites the tag rows of one file
+func replaceTags(tx *sql.Tx, fileID int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM tags WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO tags (file_id, tag_name) VALUES (?, ?)", fileID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadStoredRows reads the raw persisted values of every file plus its tags
+func (c *Cache) loadStoredRows() (map[string]*storedRow, error) {
+	rows, err := c.db.Query(`SELECT id, ` + fileInsertColumns + ` FROM files`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]*storedRow)
+	byID := make(map[int64]*storedRow)
+	columnCount := strings.Count(fileInsertColumns, ",") + 1
+	for rows.Next() {
+		row := &storedRow{values: make([]interface{}, columnCount)}
+		dest := make([]interface{}, columnCount+1)
+		dest[0] = &row.id
+		for i := range row.values {
+			dest[i+1] = &row.values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row.values = normalizeValues(row.values)
+		stored[row.values[0].(string)] = row
+		byID[row.id] = row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := c.db.Query("SELECT file_id, tag_name FROM tags ORDER BY file_id, rowid")
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var fileID int64
+		var tag string
+		if err := tagRows.Scan(&fileID, &tag); err != nil {
+			return nil, err
+		}
+		if row, ok := byID[fileID]; ok {
+			row.tags = append(row.tags, tag)
+		}
+	}
+	return stored, tagRows.Err()
+}
+
+// normalizeValues converts insert arguments and scanned column values to the
+// same plain types (int64, float64, string or nil) so they can be compared
+func normalizeValues(values []interface{}) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		if valuer, ok := v.(driver.Valuer); ok {
+			v, _ = valuer.Value()
+		}
+		switch x := v.(type) {
+		case []byte:
+			v = string(x)
+		case int:
+			v = int64(x)
+		case bool:
+			if x {
+				v = int64(1)
+			} else {
+				v = int64(0)
+			}
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func equalValues(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -10,6 +10,7 @@ var (
 	SupportedExts = map[string]bool{
 		".gif": true, ".jpg": true, ".jpeg": true, ".mp4": true,
 		".png": true, ".tif": true, ".tiff": true, ".webp": true,
+		".heic": true, ".heif": true,
 		".mov": true, ".avi": true, ".mkv": true, ".m4v": true,
 		".pdf": true,
 		".go": true, ".sh": true, ".mod": true, ".sum": true,
@@ -56,7 +57,7 @@ func GetFileTypeCategory(filename string) string {
 	ext := strings.ToLower(filepath.Ext(filename))
 
 	switch {
-	case ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif" || ext == ".webp" || ext == ".tif" || ext == ".tiff":
+	case ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif" || ext == ".webp" || ext == ".tif" || ext == ".tiff" || ext == ".heic" || ext == ".heif":
 		return "📷 Images"
 	case ext == ".mp4" || ext == ".mov" || ext == ".avi" || ext == ".mkv" || ext == ".m4v":
 		return "🎬 Videos"
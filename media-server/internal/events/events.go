@@ -0,0 +1,209 @@
+// Package events broadcasts library changes to connected clients as
+// server-sent events (see handlers.HandleEvents).
+//
+// Every event gets an increasing ID, prefixed with an epoch that is new for
+// each process, and is kept in a bounded history, so a client that reconnects
+// with Last-Event-ID is sent what it missed (or told to resync when the ID is
+// from an earlier process). Each
+// client also has its own bounded backlog; a client that falls that far
+// behind is disconnected and resumes from the history on reconnect instead of
+// slowing down everyone else.
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	ScanStarted    = "scan-started"
+	ScanProgress   = "scan-progress"
+	ScanCompleted  = "scan-completed"
+	TagsChanged    = "tags-changed"
+	CommentChanged = "comment-changed"
+	FileDeleted    = "file-deleted"
+	FileAdded      = "file-added"
+
+	// Resync tells a client its Last-Event-ID is older than the history (or
+	// from before a restart), so it must reload instead of resuming
+	Resync = "resync"
+)
+
+// transient events are only worth sending live: a reconnecting client needs
+// the latest scan progress, not a replay of every tick
+var transient = map[string]bool{
+	ScanProgress: true,
+}
+
+const (
+	historySize   = 1024 // Events kept for Last-Event-ID resume
+	clientBacklog = 256  // Events queued per client before it is dropped
+)
+
+// Event is one broadcast message. Data is the JSON payload.
+type Event struct {
+	ID   uint64
+	Type string
+	Data []byte
+
+	epoch string // Of the broker that published it
+}
+
+// LastEventID returns the ID sent to clients: "EPOCH-ID"
+func (ev Event) LastEventID() string {
+	return ev.epoch + "-" + strconv.FormatUint(ev.ID, 10)
+}
+
+// Client receives events published after it subscribed
+type Client struct {
+	C chan Event // Closed when the client unsubscribes or is dropped for falling behind
+}
+
+// Broker fans events out to subscribed clients
+type Broker struct {
+	epoch string // Distinguishes this broker's IDs from those of earlier processes
+
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event // The most recent non-transient events, oldest first
+	evicted uint64  // ID of the newest event dropped from history
+	clients map[*Client]bool
+}
+
+var defaultBroker = NewBroker()
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		clients: make(map[*Client]bool),
+	}
+}
+
+// Publish broadcasts an event to every client of the default broker
+func Publish(eventType string, data interface{}) {
+	defaultBroker.Publish(eventType, data)
+}
+
+// Subscribe registers a client with the default broker
+func Subscribe(lastEventID string) (*Client, []Event) {
+	return defaultBroker.Subscribe(lastEventID)
+}
+
+// Unsubscribe removes a client from the default broker
+func Unsubscribe(c *Client) {
+	defaultBroker.Unsubscribe(c)
+}
+
+// DisconnectAll ends every stream of the default broker
+func DisconnectAll() {
+	defaultBroker.DisconnectAll()
+}
+
+// ClientCount returns the number of clients of the default broker
+func ClientCount() int {
+	return defaultBroker.ClientCount()
+}
+
+// Publish encodes data as JSON and sends it to every client. Clients whose
+// backlog is full are dropped.
+func (b *Broker) Publish(eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("⚠️  Failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	ev := Event{ID: b.lastID, Type: eventType, Data: payload, epoch: b.epoch}
+	if !transient[eventType] {
+		if len(b.history) == historySize {
+			b.evicted = b.history[0].ID
+			copy(b.history, b.history[1:])
+			b.history = b.history[:historySize-1]
+		}
+		b.history = append(b.history, ev)
+	}
+
+	for c := range b.clients {
+		select {
+		case c.C <- ev:
+		default:
+			delete(b.clients, c)
+			close(c.C)
+		}
+	}
+}
+
+// Subscribe registers a client. With a lastEventID (as sent by the client,
+// "" for a new stream) the events after it are returned for replay; when the
+// ID is from another process or those events are no longer all in the
+// history, a single Resync event is returned instead.
+func (b *Broker) Subscribe(lastEventID string) (*Client, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := &Client{C: make(chan Event, clientBacklog)}
+	b.clients[c] = true
+	if lastEventID == "" {
+		return c, nil
+	}
+
+	epoch, n, _ := strings.Cut(lastEventID, "-")
+	id, err := strconv.ParseUint(n, 10, 64)
+	if err != nil || epoch != b.epoch || id > b.lastID || id < b.evicted {
+		return c, []Event{b.resyncEvent()}
+	}
+
+	var replay []Event
+	for _, ev := range b.history {
+		if ev.ID > id {
+			replay = append(replay, ev)
+		}
+	}
+	return c, replay
+}
+
+// resyncEvent carries the current ID so a client that reloads resumes from it
+func (b *Broker) resyncEvent() Event {
+	data, _ := json.Marshal(map[string]interface{}{"time": time.Now()})
+	return Event{ID: b.lastID, Type: Resync, Data: data, epoch: b.epoch}
+}
+
+// Unsubscribe removes a client; events already queued for it are discarded
+func (b *Broker) Unsubscribe(c *Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.clients[c] {
+		delete(b.clients, c)
+		close(c.C)
+	}
+}
+
+// DisconnectAll drops every client, ending their streams. Used on server
+// shutdown, which otherwise waits for open streams to finish.
+func (b *Broker) DisconnectAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		delete(b.clients, c)
+		close(c.C)
+	}
+}
+
+// ClientCount returns the number of connected clients
+func (b *Broker) ClientCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
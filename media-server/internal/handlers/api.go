@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"github.com/tdsanchez/PostMac/internal/cache"
 	"github.com/tdsanchez/PostMac/internal/config"
 	"github.com/tdsanchez/PostMac/internal/conversion"
+	"github.com/tdsanchez/PostMac/internal/events"
 	"github.com/tdsanchez/PostMac/internal/metadata"
 	"github.com/tdsanchez/PostMac/internal/models"
 	"github.com/tdsanchez/PostMac/internal/persistence"
@@ -42,24 +44,31 @@ func HandleAddTag(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	cleanPath, ok := confinePath(w, r, op.FilePath)
+	if !ok {
+		return
+	}
+	op.FilePath = cleanPath
 
-	// Get current tags from in-memory data (NOT from disk) - lock-free
-	current := state.GetCurrent()
-	allFiles := current.AllFiles
-	var currentTags []string
-	for i := range allFiles {
-		if allFiles[i].Path == op.FilePath {
-			currentTags = make([]string, len(allFiles[i].Tags))
-			copy(currentTags, allFiles[i].Tags)
-			break
-		}
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+
+	// Reject the edit if the file changed since the client loaded it
+	file, ok := checkETag(op.FilePath, sentETag(r, op.ETag))
+	if !ok {
+		writeConflict(w, file)
+		return
 	}
 
+	// Get current tags from in-memory data (NOT from disk)
+	currentTags := make([]string, len(file.Tags))
+	copy(currentTags, file.Tags)
+
 	// Check if tag already exists
 	for _, t := range currentTags {
 		if t == op.Tag {
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tags": currentTags})
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tags": currentTags, "etag": currentETag(op.FilePath)})
 			return
 		}
 	}
@@ -74,7 +83,7 @@ func HandleAddTag(w http.ResponseWriter, r *http.Request) {
 	persistence.QueueDiskWrite(op.FilePath, newTags)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tags": newTags})
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tags": newTags, "etag": currentETag(op.FilePath)})
 }
 
 // HandleBatchAddTag handles adding a tag to multiple files
@@ -90,21 +99,26 @@ func HandleBatchAddTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Paths outside the library are skipped and reported
+	paths, denied := confinePaths(r, op.FilePaths)
+	etags := cleanKeys(op.ETags)
+
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+
 	successCount := 0
-	// Lock-free state access (double-buffered)
-	current := state.GetCurrent()
-	allFiles := current.AllFiles
+	conflicts := []map[string]interface{}{}
+	for _, absPath := range paths {
+		// Files changed since the client loaded them are skipped and reported
+		file, ok := checkETag(absPath, etags[absPath])
+		if !ok {
+			conflicts = append(conflicts, fileState(file))
+			continue
+		}
 
-	for _, absPath := range op.FilePaths {
 		// Get current tags from in-memory data
-		var currentTags []string
-		for i := range allFiles {
-			if allFiles[i].Path == absPath {
-				currentTags = make([]string, len(allFiles[i].Tags))
-				copy(currentTags, allFiles[i].Tags)
-				break
-			}
-		}
+		currentTags := make([]string, len(file.Tags))
+		copy(currentTags, file.Tags)
 
 		// Check if tag already exists
 		tagExists := false
@@ -130,8 +144,10 @@ func HandleBatchAddTag(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"count":   successCount,
+		"success":   true,
+		"count":     successCount,
+		"conflicts": conflicts,
+		"denied":    denied,
 	})
 }
 
@@ -147,22 +163,25 @@ func HandleRemoveTag(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	cleanPath, ok := confinePath(w, r, op.FilePath)
+	if !ok {
+		return
+	}
+	op.FilePath = cleanPath
 
-	// Get current tags from in-memory data - lock-free
-	current := state.GetCurrent()
-	allFiles := current.AllFiles
-	var currentTags []string
-	for i := range allFiles {
-		if allFiles[i].Path == op.FilePath {
-			currentTags = make([]string, len(allFiles[i].Tags))
-			copy(currentTags, allFiles[i].Tags)
-			break
-		}
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+
+	// Reject the edit if the file changed since the client loaded it
+	file, ok := checkETag(op.FilePath, sentETag(r, op.ETag))
+	if !ok {
+		writeConflict(w, file)
+		return
 	}
 
 	// Remove the tag
 	newTags := []string{}
-	for _, t := range currentTags {
+	for _, t := range file.Tags {
 		if t != op.Tag {
 			newTags = append(newTags, t)
 		}
@@ -175,7 +194,7 @@ func HandleRemoveTag(w http.ResponseWriter, r *http.Request) {
 	persistence.QueueDiskWrite(op.FilePath, newTags)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tags": newTags})
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tags": newTags, "etag": currentETag(op.FilePath)})
 }
 
 // HandleGetAllTags returns all available tags
@@ -234,31 +253,62 @@ func HandleUpdateComment(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		FilePath string `json:"filepath"`
 		Comment  string `json:"comment"`
+		ETag     string `json:"etag"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	cleanPath, ok := confinePath(w, r, req.FilePath)
+	if !ok {
+		return
+	}
+	req.FilePath = cleanPath
+
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+
+	// Reject the edit if the file changed since the client loaded it
+	if file, ok := checkETag(req.FilePath, sentETag(r, req.ETag)); !ok {
+		writeConflict(w, file)
+		return
+	}
 
 	// FilePath is now always absolute
-	fullPath := req.FilePath
+	if err := applyComment(req.FilePath, req.Comment); err != nil {
+		http.Error(w, "Failed to update comment", http.StatusInternalServerError)
+		return
+	}
 
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Comment updated successfully",
+		"etag":    currentETag(req.FilePath),
+	})
+}
+
+// applyComment writes a Finder comment to disk, then updates the cache and the
+// in-memory state
+func applyComment(fullPath, comment string) error {
 	// Update comment on disk immediately
-	if err := scanner.SetMacOSComment(fullPath, req.Comment); err != nil {
+	if err := scanner.SetMacOSComment(fullPath, comment); err != nil {
 		log.Printf("Error setting comment for %s: %v", fullPath, err)
-		http.Error(w, "Failed to update comment", http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	// Update comment in cache
 	if dbCache := state.GetCache(); dbCache != nil {
-		if err := dbCache.UpdateFileComment(req.FilePath, req.Comment); err != nil {
-			log.Printf("Warning: Failed to update cache for %s: %v", req.FilePath, err)
+		if err := dbCache.UpdateFileComment(fullPath, comment); err != nil {
+			log.Printf("Warning: Failed to update cache for %s: %v", fullPath, err)
 		}
 	}
 
 	// Update comment in memory across ALL categories
+	state.LockRebuild()
+	defer state.UnlockRebuild()
 	state.LockData()
 	defer state.UnlockData()
 
@@ -267,50 +317,70 @@ func HandleUpdateComment(w http.ResponseWriter, r *http.Request) {
 
 	// Update in allFiles
 	for i := range allFiles {
-		if allFiles[i].Path == req.FilePath {
-			allFiles[i].Comment = req.Comment
+		if allFiles[i].Path == fullPath {
+			allFiles[i].Comment = comment
 		}
 	}
+	state.NoteEdit(fullPath)
 
 	// Update in ALL categories (including subdirectory and type categories)
 	for categoryName, files := range filesByTag {
 		for j := range files {
-			if files[j].Path == req.FilePath {
-				filesByTag[categoryName][j].Comment = req.Comment
+			if files[j].Path == fullPath {
+				filesByTag[categoryName][j].Comment = comment
 			}
 		}
 	}
 
-	// Return success
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Comment updated successfully",
+	events.Publish(events.CommentChanged, map[string]interface{}{
+		"path":    fullPath,
+		"comment": comment,
+		"etag":    currentETag(fullPath),
 	})
+	return nil
 }
 
-// HandleShutdown gracefully shuts down the server
+// shutdownFunc starts the server's graceful shutdown (see SetShutdownFunc)
+var shutdownFunc func()
+
+// SetShutdownFunc sets the function HandleShutdown calls to stop the server
+func SetShutdownFunc(f func()) {
+	shutdownFunc = f
+}
+
+// shutdownFlushTimeout bounds the flush HandleShutdown reports on
+const shutdownFlushTimeout = 10 * time.Second
+
+// HandleShutdown gracefully shuts down the server: queued tag and rating
+// writes are flushed first and the response reports them, then the server
+// stops accepting requests and finishes the shutdown in the background
 func HandleShutdown(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if shutdownFunc == nil {
+		http.Error(w, "Shutdown not available", http.StatusServiceUnavailable)
+		return
+	}
 
 	log.Println("🛑 Shutdown requested from UI")
 
-	// Send success response
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	flushed := persistence.FlushWriteQueue(ctx)
+	log.Printf("💾 Flushed %d tag and %d rating writes (%d failed, %d pending)",
+		flushed.Tags, flushed.Ratings, flushed.Failed, flushed.Pending)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": "Server shutting down...",
+		"flushed": flushed,
 	})
 
-	// Graceful shutdown after response sent
-	go func() {
-		time.Sleep(500 * time.Millisecond)
-		log.Println("👋 Server shutdown complete")
-		os.Exit(0)
-	}()
+	// The server waits for this response before it closes
+	shutdownFunc()
 }
 
 // HandleRescan triggers an incremental scan in the background
@@ -342,15 +412,21 @@ func HandleRescan(w http.ResponseWriter, r *http.Request) {
 	// Trigger scan in background
 	go func() {
 		dbCache := state.GetCache()
-		stdinPaths := state.GetStdinPaths()
+		libraryPaths := scanner.LibraryPaths()
 
 		state.SetScanning(true)
+		events.Publish(events.ScanStarted, map[string]interface{}{"kind": "rescan"})
 		log.Println("📊 Starting incremental scan...")
 
-		// Perform scan using stdin paths
-		if err := scanner.ProcessPaths(stdinPaths); err != nil {
+		// Perform scan using stdin paths and directory roots
+		if err := scanner.ProcessPaths(libraryPaths); err != nil {
 			log.Printf("❌ Scan failed: %v", err)
 			state.SetScanning(false)
+			events.Publish(events.ScanCompleted, map[string]interface{}{
+				"kind":    "rescan",
+				"success": false,
+				"error":   err.Error(),
+			})
 			return
 		}
 
@@ -360,6 +436,11 @@ func HandleRescan(w http.ResponseWriter, r *http.Request) {
 		}
 
 		state.SetScanCompleted()
+		events.Publish(events.ScanCompleted, map[string]interface{}{
+			"kind":    "rescan",
+			"success": true,
+			"files":   len(state.GetCurrent().AllFiles),
+		})
 		log.Println("✅ Scan completed")
 	}()
 }
@@ -394,41 +475,39 @@ func HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		FilePath string `json:"filePath"`
+		ETag     string `json:"etag"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	cleanPath, ok := confinePath(w, r, req.FilePath)
+	if !ok {
+		return
+	}
 
-	// FilePath is now always absolute
-	cleanPath := filepath.Clean(req.FilePath)
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
 
-	// Check if file exists
-	if _, err := os.Stat(cleanPath); os.IsNotExist(err) {
-		log.Printf("❌ Delete failed: file not found: %s", cleanPath)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "File not found",
-		})
+	// Don't trash a file whose tags or comment changed since the client saw it
+	if file, ok := checkETag(cleanPath, sentETag(r, req.ETag)); !ok {
+		writeConflict(w, file)
 		return
 	}
 
-	if err := trashFile(cleanPath); err != nil {
-		log.Printf("❌ Delete failed: %v", err)
+	if err := deleteFile(cleanPath); err != nil {
+		message := "Failed to move file to Trash"
+		if os.IsNotExist(err) {
+			message = "File not found"
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to move file to Trash",
+			"error":   message,
 		})
 		return
 	}
 
-	log.Printf("🗑️ File moved to Trash: %s", req.FilePath)
-
-	// Remove file from in-memory state and cache
-	scanner.RemoveFileFromMemory(req.FilePath)
-
 	// Return success
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -437,6 +516,26 @@ func HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// deleteFile moves a file to Trash and removes it from the in-memory state and
+// cache. A missing file reports an error satisfying os.IsNotExist.
+func deleteFile(cleanPath string) error {
+	if _, err := os.Stat(cleanPath); os.IsNotExist(err) {
+		log.Printf("❌ Delete failed: file not found: %s", cleanPath)
+		return err
+	}
+
+	if err := trashFile(cleanPath); err != nil {
+		log.Printf("❌ Delete failed: %v", err)
+		return err
+	}
+
+	log.Printf("🗑️ File moved to Trash: %s", cleanPath)
+
+	// Remove file from in-memory state and cache
+	scanner.RemoveFileFromMemory(cleanPath)
+	return nil
+}
+
 // HandleMetadata returns EXIF and file metadata
 func HandleMetadata(w http.ResponseWriter, r *http.Request) {
 	// Read file path from query parameter (now always absolute)
@@ -446,7 +545,10 @@ func HandleMetadata(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cleanPath := filepath.Clean(absPath)
+	cleanPath, ok := confinePath(w, r, absPath)
+	if !ok {
+		return
+	}
 
 	meta, err := metadata.GetFileMetadata(cleanPath)
 	if err != nil {
@@ -454,6 +556,16 @@ func HandleMetadata(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, f := range state.GetCurrent().AllFiles {
+		if f.Path == cleanPath {
+			meta.Broken = f.BrokenReason
+			meta.Rating = f.Rating
+			meta.ColorLabel = f.ColorLabel
+			meta.ETag = scanner.FileETag(f)
+			break
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(meta)
 }
@@ -471,8 +583,10 @@ func HandleQuickLook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// FilePath is now always absolute
-	cleanPath := filepath.Clean(req.FilePath)
+	cleanPath, ok := confinePath(w, r, req.FilePath)
+	if !ok {
+		return
+	}
 
 	if _, err := os.Stat(cleanPath); os.IsNotExist(err) {
 		http.Error(w, "File not found", http.StatusNotFound)
@@ -495,7 +609,10 @@ func HandleConvert(w http.ResponseWriter, r *http.Request) {
 		absPath = "/" + absPath
 	}
 
-	cleanPath := filepath.Clean(absPath)
+	cleanPath, ok := confinePath(w, r, absPath)
+	if !ok {
+		return
+	}
 
 	ext := strings.ToLower(filepath.Ext(cleanPath))
 	if !config.ConvertibleExts[ext] {
@@ -521,6 +638,22 @@ func HandleConvert(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, htmlFile)
 }
 
+// invalidPathReport is a path that failed to load in the viewer, posted to
+// /api/log-invalid-path, or one the server refused (see confinePath)
+type invalidPathReport struct {
+	Path        string `json:"path"`
+	CurrentFile string `json:"currentFile"`
+	Category    string `json:"category"`
+	Status      int    `json:"status"`
+	Error       string `json:"error"`
+	Timestamp   string `json:"timestamp"`
+
+	// Set for refusals by the server
+	Endpoint string `json:"-"`
+	User     string `json:"-"`
+	Remote   string `json:"-"`
+}
+
 // HandleLogInvalidPath logs invalid file paths for debugging
 func HandleLogInvalidPath(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -528,20 +661,26 @@ func HandleLogInvalidPath(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var logData struct {
-		Path        string `json:"path"`
-		CurrentFile string `json:"currentFile"`
-		Category    string `json:"category"`
-		Status      int    `json:"status"`
-		Error       string `json:"error"`
-		Timestamp   string `json:"timestamp"`
-	}
-
+	var logData invalidPathReport
 	if err := json.NewDecoder(r.Body).Decode(&logData); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	logInvalidPath(logData)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// logInvalidPath writes an invalid path report to the server console
+func logInvalidPath(logData invalidPathReport) {
+	if logData.Endpoint != "" {
+		log.Printf("🚫 INVALID PATH: path=%s status=%d error=%s endpoint=%s user=%s remote=%s timestamp=%s",
+			logData.Path, logData.Status, logData.Error, logData.Endpoint, logData.User, logData.Remote, logData.Timestamp)
+		return
+	}
+
 	// Log to server console for debugging
 	log.Printf("❌ INVALID PATH: path=%s currentFile=%s category=%s status=%d error=%s timestamp=%s",
 		logData.Path, logData.CurrentFile, logData.Category, logData.Status, logData.Error, logData.Timestamp)
@@ -550,9 +689,6 @@ func HandleLogInvalidPath(w http.ResponseWriter, r *http.Request) {
 	// - Append to a dedicated invalid_paths.log file
 	// - Store in database for analytics
 	// - Send to monitoring service
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
 // HandleSaveDateDecision saves a user's decision for date correction
@@ -579,6 +715,11 @@ func HandleSaveDateDecision(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	cleanPath, ok := confinePath(w, r, req.FilePath)
+	if !ok {
+		return
+	}
+	req.FilePath = cleanPath
 
 	log.Printf("📝 ML TRAINING: Received decision '%s' for file: %s", req.Decision, req.FilePath)
 
@@ -616,6 +757,9 @@ func HandleSaveDateDecision(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		log.Printf("✅ ML TRAINING: Successfully saved decision '%s' to database", req.Decision)
+
+		// A corrected date (or an undone one) moves the file on the 🗓 timeline
+		scanner.RebuildIndex()
 	} else {
 		log.Printf("❌ ML TRAINING: Cache not available!")
 	}
@@ -648,32 +792,144 @@ func HandleGetDateStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
-// HandleScanProgress returns background freshness scanner progress
+// HandleScanProgress returns background freshness scanner progress, plus
+// per-stage progress of the most recent pipeline run of each kind. "pipeline"
+// is the foreground run (startup or rescan), never the background freshness run.
 func HandleScanProgress(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	freshnessScanner := scanner.GetFreshnessScanner()
-	if freshnessScanner == nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"checked":   0,
-			"total":     0,
-			"isRunning": false,
-		})
+	response := map[string]interface{}{
+		"checked":   0,
+		"total":     0,
+		"isRunning": false,
+	}
+
+	if freshnessScanner := scanner.GetFreshnessScanner(); freshnessScanner != nil {
+		checked, total := freshnessScanner.GetProgress()
+		response["checked"] = checked
+		response["total"] = total
+		response["isRunning"] = freshnessScanner.IsRunning()
+	}
+
+	pipelines := make(map[string]interface{})
+	var foreground *scanner.ScanProgress
+	for _, kind := range []string{"startup", "rescan", "freshness"} {
+		progress := scanner.GetScanProgress(kind)
+		if progress == nil {
+			continue
+		}
+		pipelines[kind] = map[string]interface{}{
+			"isRunning": progress.IsRunning(),
+			"startedAt": progress.StartedAt,
+			"stages":    progress.Stages(),
+		}
+		if kind != "freshness" && (foreground == nil || progress.StartedAt.After(foreground.StartedAt)) {
+			foreground = progress
+		}
+	}
+	if foreground != nil {
+		response["pipeline"] = map[string]interface{}{
+			"kind":      foreground.Kind,
+			"isRunning": foreground.IsRunning(),
+			"startedAt": foreground.StartedAt,
+			"stages":    foreground.Stages(),
+		}
+	}
+	if len(pipelines) > 0 {
+		response["pipelines"] = pipelines
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleIntegrity reports integrity validator progress and the number of
+// broken files (GET), or starts a pass over unchecked and changed files (POST)
+func HandleIntegrity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	validator := scanner.GetIntegrityValidator()
+	if validator == nil {
+		http.Error(w, "Integrity checking is disabled (--integrity-interval 0)", http.StatusServiceUnavailable)
+		return
+	}
+
+	started := false
+	if r.Method == http.MethodPost {
+		if state.IsScanning() || validator.IsRunning() {
+			http.Error(w, "A scan or integrity check is already running", http.StatusConflict)
+			return
+		}
+		go validator.Run()
+		started = true
+	}
+
+	checked, total := validator.GetProgress()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"started":    started,
+		"isRunning":  validator.IsRunning() || started,
+		"checked":    checked,
+		"total":      total,
+		"broken":     validator.Broken(),
+		"fullDecode": validator.FullDecode(),
+		"category":   scanner.BrokenCategory,
+	})
+}
+
+// HandleVolumes returns each volume in the library with its mount state and file count
+func HandleVolumes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"volumes": scanner.GetVolumes(),
+	})
+}
+
+// HandleRelocate rewrites a path prefix across the cache, ML database and
+// in-memory state, for a volume that came back at a new mount point
+func HandleRelocate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" || req.To == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	checked, total := freshnessScanner.GetProgress()
-	isRunning := freshnessScanner.IsRunning()
+	if state.IsScanning() {
+		http.Error(w, "Scan in progress", http.StatusConflict)
+		return
+	}
+
+	files, decisions, err := scanner.RelocatePrefix(req.From, req.To)
+	if err != nil {
+		log.Printf("❌ Relocation failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"checked":   checked,
-		"total":     total,
-		"isRunning": isRunning,
+		"success":   true,
+		"files":     files,
+		"decisions": decisions,
 	})
 }
 
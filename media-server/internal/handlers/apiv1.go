@@ -0,0 +1,864 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/auth"
+	"github.com/tdsanchez/PostMac/internal/config"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/persistence"
+	"github.com/tdsanchez/PostMac/internal/scanner"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// The /api/v1 surface gives scripts and the corpus/publisher tools stable
+// resource shapes: every response is {"data": ...} (plus "page" for lists) or
+// {"error": {...}}, lists are paginated, and files can be trimmed to the
+// fields a caller needs. The unversioned /api/* routes keep their shapes for
+// the built-in pages.
+
+// APIV1Prefix is the path prefix of the versioned API
+const APIV1Prefix = "/api/v1/"
+
+// Pagination defaults for list endpoints
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// v1Error is the body of every error response: {"error": {...}}
+type v1Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// v1Page describes the slice of a list returned in one response
+type v1Page struct {
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	Total  int    `json:"total"`
+	Next   string `json:"next,omitempty"` // URL of the following page
+}
+
+// v1Params are the path parameters matched by a route, e.g. {id}
+type v1Params map[string]string
+
+// v1Operation is one method on a route. The documentation fields feed the
+// generated OpenAPI description (see openAPIDocument).
+type v1Operation struct {
+	handler  func(w http.ResponseWriter, r *http.Request, p v1Params)
+	id       string   // operationId
+	summary  string   // One-line description
+	query    []string // Query parameters, named as in openAPIParameters
+	body     string   // Request body schema, "" for none
+	response string   // Response data schema, "" for 204 No Content
+	list     bool     // Response data is a paginated array of response
+	raw      bool     // Response is written as is, without the data envelope
+	ifMatch  bool     // Honours If-Match with the file's ETag (409 when stale)
+	role     string   // Minimum role; "" is viewer for GET and tagger otherwise
+}
+
+// requiredRole is the minimum role for the operation under method
+func (op v1Operation) requiredRole(method string) string {
+	switch {
+	case op.role != "":
+		return op.role
+	case method == http.MethodGet || method == http.MethodHead:
+		return auth.RoleViewer
+	default:
+		return auth.RoleTagger
+	}
+}
+
+// v1Route is a path pattern (segments, {name} capturing one) with its methods
+type v1Route struct {
+	pattern string
+	methods map[string]v1Operation
+}
+
+// v1Routes is populated in init: the OpenAPI handler reads the table, which
+// would otherwise be an initialization cycle
+var v1Routes []v1Route
+
+func init() {
+	v1Routes = []v1Route{
+		{"openapi.json", map[string]v1Operation{
+			http.MethodGet: {handler: v1OpenAPI, id: "getOpenAPI", summary: "This OpenAPI description", response: "OpenAPI", raw: true},
+		}},
+		{"files", map[string]v1Operation{
+			http.MethodGet: {handler: v1ListFiles, id: "listFiles", summary: "List files, optionally in a category, matching a search, or by path",
+				query: []string{"category", "q", "path", "sort", "fields", "offset", "limit"}, response: "File", list: true},
+		}},
+		{"files/{id}", map[string]v1Operation{
+			http.MethodGet:    {handler: v1GetFile, id: "getFile", summary: "Get a file", query: []string{"fields"}, response: "File"},
+			http.MethodPatch:  {handler: v1PatchFile, id: "updateFile", summary: "Update a file's tags, comment, rating or color label", body: "FilePatch", response: "File", ifMatch: true},
+			http.MethodDelete: {handler: v1DeleteFile, id: "deleteFile", summary: "Move a file to the Trash", ifMatch: true, role: auth.RoleAdmin},
+		}},
+		{"files/{id}/tags", map[string]v1Operation{
+			http.MethodGet:  {handler: v1GetFileTags, id: "getFileTags", summary: "Get a file's tags", response: "TagList"},
+			http.MethodPost: {handler: v1AddFileTags, id: "addFileTags", summary: "Add tags to a file", body: "TagEdit", response: "TagList", ifMatch: true},
+			http.MethodPut:  {handler: v1ReplaceFileTags, id: "replaceFileTags", summary: "Replace a file's tags", body: "TagEdit", response: "TagList", ifMatch: true},
+		}},
+		{"files/{id}/tags/{tag}", map[string]v1Operation{
+			http.MethodDelete: {handler: v1RemoveFileTag, id: "removeFileTag", summary: "Remove a tag from a file", response: "TagList", ifMatch: true},
+		}},
+		{"tags", map[string]v1Operation{
+			http.MethodGet: {handler: v1ListTags, id: "listTags", summary: "List tags with file counts", query: []string{"offset", "limit"}, response: "Tag", list: true},
+		}},
+		{"tags/{name}", map[string]v1Operation{
+			http.MethodGet: {handler: v1GetTag, id: "getTag", summary: "Get a tag", response: "Tag"},
+		}},
+		{"tags/{name}/files", map[string]v1Operation{
+			http.MethodGet: {handler: v1CategoryFiles, id: "listTagFiles", summary: "List the files with a tag",
+				query: []string{"sort", "fields", "offset", "limit"}, response: "File", list: true},
+		}},
+		{"categories", map[string]v1Operation{
+			http.MethodGet: {handler: v1ListCategories, id: "listCategories", summary: "List categories (tags, types, folders and synthetic views)",
+				query: []string{"kind", "offset", "limit"}, response: "Category", list: true},
+		}},
+		{"categories/{name}", map[string]v1Operation{
+			http.MethodGet: {handler: v1GetCategory, id: "getCategory", summary: "Get a category", response: "Category"},
+		}},
+		{"categories/{name}/files", map[string]v1Operation{
+			http.MethodGet: {handler: v1CategoryFiles, id: "listCategoryFiles", summary: "List the files in a category, in category order",
+				query: []string{"sort", "fields", "offset", "limit"}, response: "File", list: true},
+		}},
+		{"searches", map[string]v1Operation{
+			http.MethodGet: {handler: v1Search, id: "search", summary: "Run a boolean search query",
+				query: []string{"q", "sort", "fields", "offset", "limit"}, response: "File", list: true},
+			http.MethodPost: {handler: v1Search, id: "searchPost", summary: "Run a boolean search query given in the body",
+				query: []string{"sort", "fields", "offset", "limit"}, body: "SearchRequest", response: "File", list: true},
+		}},
+	}
+}
+
+// HandleAPIV1 routes every /api/v1/ request through v1Routes
+func HandleAPIV1(w http.ResponseWriter, r *http.Request) {
+	segments, err := v1Segments(r)
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, route := range v1Routes {
+		params, ok := matchV1Route(route.pattern, segments)
+		if !ok {
+			continue
+		}
+		op, ok := route.methods[r.Method]
+		if !ok {
+			w.Header().Set("Allow", strings.Join(sortedMethods(route.methods), ", "))
+			writeV1Error(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not supported on this resource", r.Method))
+			return
+		}
+		if role := op.requiredRole(r.Method); !auth.Allowed(r, role) {
+			writeV1Error(w, http.StatusForbidden, "Requires the "+role+" role")
+			return
+		}
+		op.handler(w, r, params)
+		return
+	}
+	writeV1Error(w, http.StatusNotFound, "No such resource")
+}
+
+// v1Segments splits the path after /api/v1/ into unescaped segments, so
+// category names containing "/" can be sent as %2F
+func v1Segments(r *http.Request) ([]string, error) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), strings.TrimSuffix(APIV1Prefix, "/"))
+	rest = strings.Trim(rest, "/")
+	if rest == "" {
+		return nil, nil
+	}
+	parts := strings.Split(rest, "/")
+	for i, part := range parts {
+		s, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path segment %q", part)
+		}
+		parts[i] = s
+	}
+	return parts, nil
+}
+
+// matchV1Route matches path segments against a pattern, capturing {name} segments
+func matchV1Route(pattern string, segments []string) (v1Params, bool) {
+	parts := strings.Split(pattern, "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	params := v1Params{}
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") {
+			params[strings.Trim(part, "{}")] = segments[i]
+		} else if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// sortedMethods lists a route's methods for the Allow header
+func sortedMethods(methods map[string]v1Operation) []string {
+	list := make([]string, 0, len(methods))
+	for m := range methods {
+		list = append(list, m)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// writeV1JSON writes a JSON body without HTML escaping, so next-page URLs
+// keep their & separators
+func writeV1JSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(body)
+}
+
+// writeV1 writes a {"data": ...} response
+func writeV1(w http.ResponseWriter, status int, data interface{}) {
+	writeV1JSON(w, status, map[string]interface{}{"data": data})
+}
+
+// writeV1Error writes an {"error": {...}} response; the code is derived from the status
+func writeV1Error(w http.ResponseWriter, status int, message string) {
+	codes := map[int]string{
+		http.StatusBadRequest:          "bad_request",
+		http.StatusNotFound:            "not_found",
+		http.StatusMethodNotAllowed:    "method_not_allowed",
+		http.StatusConflict:            "conflict",
+		http.StatusServiceUnavailable:  "unavailable",
+		http.StatusInternalServerError: "internal",
+	}
+	code, ok := codes[status]
+	if !ok {
+		code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	writeV1JSON(w, status, map[string]interface{}{
+		"error": v1Error{Status: status, Code: code, Message: message},
+	})
+}
+
+// decodeV1Body reads a JSON request body, writing the error response on failure
+func decodeV1Body(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeV1Error(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// ============================================================================
+// Pagination and field selection
+// ============================================================================
+
+// parsePage reads ?offset= and ?limit=
+func parsePage(r *http.Request) (offset, limit int, err error) {
+	offset, limit = 0, defaultPageLimit
+	q := r.URL.Query()
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+// pageBounds returns the slice bounds of a page of total items and its description
+func pageBounds(r *http.Request, total, offset, limit int) (start, end int, page v1Page) {
+	start = offset
+	if start > total {
+		start = total
+	}
+	end = start + limit
+	if end > total {
+		end = total
+	}
+	page = v1Page{Offset: offset, Limit: limit, Total: total}
+	if end < total {
+		next := *r.URL
+		q := next.Query()
+		q.Set("offset", strconv.Itoa(end))
+		q.Set("limit", strconv.Itoa(limit))
+		next.RawQuery = q.Encode()
+		page.Next = next.RequestURI()
+	}
+	return start, end, page
+}
+
+// writeV1Page writes one page of items; items must be a slice already cut to the page
+func writeV1Page(w http.ResponseWriter, items interface{}, page v1Page) {
+	writeV1JSON(w, http.StatusOK, map[string]interface{}{
+		"data": items,
+		"page": page,
+	})
+}
+
+// fileFields are the fields of the v1 File resource
+var fileFields = []string{
+	"id", "path", "name", "relPath", "type", "tags", "comment", "size",
+	"created", "modified", "earliestDate", "timelineDate", "needsDateCorrection",
+	"timezoneMismatch", "location", "rating", "colorLabel", "volume", "offline", "broken", "etag",
+}
+
+// parseFields reads ?fields=a,b (nil means every field)
+func parseFields(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(fileFields))
+	for _, f := range fileFields {
+		known[f] = true
+	}
+	var fields []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !known[f] {
+			return nil, fmt.Errorf("unknown field %q (fields: %s)", f, strings.Join(fileFields, ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// fileID returns the opaque id of a file: its path, base64url-encoded so it
+// fits in one path segment
+func fileID(path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(path))
+}
+
+// fileResource returns the v1 representation of a file, limited to fields
+// when given
+func fileResource(f models.FileInfo, fields []string) map[string]interface{} {
+	optionalTime := func(t time.Time) interface{} {
+		if t.IsZero() {
+			return nil
+		}
+		return t
+	}
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	all := map[string]interface{}{
+		"id":                  fileID(f.Path),
+		"path":                f.Path,
+		"name":                f.Name,
+		"relPath":             f.RelPath,
+		"type":                config.GetFileTypeCategory(f.Name),
+		"tags":                tags,
+		"comment":             f.Comment,
+		"size":                f.Size,
+		"created":             optionalTime(f.Created),
+		"modified":            optionalTime(f.OSModTime),
+		"earliestDate":        optionalTime(f.EarliestDate),
+		"timelineDate":        optionalTime(f.TimelineDate),
+		"needsDateCorrection": f.NeedsDateCorrection,
+		"timezoneMismatch":    f.TimezoneMismatch,
+		"location":            f.Location,
+		"rating":              f.Rating,
+		"colorLabel":          f.ColorLabel,
+		"volume":              f.Volume,
+		"offline":             f.Offline,
+		"broken":              f.BrokenReason,
+		"etag":                scanner.FileETag(f),
+	}
+	if fields == nil {
+		return all
+	}
+	selected := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		selected[f] = all[f]
+	}
+	return selected
+}
+
+// writeFilePage sorts (a copy of) files per ?sort= and writes the requested page
+func writeFilePage(w http.ResponseWriter, r *http.Request, files []models.FileInfo) {
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r)
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// ?sort=name, or ?sort=-name for descending; modes as in the gallery
+	if mode := r.URL.Query().Get("sort"); mode != "" {
+		reversed := strings.HasPrefix(mode, "-")
+		mode = strings.TrimPrefix(mode, "-")
+		switch mode {
+		case "name", "date", "size", "os_birth", "os_mod", "exif_create", "exif_modify", "rating", "random":
+		default:
+			writeV1Error(w, http.StatusBadRequest, fmt.Sprintf("unknown sort %q", mode))
+			return
+		}
+		sorted := make([]models.FileInfo, len(files))
+		copy(sorted, files)
+		sortFiles(sorted, mode, reversed)
+		files = sorted
+	}
+
+	start, end, page := pageBounds(r, len(files), offset, limit)
+	items := make([]map[string]interface{}, 0, end-start)
+	for _, f := range files[start:end] {
+		items = append(items, fileResource(f, fields))
+	}
+	writeV1Page(w, items, page)
+}
+
+// ============================================================================
+// Files
+// ============================================================================
+
+// lookupV1File resolves the {id} of a files/{id} route to an indexed file,
+// writing the error response when it is not one
+func lookupV1File(w http.ResponseWriter, p v1Params) (models.FileInfo, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(p["id"])
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, "Invalid file id")
+		return models.FileInfo{}, false
+	}
+	if f, ok := findFile(string(raw)); ok {
+		return f, true
+	}
+	writeV1Error(w, http.StatusNotFound, "File not found")
+	return models.FileInfo{}, false
+}
+
+// editV1File resolves the {id} of a files/{id} route for an edit, rejecting
+// it with 409 and the current file when If-Match names an older revision.
+// Callers hold fileEditMu, so the check and the edit are one step.
+func editV1File(w http.ResponseWriter, r *http.Request, p v1Params) (models.FileInfo, bool) {
+	f, ok := lookupV1File(w, p)
+	if !ok {
+		return f, false
+	}
+	if !scanner.ETagMatches(f, r.Header.Get("If-Match")) {
+		w.Header().Set("ETag", `"`+scanner.FileETag(f)+`"`)
+		writeV1JSON(w, http.StatusConflict, map[string]interface{}{
+			"error":   v1Error{Status: http.StatusConflict, Code: "conflict", Message: "File was changed since it was loaded"},
+			"current": fileResource(f, nil),
+		})
+		return f, false
+	}
+	return f, true
+}
+
+// setETagHeader sets the ETag header to a file's revision after an edit
+func setETagHeader(w http.ResponseWriter, path string) {
+	if etag := currentETag(path); etag != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+}
+
+// findFile returns an indexed file by absolute path
+func findFile(path string) (models.FileInfo, bool) {
+	return indexedFile(filepath.Clean(path))
+}
+
+func v1ListFiles(w http.ResponseWriter, r *http.Request, _ v1Params) {
+	if path := r.URL.Query().Get("path"); path != "" {
+		f, ok := findFile(path)
+		if !ok {
+			writeFilePage(w, r, nil)
+			return
+		}
+		writeFilePage(w, r, []models.FileInfo{f})
+		return
+	}
+
+	query, category := r.URL.Query().Get("q"), r.URL.Query().Get("category")
+	files := state.GetCurrent().FilesByTag["All"]
+	switch {
+	case query != "":
+		results, err := HandleSearchQuery(query)
+		if err != nil {
+			writeV1Error(w, http.StatusBadRequest, "Search query failed: "+err.Error())
+			return
+		}
+		files = results
+	case category != "":
+		var ok bool
+		if files, ok = state.GetCurrent().FilesByTag[category]; !ok {
+			writeV1Error(w, http.StatusNotFound, "Category not found")
+			return
+		}
+	}
+	writeFilePage(w, r, files)
+}
+
+func v1GetFile(w http.ResponseWriter, r *http.Request, p v1Params) {
+	f, ok := lookupV1File(w, p)
+	if !ok {
+		return
+	}
+	fields, err := parseFields(r)
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("ETag", `"`+scanner.FileETag(f)+`"`)
+	writeV1(w, http.StatusOK, fileResource(f, fields))
+}
+
+// v1FilePatch is the body of PATCH files/{id}; omitted fields are unchanged
+type v1FilePatch struct {
+	Tags       *[]string `json:"tags"`
+	Comment    *string   `json:"comment"`
+	Rating     *int      `json:"rating"`
+	ColorLabel *string   `json:"colorLabel"`
+}
+
+func v1PatchFile(w http.ResponseWriter, r *http.Request, p v1Params) {
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+	f, ok := editV1File(w, r, p)
+	if !ok {
+		return
+	}
+	var patch v1FilePatch
+	if !decodeV1Body(w, r, &patch) {
+		return
+	}
+
+	// Rating first: a bad value is rejected before anything else changes
+	if patch.Rating != nil || patch.ColorLabel != nil {
+		if _, err := applyRating([]string{f.Path}, patch.Rating, patch.ColorLabel); err != nil {
+			writeV1Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if patch.Tags != nil {
+		setFileTags(f.Path, cleanTags(*patch.Tags))
+	}
+	if patch.Comment != nil && *patch.Comment != f.Comment {
+		if err := applyComment(f.Path, *patch.Comment); err != nil {
+			writeV1Error(w, http.StatusInternalServerError, "Failed to update comment: "+err.Error())
+			return
+		}
+	}
+
+	updated, _ := findFile(f.Path)
+	w.Header().Set("ETag", `"`+scanner.FileETag(updated)+`"`)
+	writeV1(w, http.StatusOK, fileResource(updated, nil))
+}
+
+func v1DeleteFile(w http.ResponseWriter, r *http.Request, p v1Params) {
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+	f, ok := editV1File(w, r, p)
+	if !ok {
+		return
+	}
+	if err := deleteFile(f.Path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeV1Error(w, http.StatusNotFound, "File not found on disk")
+			return
+		}
+		writeV1Error(w, http.StatusInternalServerError, "Failed to move file to Trash: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================================
+// File tags
+// ============================================================================
+
+// v1TagEdit is the body of POST and PUT files/{id}/tags
+type v1TagEdit struct {
+	Tag  string   `json:"tag"`
+	Tags []string `json:"tags"`
+}
+
+// setFileTags replaces a file's tags in memory and queues the disk write, as
+// the tag handlers do
+func setFileTags(path string, tags []string) {
+	scanner.UpdateFileTagsInMemory(path, tags)
+	persistence.QueueDiskWrite(path, tags)
+}
+
+// cleanTags trims tags and drops empty and repeated ones, keeping order
+func cleanTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	clean := []string{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			clean = append(clean, t)
+		}
+	}
+	return clean
+}
+
+func v1GetFileTags(w http.ResponseWriter, r *http.Request, p v1Params) {
+	f, ok := lookupV1File(w, p)
+	if !ok {
+		return
+	}
+	writeV1(w, http.StatusOK, cleanTags(f.Tags))
+}
+
+func v1AddFileTags(w http.ResponseWriter, r *http.Request, p v1Params) {
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+	f, ok := editV1File(w, r, p)
+	if !ok {
+		return
+	}
+	var edit v1TagEdit
+	if !decodeV1Body(w, r, &edit) {
+		return
+	}
+	added := cleanTags(append([]string{edit.Tag}, edit.Tags...))
+	if len(added) == 0 {
+		writeV1Error(w, http.StatusBadRequest, "tag or tags is required")
+		return
+	}
+
+	tags := cleanTags(append(append([]string{}, f.Tags...), added...))
+	if len(tags) != len(f.Tags) {
+		setFileTags(f.Path, tags)
+	}
+	setETagHeader(w, f.Path)
+	writeV1(w, http.StatusOK, tags)
+}
+
+func v1ReplaceFileTags(w http.ResponseWriter, r *http.Request, p v1Params) {
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+	f, ok := editV1File(w, r, p)
+	if !ok {
+		return
+	}
+	var edit v1TagEdit
+	if !decodeV1Body(w, r, &edit) {
+		return
+	}
+	tags := cleanTags(edit.Tags)
+	setFileTags(f.Path, tags)
+	setETagHeader(w, f.Path)
+	writeV1(w, http.StatusOK, tags)
+}
+
+func v1RemoveFileTag(w http.ResponseWriter, r *http.Request, p v1Params) {
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+	f, ok := editV1File(w, r, p)
+	if !ok {
+		return
+	}
+	tags := []string{}
+	for _, t := range f.Tags {
+		if t != p["tag"] {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == len(f.Tags) {
+		writeV1Error(w, http.StatusNotFound, "The file does not have that tag")
+		return
+	}
+	setFileTags(f.Path, tags)
+	setETagHeader(w, f.Path)
+	writeV1(w, http.StatusOK, tags)
+}
+
+// ============================================================================
+// Tags and categories
+// ============================================================================
+
+// v1Tag is the v1 Tag resource
+type v1Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// v1Category is the v1 Category resource
+type v1Category struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+}
+
+// categoryKinds are the values of Category.kind, see categoryKind
+var categoryKinds = []string{"all", "tag", "type", "folder", "timeline", "rating", "label", "collection", "location", "system"}
+
+// categoryKind classifies a category by its name
+func categoryKind(name string, tags map[string]bool) string {
+	switch {
+	case name == "All":
+		return "all"
+	case tags[name]:
+		return "tag"
+	case strings.HasPrefix(name, "📁 "):
+		return "folder"
+	case strings.HasPrefix(name, scanner.TimelinePrefix):
+		return "timeline"
+	case strings.HasPrefix(name, scanner.RatingPrefix):
+		return "rating"
+	case strings.HasPrefix(name, scanner.LabelPrefix):
+		return "label"
+	case strings.HasPrefix(name, scanner.CollectionPrefix):
+		return "collection"
+	case strings.HasPrefix(name, "📍 "):
+		return "location"
+	case containsString(typeCategories, name):
+		return "type"
+	}
+	return "system"
+}
+
+// typeCategories are the categories config.GetFileTypeCategory files by
+var typeCategories = []string{"📷 Images", "🎬 Videos", "📄 PDFs", "📝 Text Files", "🌐 HTML", "📃 Documents", "📦 Other"}
+
+// tagSet returns the user tags as a set
+func tagSet() map[string]bool {
+	tags := state.GetCurrent().AllTags
+	set := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		set[t] = true
+	}
+	return set
+}
+
+func v1ListTags(w http.ResponseWriter, r *http.Request, _ v1Params) {
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	current := state.GetCurrent()
+	start, end, page := pageBounds(r, len(current.AllTags), offset, limit)
+	tags := make([]v1Tag, 0, end-start)
+	for _, name := range current.AllTags[start:end] {
+		tags = append(tags, v1Tag{Name: name, Count: len(current.FilesByTag[name])})
+	}
+	writeV1Page(w, tags, page)
+}
+
+func v1GetTag(w http.ResponseWriter, r *http.Request, p v1Params) {
+	name := p["name"]
+	if !tagSet()[name] {
+		writeV1Error(w, http.StatusNotFound, "Tag not found")
+		return
+	}
+	writeV1(w, http.StatusOK, v1Tag{Name: name, Count: len(state.GetCurrent().FilesByTag[name])})
+}
+
+func v1ListCategories(w http.ResponseWriter, r *http.Request, _ v1Params) {
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && !containsString(categoryKinds, kind) {
+		writeV1Error(w, http.StatusBadRequest, fmt.Sprintf("unknown kind %q (kinds: %s)", kind, strings.Join(categoryKinds, ", ")))
+		return
+	}
+
+	current := state.GetCurrent()
+	tags := tagSet()
+	categories := make([]v1Category, 0, len(current.FilesByTag))
+	for name, files := range current.FilesByTag {
+		c := v1Category{Name: name, Kind: categoryKind(name, tags), Count: len(files)}
+		if kind == "" || c.Kind == kind {
+			categories = append(categories, c)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+
+	start, end, page := pageBounds(r, len(categories), offset, limit)
+	writeV1Page(w, categories[start:end], page)
+}
+
+func v1GetCategory(w http.ResponseWriter, r *http.Request, p v1Params) {
+	name := p["name"]
+	files, ok := state.GetCurrent().FilesByTag[name]
+	if !ok {
+		writeV1Error(w, http.StatusNotFound, "Category not found")
+		return
+	}
+	writeV1(w, http.StatusOK, v1Category{Name: name, Kind: categoryKind(name, tagSet()), Count: len(files)})
+}
+
+// v1CategoryFiles serves categories/{name}/files and tags/{name}/files
+func v1CategoryFiles(w http.ResponseWriter, r *http.Request, p v1Params) {
+	files, ok := state.GetCurrent().FilesByTag[p["name"]]
+	if !ok {
+		writeV1Error(w, http.StatusNotFound, "Category not found")
+		return
+	}
+	writeFilePage(w, r, files)
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================
+// Searches
+// ============================================================================
+
+// v1SearchRequest is the body of POST searches
+type v1SearchRequest struct {
+	Query string `json:"query"`
+}
+
+func v1Search(w http.ResponseWriter, r *http.Request, _ v1Params) {
+	query := r.URL.Query().Get("q")
+	if r.Method == http.MethodPost {
+		var req v1SearchRequest
+		if !decodeV1Body(w, r, &req) {
+			return
+		}
+		query = req.Query
+	}
+	if strings.TrimSpace(query) == "" {
+		writeV1Error(w, http.StatusBadRequest, "A search query is required")
+		return
+	}
+
+	results, err := HandleSearchQuery(query)
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, "Search query failed: "+err.Error())
+		return
+	}
+	writeFilePage(w, r, results)
+}
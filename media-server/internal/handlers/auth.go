@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/auth"
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// HandleLogin shows the login form and starts a session from it
+func HandleLogin(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.FormValue("next"))
+	if !auth.Enabled() {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Next  string
+		Name  string
+		Error string
+	}{Next: next}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		data.Name = r.FormValue("name")
+		id, err := auth.Login(w, r, data.Name, r.FormValue("password"))
+		if err == nil {
+			auth.Audit(r, id.User, id.Role, http.StatusSeeOther, "login")
+			log.Printf("🔐 %s logged in from %s", id.User, r.RemoteAddr)
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			log.Printf("❌ Login failed: %v", err)
+			http.Error(w, "Login unavailable", http.StatusInternalServerError)
+			return
+		}
+		auth.Audit(r, data.Name, "", http.StatusUnauthorized, "login failed")
+		log.Printf("🔒 Failed login for %q from %s", data.Name, r.RemoteAddr)
+		// Slow down password guessing
+		time.Sleep(time.Second)
+		data.Error = "Wrong user name or password"
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	templateContent, err := embeddedFiles.ReadFile("login_template.html")
+	if err != nil {
+		http.Error(w, "Template file not found", http.StatusInternalServerError)
+		return
+	}
+	tmpl, err := template.New("login").Parse(string(templateContent))
+	if err != nil {
+		log.Printf("Template parse error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Template execute error: %v", err)
+	}
+}
+
+// HandleLogout ends the browser session
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id := auth.FromRequest(r); id != nil && id.User != "" {
+		log.Printf("🔐 %s logged out", id.User)
+	}
+	auth.Logout(w, r)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// safeNext keeps post-login redirects on this server
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// HandleWhoAmI returns the identity the request acts as
+func HandleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"authEnabled": auth.Enabled(),
+		"identity":    auth.FromRequest(r),
+		"roles":       auth.Roles,
+		"csrfToken":   auth.CSRFToken(r),
+	})
+}
+
+// csrfScript adds a session's CSRF token to the page's same-origin fetch
+// writes and POST forms; %[1]s is the token
+const csrfScript = `<meta name="csrf-token" content="%[1]s">
+	<script>
+	(function() {
+		const token = '%[1]s';
+		const sameOrigin = url => new URL(url, location.href).origin === location.origin;
+		const plainFetch = window.fetch;
+		window.fetch = function(input, init) {
+			init = init || {};
+			const isRequest = input instanceof Request;
+			const method = (init.method || (isRequest ? input.method : 'GET')).toUpperCase();
+			if (method !== 'GET' && method !== 'HEAD' && sameOrigin(isRequest ? input.url : String(input))) {
+				const headers = new Headers(init.headers || (isRequest ? input.headers : undefined));
+				headers.set('%[2]s', token);
+				init = Object.assign({}, init, { headers: headers });
+			}
+			return plainFetch.call(this, input, init);
+		};
+		document.addEventListener('submit', function(e) {
+			const form = e.target;
+			if (form.method.toLowerCase() === 'post' && sameOrigin(form.action) && !form.elements['%[3]s']) {
+				const field = document.createElement('input');
+				field.type = 'hidden';
+				field.name = '%[3]s';
+				field.value = token;
+				form.appendChild(field);
+			}
+		}, true);
+	})();
+	</script>`
+
+// csrfHead returns the markup pages put in <head> so their writes carry the
+// session's CSRF token (nothing without a session)
+func csrfHead(r *http.Request) template.HTML {
+	token := auth.CSRFToken(r)
+	if token == "" {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(csrfScript, token, auth.CSRFHeader, auth.CSRFField))
+}
+
+// ============================================================================
+// Users (admin)
+// ============================================================================
+
+// HandleListUsers lists the user accounts
+func HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := authStore(w)
+	if !ok {
+		return
+	}
+	users, err := c.Users()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"users": users})
+}
+
+// HandleCreateUser adds an account; the first one turns authentication on
+func HandleCreateUser(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeUserOperation(w, r)
+	if !ok {
+		return
+	}
+	if op.Role == "" {
+		op.Role = auth.RoleViewer
+	}
+	if !auth.ValidRole(op.Role) {
+		http.Error(w, "role must be one of "+strings.Join(auth.Roles, ", "), http.StatusBadRequest)
+		return
+	}
+	// The first account must be able to manage the others
+	if !auth.Enabled() && op.Role != auth.RoleAdmin {
+		http.Error(w, "The first user must be an admin", http.StatusBadRequest)
+		return
+	}
+	hash, err := auth.HashPassword(op.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.CreateUser(op.Name, hash, op.Role); err != nil {
+		userError(w, err)
+		return
+	}
+	log.Printf("👤 Created %s user %q", op.Role, op.Name)
+	userChanged(w)
+}
+
+// HandleUpdateUser changes an account's password and/or role
+func HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeUserOperation(w, r)
+	if !ok {
+		return
+	}
+	if op.Role != "" {
+		if !auth.ValidRole(op.Role) {
+			http.Error(w, "role must be one of "+strings.Join(auth.Roles, ", "), http.StatusBadRequest)
+			return
+		}
+		if op.Role != auth.RoleAdmin && !otherAdminExists(w, c, op.Name) {
+			return
+		}
+		if err := c.SetUserRole(op.Name, op.Role); err != nil {
+			userError(w, err)
+			return
+		}
+	}
+	if op.Password != "" {
+		hash, err := auth.HashPassword(op.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetUserPassword(op.Name, hash); err != nil {
+			userError(w, err)
+			return
+		}
+	}
+	log.Printf("👤 Updated user %q", op.Name)
+	userChanged(w)
+}
+
+// HandleDeleteUser removes an account with its sessions and tokens
+func HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeUserOperation(w, r)
+	if !ok {
+		return
+	}
+	if !otherAdminExists(w, c, op.Name) {
+		return
+	}
+	if err := c.DeleteUser(op.Name); err != nil {
+		userError(w, err)
+		return
+	}
+	log.Printf("👤 Deleted user %q", op.Name)
+	userChanged(w)
+}
+
+// decodeUserOperation reads a POSTed UserOperation that names a user
+func decodeUserOperation(w http.ResponseWriter, r *http.Request) (models.UserOperation, *cache.Cache, bool) {
+	var op models.UserOperation
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return op, nil, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return op, nil, false
+	}
+	op.Name = strings.TrimSpace(op.Name)
+	if op.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return op, nil, false
+	}
+	c, ok := authStore(w)
+	return op, c, ok
+}
+
+// otherAdminExists refuses to demote or delete the last admin while other
+// accounts remain, which would leave nobody able to manage them
+func otherAdminExists(w http.ResponseWriter, c *cache.Cache, name string) bool {
+	users, err := c.Users()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	others := 0
+	for _, u := range users {
+		if u.Name == name {
+			continue
+		}
+		others++
+		if u.Role == auth.RoleAdmin {
+			return true
+		}
+	}
+	if others == 0 {
+		return true
+	}
+	http.Error(w, "At least one admin is required", http.StatusConflict)
+	return false
+}
+
+// authStore returns the cache DB accounts are stored in
+func authStore(w http.ResponseWriter) (*cache.Cache, bool) {
+	c := auth.Store()
+	if c == nil {
+		http.Error(w, "Accounts require the cache database", http.StatusServiceUnavailable)
+	}
+	return c, c != nil
+}
+
+// userError maps account errors to HTTP statuses
+func userError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cache.ErrUserNotFound), errors.Is(err, cache.ErrTokenNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, cache.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// userChanged re-reads whether authentication is on and responds with the accounts
+func userChanged(w http.ResponseWriter) {
+	if err := auth.Refresh(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	users, err := auth.Store().Users()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"authEnabled": auth.Enabled(),
+		"users":       users,
+	})
+}
+
+// ============================================================================
+// API tokens
+// ============================================================================
+
+// HandleListTokens lists the caller's API tokens; admins pass ?all=1 for everyone's
+func HandleListTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := authStore(w)
+	if !ok {
+		return
+	}
+	user := tokenOwner(r)
+	if r.URL.Query().Get("all") == "1" && auth.Allowed(r, auth.RoleAdmin) {
+		user = ""
+	}
+	tokens, err := c.APITokens(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens})
+}
+
+// HandleCreateToken issues a bearer token for the caller, at most at their
+// role and optionally limited to a scope. The secret is in the response
+// only; it cannot be shown again.
+func HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	op, ok := decodeTokenOperation(w, r)
+	if !ok {
+		return
+	}
+	id := auth.FromRequest(r)
+	if id == nil || id.User == "" {
+		http.Error(w, "Create a user account first (media-server users add)", http.StatusConflict)
+		return
+	}
+	if id.Token != "" {
+		http.Error(w, "Tokens can only be created from a login session", http.StatusForbidden)
+		return
+	}
+	if op.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if op.Role == "" {
+		op.Role = id.Role
+	}
+	if !auth.ValidRole(op.Role) || !auth.Allows(id.Role, op.Role) {
+		http.Error(w, "role must be a known role no higher than your own", http.StatusBadRequest)
+		return
+	}
+	if !auth.ValidScope(op.Scope) {
+		http.Error(w, "scope must be empty or one of "+strings.Join(auth.Scopes, ", "), http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if op.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(op.ExpiresIn); err != nil || ttl <= 0 {
+			http.Error(w, "expiresIn must be a positive duration such as 720h", http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret, tokenID, err := auth.CreateToken(auth.Store(), id.User, op.Name, op.Role, op.Scope, ttl)
+	if err != nil {
+		userError(w, err)
+		return
+	}
+	log.Printf("🔑 %s created %s token %q", id.User, op.Role, op.Name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      tokenID,
+		"name":    op.Name,
+		"role":    op.Role,
+		"scope":   op.Scope,
+		"token":   secret,
+	})
+}
+
+// HandleRevokeToken deletes one of the caller's tokens (any token for admins)
+func HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	op, ok := decodeTokenOperation(w, r)
+	if !ok {
+		return
+	}
+	c, ok := authStore(w)
+	if !ok {
+		return
+	}
+	user := tokenOwner(r)
+	if auth.Allowed(r, auth.RoleAdmin) {
+		user = ""
+	}
+	if err := c.RevokeAPIToken(op.ID, user); err != nil {
+		userError(w, err)
+		return
+	}
+	log.Printf("🔑 Revoked token %d", op.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// decodeTokenOperation reads a POSTed TokenOperation
+func decodeTokenOperation(w http.ResponseWriter, r *http.Request) (models.TokenOperation, bool) {
+	var op models.TokenOperation
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return op, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return op, false
+	}
+	op.Name = strings.TrimSpace(op.Name)
+	return op, true
+}
+
+// tokenOwner is the user whose tokens a request may see and revoke
+func tokenOwner(r *http.Request) string {
+	if id := auth.FromRequest(r); id != nil {
+		return id.User
+	}
+	return ""
+}
+
+// ============================================================================
+// Audit log (admin)
+// ============================================================================
+
+// HandleAuditLog returns the newest audit entries (?limit=, default 200;
+// ?user= for one account)
+func HandleAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := authStore(w)
+	if !ok {
+		return
+	}
+	limit := 200
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	entries, err := c.AuditLog(limit, r.URL.Query().Get("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+}
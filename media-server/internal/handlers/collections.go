@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/scanner"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// HandleListCollections returns every collection's name, description and item count
+func HandleListCollections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := collectionCache(w)
+	if !ok {
+		return
+	}
+
+	collections, err := c.Collections()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type summary struct {
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		Category    string    `json:"category"`
+		Count       int       `json:"count"`
+		UpdatedAt   time.Time `json:"updatedAt"`
+	}
+	list := make([]summary, 0, len(collections))
+	for _, col := range collections {
+		list = append(list, summary{
+			Name:        col.Name,
+			Description: col.Description,
+			Category:    scanner.CollectionCategory(col.Name),
+			Count:       len(col.Items),
+			UpdatedAt:   col.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"collections": list,
+	})
+}
+
+// HandleGetCollection returns one collection with its items in order
+func HandleGetCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := collectionCache(w)
+	if !ok {
+		return
+	}
+
+	col, err := c.GetCollection(r.URL.Query().Get("name"))
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(col)
+}
+
+// HandleExportCollection writes a collection's paths one per line, in order,
+// the format publisher and bundler read on stdin:
+//
+//	curl -s 'http://localhost:8080/api/collection/export?name=Portfolio' | publisher ...
+func HandleExportCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := collectionCache(w)
+	if !ok {
+		return
+	}
+
+	col, err := c.GetCollection(r.URL.Query().Get("name"))
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, item := range col.Items {
+		fmt.Fprintln(w, item.Path)
+	}
+}
+
+// HandleCreateCollection creates a collection, optionally with initial files
+func HandleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeCollectionOperation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.CreateCollection(op.Name, op.Description); err != nil {
+		collectionError(w, err)
+		return
+	}
+	var missing []string
+	if items := collectionItems(op); len(items) > 0 {
+		var err error
+		if missing, err = c.AppendCollectionItems(op.Name, items); err != nil {
+			collectionError(w, err)
+			return
+		}
+	}
+	log.Printf("📚 Created collection %q", op.Name)
+	collectionChanged(w, c, op.Name, missing)
+}
+
+// HandleDeleteCollection deletes a collection; its files are untouched
+func HandleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeCollectionOperation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.DeleteCollection(op.Name); err != nil {
+		collectionError(w, err)
+		return
+	}
+	log.Printf("📚 Deleted collection %q", op.Name)
+	scanner.RebuildIndex()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// HandleAppendCollection adds files to the end of a collection
+func HandleAppendCollection(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeCollectionOperation(w, r)
+	if !ok {
+		return
+	}
+
+	items := collectionItems(op)
+	if len(items) == 0 {
+		http.Error(w, "filePaths or items is required", http.StatusBadRequest)
+		return
+	}
+	missing, err := c.AppendCollectionItems(op.Name, items)
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	collectionChanged(w, c, op.Name, missing)
+}
+
+// HandleRemoveFromCollection removes files from a collection
+func HandleRemoveFromCollection(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeCollectionOperation(w, r)
+	if !ok {
+		return
+	}
+
+	paths := collectionPaths(op)
+	if len(paths) == 0 {
+		http.Error(w, "filePaths is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := c.RemoveCollectionItems(op.Name, paths); err != nil {
+		collectionError(w, err)
+		return
+	}
+	collectionChanged(w, c, op.Name, nil)
+}
+
+// HandleReorderCollection moves the given files, in order, to the front of a
+// collection; sending every path sets the full order
+func HandleReorderCollection(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeCollectionOperation(w, r)
+	if !ok {
+		return
+	}
+
+	paths := collectionPaths(op)
+	if len(paths) == 0 {
+		http.Error(w, "filePaths is required", http.StatusBadRequest)
+		return
+	}
+	if err := c.ReorderCollection(op.Name, paths); err != nil {
+		collectionError(w, err)
+		return
+	}
+	collectionChanged(w, c, op.Name, nil)
+}
+
+// HandleSetCollectionNote sets the note of one file in a collection
+func HandleSetCollectionNote(w http.ResponseWriter, r *http.Request) {
+	op, c, ok := decodeCollectionOperation(w, r)
+	if !ok {
+		return
+	}
+
+	if op.FilePath == "" {
+		http.Error(w, "filePath is required", http.StatusBadRequest)
+		return
+	}
+	if err := c.SetCollectionNote(op.Name, filepath.Clean(op.FilePath), op.Note); err != nil {
+		collectionError(w, err)
+		return
+	}
+	collectionChanged(w, c, op.Name, nil)
+}
+
+// decodeCollectionOperation checks the method and reads a collection edit
+func decodeCollectionOperation(w http.ResponseWriter, r *http.Request) (models.CollectionOperation, *cache.Cache, bool) {
+	var op models.CollectionOperation
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return op, nil, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return op, nil, false
+	}
+	if op.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return op, nil, false
+	}
+	c, ok := collectionCache(w)
+	return op, c, ok
+}
+
+// collectionCache returns the cache DB collections are stored in
+func collectionCache(w http.ResponseWriter) (*cache.Cache, bool) {
+	c, ok := state.GetCache().(*cache.Cache)
+	if !ok {
+		http.Error(w, "Collections require the cache database", http.StatusServiceUnavailable)
+	}
+	return c, ok
+}
+
+// collectionError maps collection errors to HTTP statuses
+func collectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cache.ErrCollectionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, cache.ErrCollectionExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// collectionItems returns the files of an operation with notes, cleaned
+func collectionItems(op models.CollectionOperation) []models.CollectionItem {
+	items := make([]models.CollectionItem, 0, len(op.Items)+len(op.FilePaths))
+	for _, item := range op.Items {
+		if item.Path != "" {
+			items = append(items, models.CollectionItem{Path: filepath.Clean(item.Path), Note: item.Note})
+		}
+	}
+	for _, p := range op.FilePaths {
+		if p != "" {
+			items = append(items, models.CollectionItem{Path: filepath.Clean(p)})
+		}
+	}
+	return items
+}
+
+// collectionPaths returns the paths of an operation, cleaned
+func collectionPaths(op models.CollectionOperation) []string {
+	items := collectionItems(op)
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.Path
+	}
+	return paths
+}
+
+// collectionChanged rebuilds the index so the 📚 category follows the edit and
+// responds with the collection as it now stands
+func collectionChanged(w http.ResponseWriter, c *cache.Cache, name string, missing []string) {
+	scanner.RebuildIndex()
+
+	col, err := c.GetCollection(name)
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	if missing == nil {
+		missing = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"collection": col,
+		"missing":    missing,
+	})
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/auth"
+	"github.com/tdsanchez/PostMac/internal/library"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// Reasons a path is refused by libraryPath
+var (
+	errPathNotAbsolute = errors.New("path is not absolute")
+	errPathOutside     = errors.New("path is outside the library")
+	errSymlinkEscape   = errors.New("symlink resolves outside the library")
+)
+
+// pathIndex maps indexed paths to their position in AllFiles, rebuilt when
+// the slice is replaced (every rebuild and in-memory edit copies it)
+var pathIndex struct {
+	sync.Mutex
+	first *models.FileInfo
+	n     int
+	index map[string]int
+}
+
+// indexedFile returns the library file at path (already clean)
+func indexedFile(path string) (models.FileInfo, bool) {
+	files := state.GetCurrent().AllFiles
+	if len(files) == 0 {
+		return models.FileInfo{}, false
+	}
+
+	pathIndex.Lock()
+	defer pathIndex.Unlock()
+	stale := pathIndex.first != &files[0] || pathIndex.n != len(files)
+	for {
+		if stale {
+			pathIndex.index = make(map[string]int, len(files))
+			for i, f := range files {
+				pathIndex.index[f.Path] = i
+			}
+			pathIndex.first, pathIndex.n = &files[0], len(files)
+		}
+		i, ok := pathIndex.index[path]
+		switch {
+		case !ok:
+			return models.FileInfo{}, false
+		case files[i].Path == path:
+			return files[i], true
+		case stale:
+			return models.FileInfo{}, false
+		}
+		stale = true // Removed in place since the index was built
+	}
+}
+
+// isIndexed reports whether path (already clean) is a file in the library
+func isIndexed(path string) bool {
+	_, ok := indexedFile(path)
+	return ok
+}
+
+// cleanKeys returns a copy of a path-keyed map (batch ETags) with every key
+// cleaned, so it matches the cleaned paths the batch is checked with
+func cleanKeys(m map[string]string) map[string]string {
+	cleaned := make(map[string]string, len(m))
+	for path, v := range m {
+		cleaned[filepath.Clean(path)] = v
+	}
+	return cleaned
+}
+
+// libraryPath cleans a client-supplied path and checks it belongs to the
+// library: an indexed file, or a file the walk of a configured root would
+// collect. Symlinks are resolved, and a path under a root that resolves
+// outside every root is refused unless that root follows symlinks. Indexed
+// files outside all roots came from stdin and are trusted as listed.
+func libraryPath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", errPathNotAbsolute
+	}
+	clean := filepath.Clean(path)
+	roots := state.GetRoots()
+
+	var root *library.Root
+	for i := range roots {
+		if roots[i].Contains(clean) {
+			root = &roots[i]
+			break
+		}
+	}
+
+	if !isIndexed(clean) {
+		if root == nil || !root.Admits(clean) {
+			return "", errPathOutside
+		}
+	}
+	if root == nil || root.Symlinks != library.SymlinksSkip {
+		return clean, nil
+	}
+
+	// Offline and deleted files have nothing to resolve
+	real, err := filepath.EvalSymlinks(clean)
+	if err != nil || real == clean {
+		return clean, nil
+	}
+	for i := range roots {
+		rootReal, err := filepath.EvalSymlinks(roots[i].Path)
+		if err != nil {
+			rootReal = roots[i].Path
+		}
+		if (&library.Root{Path: rootReal}).Contains(real) {
+			return clean, nil
+		}
+	}
+	return "", errSymlinkEscape
+}
+
+// confinePath is libraryPath for handlers: a refused path is logged as an
+// invalid path and answered with 403, and ok is false
+func confinePath(w http.ResponseWriter, r *http.Request, path string) (string, bool) {
+	clean, err := libraryPath(path)
+	if err != nil {
+		denyPath(r, path, err)
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return "", false
+	}
+	return clean, true
+}
+
+// confinePaths splits a batch into the paths inside the library and the ones
+// refused, logging each refusal
+func confinePaths(r *http.Request, paths []string) (allowed, denied []string) {
+	denied = []string{}
+	for _, p := range paths {
+		clean, err := libraryPath(p)
+		if err != nil {
+			denyPath(r, p, err)
+			denied = append(denied, p)
+			continue
+		}
+		allowed = append(allowed, clean)
+	}
+	return allowed, denied
+}
+
+// denyPath logs a refused path through the invalid-path log
+func denyPath(r *http.Request, path string, reason error) {
+	report := invalidPathReport{
+		Path:      path,
+		Status:    http.StatusForbidden,
+		Error:     reason.Error(),
+		Timestamp: time.Now().Format(time.RFC3339),
+		Endpoint:  r.Method + " " + r.URL.Path,
+		Remote:    r.RemoteAddr,
+	}
+	if id := auth.FromRequest(r); id != nil {
+		report.User = id.User
+	}
+	logInvalidPath(report)
+}
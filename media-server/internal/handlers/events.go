@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/events"
+)
+
+// eventsHeartbeat keeps idle connections from being closed by proxies
+const eventsHeartbeat = 25 * time.Second
+
+// HandleEvents streams library changes as server-sent events. A client that
+// reconnects with a Last-Event-ID header (or ?lastEventId= for clients that
+// cannot set headers) is first sent the events it missed, or a resync event
+// when the ID is from before a restart.
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	client, replay := events.Subscribe(lastID)
+	defer events.Unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, ev := range replay {
+		writeEvent(w, ev)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, open := <-client.C:
+			if !open {
+				return // Fell behind; the browser reconnects and resumes
+			}
+			writeEvent(w, ev)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one event in text/event-stream format. Data is single-line
+// JSON, so it needs no splitting.
+func writeEvent(w http.ResponseWriter, ev events.Event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.LastEventID(), ev.Type, ev.Data)
+}
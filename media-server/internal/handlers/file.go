@@ -33,7 +33,10 @@ func HandleFile(w http.ResponseWriter, r *http.Request) {
 		log.Printf("🔍 HandleFile: restored leading /: %s", absPath)
 	}
 
-	cleanPath := filepath.Clean(absPath)
+	cleanPath, ok := confinePath(w, r, absPath)
+	if !ok {
+		return
+	}
 
 	file, err := os.Open(cleanPath)
 	if err != nil {
@@ -79,6 +82,8 @@ func HandleFile(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/gif")
 	case ".webp":
 		w.Header().Set("Content-Type", "image/webp")
+	case ".heic", ".heif":
+		w.Header().Set("Content-Type", "image/heic")
 	case ".pdf":
 		w.Header().Set("Content-Type", "application/pdf")
 	}
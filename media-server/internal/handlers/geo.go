@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// HandleGeoJSON returns the located files of a category or search as a GeoJSON
+// FeatureCollection for map views. GET /api/geojson?category=... or ?q=...
+func HandleGeoJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, ok := resolveFileSet(w, r)
+	if !ok {
+		return
+	}
+
+	features := []geoJSONFeature{}
+	for _, file := range files {
+		loc := file.Location
+		if loc == nil {
+			continue
+		}
+		// GeoJSON positions are longitude first
+		coords := []float64{loc.Longitude, loc.Latitude}
+		if loc.HasAltitude {
+			coords = append(coords, loc.Altitude)
+		}
+		props := map[string]interface{}{
+			"path": file.Path,
+			"name": file.Name,
+			"tags": file.Tags,
+		}
+		if !file.EarliestDate.IsZero() {
+			props["date"] = file.EarliestDate
+		} else {
+			props["date"] = file.Created
+		}
+		features = append(features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONPoint{Type: "Point", Coordinates: coords},
+			Properties: props,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
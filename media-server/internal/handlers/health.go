@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/events"
+	"github.com/tdsanchez/PostMac/internal/metrics"
+	"github.com/tdsanchez/PostMac/internal/persistence"
+	"github.com/tdsanchez/PostMac/internal/scanner"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// startTime is when the server process started, for uptime
+var startTime = time.Now()
+
+// readyPingTimeout bounds the database check in HandleReadyz
+const readyPingTimeout = 2 * time.Second
+
+// HandleHealthz reports that the process is up and serving (liveness)
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"uptime": time.Since(startTime).Round(time.Second).String(),
+	})
+}
+
+// HandleReadyz reports whether the instance should receive traffic: the
+// library is loaded from the cache, both databases answer, and the startup
+// freshness check has finished, so the files served match the disk. Rescans
+// don't count against readiness (the previous state is served until the new
+// one is swapped in) but are reported. Answers 503 when not ready.
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ready := true
+	checks := make(map[string]string)
+
+	c, ok := state.GetCache().(*cache.Cache)
+	if !ok || c == nil {
+		ready = false
+		checks["cache"] = "not loaded"
+		checks["database"] = "not open"
+	} else {
+		checks["cache"] = "ok"
+		ctx, cancel := context.WithTimeout(r.Context(), readyPingTimeout)
+		defer cancel()
+		if err := c.Ping(ctx); err != nil {
+			ready = false
+			checks["database"] = err.Error()
+		} else {
+			checks["database"] = "ok"
+		}
+	}
+
+	checks["scan"] = "idle"
+	if fs := scanner.GetFreshnessScanner(); fs != nil && fs.IsRunning() {
+		ready = false
+		checked, total := fs.GetProgress()
+		checks["scan"] = fmt.Sprintf("freshness check %d/%d", checked, total)
+	} else if state.IsScanning() {
+		checks["scan"] = "rescan running"
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready":  ready,
+		"checks": checks,
+		"files":  len(state.GetCurrent().AllFiles),
+	})
+}
+
+// HandleMetrics writes server metrics in the Prometheus text format: the
+// registered counters and histograms (see package metrics) plus gauges read
+// now from the write queue, library state and background scanners
+func HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current := state.GetCurrent()
+	offline := 0
+	for _, f := range current.AllFiles {
+		if f.Offline {
+			offline++
+		}
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+
+	metrics.WriteGauge(w, "uptime_seconds", "Seconds since the server started", time.Since(startTime).Seconds())
+	metrics.WriteGauge(w, "files", "Files in the library", float64(len(current.AllFiles)))
+	metrics.WriteGauge(w, "files_offline", "Library files on unmounted volumes", float64(offline))
+	metrics.WriteGauge(w, "tags", "Distinct tags in the library", float64(len(current.AllTags)))
+	metrics.WriteGauge(w, "categories", "Browsable categories (tags plus folder, type and synthetic ones)", float64(len(current.FilesByTag)))
+	metrics.WriteGauge(w, "write_queue_depth", "Tag and rating writes waiting to be persisted", float64(persistence.GetQueueSize()))
+	metrics.WriteGauge(w, "scanning", "1 while a rescan is running", boolGauge(state.IsScanning()))
+
+	var checked, total int64
+	running := false
+	if fs := scanner.GetFreshnessScanner(); fs != nil {
+		checked, total = fs.GetProgress()
+		running = fs.IsRunning()
+	}
+	metrics.WriteGauge(w, "freshness_running", "1 while the startup freshness check is running", boolGauge(running))
+	metrics.WriteGauge(w, "freshness_checked_files", "Files checked by the current or last freshness check", float64(checked))
+	metrics.WriteGauge(w, "freshness_total_files", "Files to check in the current or last freshness check", float64(total))
+
+	if v := scanner.GetIntegrityValidator(); v != nil {
+		checked, total := v.GetProgress()
+		metrics.WriteGauge(w, "integrity_running", "1 while an integrity pass is running", boolGauge(v.IsRunning()))
+		metrics.WriteGauge(w, "integrity_checked_files", "Files checked by the current or last integrity pass", float64(checked))
+		metrics.WriteGauge(w, "integrity_total_files", "Files to check in the current or last integrity pass", float64(total))
+		metrics.WriteGauge(w, "broken_files", "Files flagged as truncated or corrupt", float64(v.Broken()))
+	}
+
+	metrics.WriteGauge(w, "event_clients", "Connected server-sent event streams", float64(events.ClientCount()))
+	metrics.WriteAll(w)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// The OpenAPI description of /api/v1 is generated from v1Routes, so it lists
+// exactly the routes and methods the router serves.
+
+// openAPIParameters documents the shared query parameters by name
+var openAPIParameters = map[string]map[string]interface{}{
+	"offset":   queryParameter("offset", "Index of the first item to return", map[string]interface{}{"type": "integer", "minimum": 0, "default": 0}),
+	"limit":    queryParameter("limit", "Maximum number of items to return", map[string]interface{}{"type": "integer", "minimum": 1, "maximum": maxPageLimit, "default": defaultPageLimit}),
+	"fields":   queryParameter("fields", "Comma-separated File fields to return, e.g. path,tags", map[string]interface{}{"type": "string"}),
+	"sort":     queryParameter("sort", "Sort mode (name, date, size, os_birth, os_mod, exif_create, exif_modify, rating, random); prefix with - to reverse. Default: category order", map[string]interface{}{"type": "string"}),
+	"category": queryParameter("category", "Only files in this category", map[string]interface{}{"type": "string"}),
+	"q":        queryParameter("q", "Boolean search query, e.g. cats AND rating>=4", map[string]interface{}{"type": "string"}),
+	"path":     queryParameter("path", "Only the file with this absolute path", map[string]interface{}{"type": "string"}),
+	"kind":     queryParameter("kind", "Only categories of this kind", map[string]interface{}{"type": "string", "enum": categoryKinds}),
+	"If-Match": {
+		"name":        "If-Match",
+		"in":          "header",
+		"description": "The file's etag when it was loaded; a stale one is rejected with 409",
+		"schema":      map[string]interface{}{"type": "string"},
+	},
+}
+
+// openAPIPathParameters documents the {name} segments of route patterns
+var openAPIPathParameters = map[string]string{
+	"id":   "File id: the absolute path, base64url-encoded without padding (the id field of a File)",
+	"tag":  "Tag name, percent-encoded",
+	"name": "Tag or category name, percent-encoded (a / in the name as %2F)",
+}
+
+// queryParameter builds an OpenAPI query parameter object
+func queryParameter(name, description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      schema,
+	}
+}
+
+// schemaRef refers to a component schema
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// fileFieldSchemas are the types of the File resource's fields
+var fileFieldSchemas = map[string]map[string]interface{}{
+	"id":                  {"type": "string"},
+	"path":                {"type": "string"},
+	"name":                {"type": "string"},
+	"relPath":             {"type": "string"},
+	"type":                {"type": "string", "description": "File type category, e.g. 📷 Images"},
+	"tags":                {"type": "array", "items": map[string]interface{}{"type": "string"}},
+	"comment":             {"type": "string"},
+	"size":                {"type": "integer", "format": "int64"},
+	"created":             {"type": "string", "format": "date-time", "nullable": true},
+	"modified":            {"type": "string", "format": "date-time", "nullable": true},
+	"earliestDate":        {"type": "string", "format": "date-time", "nullable": true},
+	"timelineDate":        {"type": "string", "format": "date-time", "nullable": true},
+	"needsDateCorrection": {"type": "boolean"},
+	"timezoneMismatch":    {"type": "boolean"},
+	"location": {"type": "object", "nullable": true, "properties": map[string]interface{}{
+		"latitude":  map[string]interface{}{"type": "number"},
+		"longitude": map[string]interface{}{"type": "number"},
+		"altitude":  map[string]interface{}{"type": "number"},
+	}},
+	"rating":     {"type": "integer", "minimum": 0, "maximum": 5},
+	"colorLabel": {"type": "string"},
+	"volume":     {"type": "string"},
+	"offline":    {"type": "boolean"},
+	"broken":     {"type": "string", "description": "Why the integrity check failed, empty when intact"},
+	"etag":       {"type": "string", "description": "Revision of tags, comment, rating and color label; send as If-Match with edits"},
+}
+
+// openAPISchemas returns the component schemas
+func openAPISchemas() map[string]interface{} {
+	fileProps := make(map[string]interface{}, len(fileFields))
+	for _, f := range fileFields {
+		fileProps[f] = fileFieldSchemas[f]
+	}
+	str := map[string]interface{}{"type": "string"}
+	integer := map[string]interface{}{"type": "integer"}
+	object := func(props map[string]interface{}, required ...string) map[string]interface{} {
+		s := map[string]interface{}{"type": "object", "properties": props}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+
+	return map[string]interface{}{
+		"File":    object(fileProps),
+		"TagList": map[string]interface{}{"type": "array", "items": str},
+		"Tag":     object(map[string]interface{}{"name": str, "count": integer}, "name", "count"),
+		"Category": object(map[string]interface{}{
+			"name":  str,
+			"kind":  map[string]interface{}{"type": "string", "enum": categoryKinds},
+			"count": integer,
+		}, "name", "kind", "count"),
+		"FilePatch": object(map[string]interface{}{
+			"tags":       fileFieldSchemas["tags"],
+			"comment":    str,
+			"rating":     fileFieldSchemas["rating"],
+			"colorLabel": map[string]interface{}{"type": "string", "description": "gray, green, purple, blue, yellow, red, orange, or empty to clear"},
+		}),
+		"TagEdit": object(map[string]interface{}{
+			"tag":  str,
+			"tags": fileFieldSchemas["tags"],
+		}),
+		"SearchRequest": object(map[string]interface{}{"query": str}, "query"),
+		"Page": object(map[string]interface{}{
+			"offset": integer,
+			"limit":  integer,
+			"total":  integer,
+			"next":   map[string]interface{}{"type": "string", "description": "URL of the next page, absent on the last"},
+		}, "offset", "limit", "total"),
+		"Error": object(map[string]interface{}{
+			"error": object(map[string]interface{}{
+				"status":  integer,
+				"code":    str,
+				"message": str,
+			}, "status", "code", "message"),
+		}, "error"),
+		"OpenAPI": map[string]interface{}{"type": "object"},
+	}
+}
+
+// openAPIOperation describes one method of a route
+func openAPIOperation(op v1Operation, method string, pathParams []interface{}) map[string]interface{} {
+	params := append([]interface{}{}, pathParams...)
+	for _, name := range op.query {
+		params = append(params, map[string]interface{}{"$ref": "#/components/parameters/" + name})
+	}
+	if op.ifMatch {
+		params = append(params, map[string]interface{}{"$ref": "#/components/parameters/If-Match"})
+	}
+
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{"$ref": "#/components/responses/Error"},
+	}
+	if op.response == "" {
+		responses["204"] = map[string]interface{}{"description": "No Content"}
+	} else {
+		schema := schemaRef(op.response)
+		switch {
+		case op.raw:
+		case op.list:
+			schema = map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data": map[string]interface{}{"type": "array", "items": schemaRef(op.response)},
+					"page": schemaRef("Page"),
+				},
+				"required": []string{"data", "page"},
+			}
+		default:
+			schema = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"data": schemaRef(op.response)},
+				"required":   []string{"data"},
+			}
+		}
+		responses["200"] = map[string]interface{}{
+			"description": "OK",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+		}
+	}
+	if op.ifMatch {
+		responses["409"] = map[string]interface{}{"$ref": "#/components/responses/Conflict"}
+	}
+
+	operation := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"responses":   responses,
+		"x-role":      op.requiredRole(method),
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+	if op.body != "" {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef(op.body)}},
+		}
+	}
+	return operation
+}
+
+// openAPIDocument generates the OpenAPI 3.0 description of v1Routes
+func openAPIDocument() map[string]interface{} {
+	paths := make(map[string]interface{}, len(v1Routes))
+	for _, route := range v1Routes {
+		var pathParams []interface{}
+		for _, segment := range strings.Split(route.pattern, "/") {
+			if strings.HasPrefix(segment, "{") {
+				name := strings.Trim(segment, "{}")
+				pathParams = append(pathParams, map[string]interface{}{
+					"name":        name,
+					"in":          "path",
+					"required":    true,
+					"description": openAPIPathParameters[name],
+					"schema":      map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+
+		item := make(map[string]interface{}, len(route.methods))
+		for method, op := range route.methods {
+			item[strings.ToLower(method)] = openAPIOperation(op, method, pathParams)
+		}
+		paths[APIV1Prefix+route.pattern] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "PostMac media-server API",
+			"version": "1",
+			"description": "Responses are {\"data\": ...}, with \"page\" on lists, or {\"error\": {...}}. " +
+				"Once user accounts exist, requests authenticate with an API token or a login session, " +
+				"and each operation needs the role in its x-role (viewer, tagger or admin).",
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"session": []string{}},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas":    openAPISchemas(),
+			"parameters": openAPIParameters,
+			"securitySchemes": map[string]interface{}{
+				"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API token (media-server users token, or POST /api/token/create)"},
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": "media_server_session_PORT", "description": "Login session from /login"},
+			},
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "Error",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef("Error")}},
+				},
+				"Conflict": map[string]interface{}{
+					"description": "The file was changed since the If-Match etag; current is its present state",
+					"content": map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{
+						"allOf": []interface{}{
+							schemaRef("Error"),
+							map[string]interface{}{"type": "object", "properties": map[string]interface{}{"current": schemaRef("File")}},
+						},
+					}}},
+				},
+			},
+		},
+	}
+}
+
+// v1OpenAPI serves the generated OpenAPI description at /api/v1/openapi.json
+func v1OpenAPI(w http.ResponseWriter, r *http.Request, _ v1Params) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(openAPIDocument())
+}
@@ -15,8 +15,10 @@ import (
 	texttemplate "text/template"
 	"time"
 
+	"github.com/tdsanchez/PostMac/internal/auth"
 	"github.com/tdsanchez/PostMac/internal/config"
 	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/scanner"
 	"github.com/tdsanchez/PostMac/internal/state"
 )
 
@@ -29,6 +31,11 @@ type BreadcrumbSegment struct {
 // parseFolderBreadcrumbs splits a folder category into breadcrumb segments
 // e.g., "📁 Photos/2024/Vacation" -> [{Photos, /tag/📁 Photos}, {2024, /tag/📁 Photos/2024}, ...]
 func parseFolderBreadcrumbs(tag string) []BreadcrumbSegment {
+	// Timeline categories nest year > month > day the same way
+	if timelineDepth(tag) > 0 {
+		return parseTimelineBreadcrumbs(tag)
+	}
+
 	// Check if this is a folder category
 	if !strings.HasPrefix(tag, "📁 ") {
 		// Not a folder, return single segment
@@ -221,6 +228,13 @@ func sortFiles(files []models.FileInfo, sortMode string, sortReversed bool) {
 			}
 			return files[i].EXIFModifyDate.After(files[j].EXIFModifyDate) // Newest first
 		})
+	case "rating":
+		sort.SliceStable(files, func(i, j int) bool {
+			if sortReversed {
+				return files[i].Rating < files[j].Rating // Unrated first
+			}
+			return files[i].Rating > files[j].Rating // Highest first
+		})
 	case "random":
 		// Shuffle using Fisher-Yates algorithm
 		rand.Seed(time.Now().UnixNano())
@@ -276,9 +290,10 @@ func HandleRoot(w http.ResponseWriter, r *http.Request) {
 
 	previews := []models.CategoryPreview{}
 
-	// Add non-folder categories (All, Types, Tags)
+	// Add non-folder categories (All, Types, Tags); the timeline shows years
+	// only, like top-level folders
 	for tag, files := range filesByTag {
-		if !strings.HasPrefix(tag, "📁 ") && len(files) > 0 {
+		if !strings.HasPrefix(tag, "📁 ") && timelineDepth(tag) <= 1 && len(files) > 0 {
 			randomFile := files[rand.Intn(len(files))]
 			previews = append(previews, models.CategoryPreview{
 				Tag:         tag,
@@ -332,14 +347,27 @@ func HandleRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Who is logged in, for the header; only admins see Shutdown
+	var user string
+	isAdmin := true
+	if id := auth.FromRequest(r); id != nil {
+		user, isAdmin = id.User, auth.Allows(id.Role, auth.RoleAdmin)
+	}
+
 	data := struct {
 		Previews        []models.CategoryPreview
 		TotalFiles      int
 		TotalCategories int
+		User            string
+		IsAdmin         bool
+		CSRFHead        template.HTML
 	}{
 		Previews:        previews,
 		TotalFiles:      len(allFiles),
 		TotalCategories: len(filesByTag),
+		User:            user,
+		IsAdmin:         isAdmin,
+		CSRFHead:        csrfHead(r),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -632,6 +660,12 @@ func HandleTag(w http.ResponseWriter, r *http.Request) {
 	// Build folder tree for sidebar navigation
 	folderTree := buildFolderTree(filesByTag)
 
+	// Timeline pages also get the year > month > day tree
+	var timelineTree []TreeNode
+	if timelineDepth(tag) > 0 {
+		timelineTree = buildTimelineTree(filesByTag)
+	}
+
 	data := struct {
 		Tag          string
 		Files        []models.FileInfo
@@ -639,6 +673,7 @@ func HandleTag(w http.ResponseWriter, r *http.Request) {
 		TotalFiles   int
 		ChildFolders []SubfolderInfo
 		FolderTree   []TreeNode // NEW: For sidebar navigation
+		TimelineTree []TreeNode
 		Page         int
 		Limit        int
 		TotalPages   int
@@ -646,6 +681,7 @@ func HandleTag(w http.ResponseWriter, r *http.Request) {
 		EndIdx       int
 		SortMode     string
 		SortReversed bool
+		CSRFHead     template.HTML
 	}{
 		Tag:          tag,
 		Files:        paginatedFiles,
@@ -653,6 +689,7 @@ func HandleTag(w http.ResponseWriter, r *http.Request) {
 		TotalFiles:   totalFiles,
 		ChildFolders: childFolders,
 		FolderTree:   folderTree,
+		TimelineTree: timelineTree,
 		Page:         page,
 		Limit:        limit,
 		TotalPages:   totalPages,
@@ -660,6 +697,7 @@ func HandleTag(w http.ResponseWriter, r *http.Request) {
 		EndIdx:       endIdx,
 		SortMode:     sortMode,
 		SortReversed: sortReversed,
+		CSRFHead:     csrfHead(r),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -697,6 +735,11 @@ func findValidFileWithFallback(requestedPath string, files []models.FileInfo, re
 			return requestedFile, requestedIndex, true
 		}
 
+		// Volume unmounted - show the cached metadata with an offline placeholder
+		if requestedFile.Offline {
+			return requestedFile, requestedIndex, true
+		}
+
 		// Requested file doesn't exist on disk - log for RCA
 		log.Printf("⚠️ MISSING FILE: path=%s (file exists in cache but not on disk)", requestedPath)
 	}
@@ -875,6 +918,7 @@ func HandleViewer(w http.ResponseWriter, r *http.Request) {
 		"jsEscape":         jsEscape,
 		"isTextFile":       config.IsTextFile,
 		"isConvertibleFile": config.IsConvertibleFile,
+		"fileETag":         scanner.FileETag,
 	}
 	jsTmpl, err := texttemplate.New("viewerjs").Funcs(jsFuncMap).Parse(jsTemplateStr)
 	if err != nil {
@@ -908,6 +952,7 @@ func HandleViewer(w http.ResponseWriter, r *http.Request) {
 		JavaScript   template.JS
 		SortMode     string
 		SortReversed bool
+		CSRFHead     template.HTML
 	}{
 		Tag:          tag,
 		File:         currentFile,
@@ -918,6 +963,7 @@ func HandleViewer(w http.ResponseWriter, r *http.Request) {
 		JavaScript:   template.JS(processedJS),
 		SortMode:     sortMode,
 		SortReversed: sortReversed,
+		CSRFHead:     csrfHead(r),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -1009,11 +1055,13 @@ func HandleTraining(w http.ResponseWriter, r *http.Request) {
 		Index            int
 		Total            int
 		ExistingDecision string
+		CSRFHead         template.HTML
 	}{
 		File:             file,
 		Index:            index,
 		Total:            len(files),
 		ExistingDecision: existingDecision,
+		CSRFHead:         csrfHead(r),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/persistence"
+	"github.com/tdsanchez/PostMac/internal/scanner"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// HandleSetRating sets the star rating and/or color label of a file
+func HandleSetRating(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var op models.RatingOperation
+	if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cleanPath, ok := confinePath(w, r, op.FilePath)
+	if !ok {
+		return
+	}
+	op.FilePath = cleanPath
+
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+
+	// Reject the edit if the file changed since the client loaded it
+	if file, ok := checkETag(op.FilePath, sentETag(r, op.ETag)); !ok {
+		writeConflict(w, file)
+		return
+	}
+
+	updated, err := applyRating([]string{op.FilePath}, op.Rating, op.Label)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(updated) == 0 {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"rating":  updated[0].Rating,
+		"label":   updated[0].ColorLabel,
+		"etag":    scanner.FileETag(updated[0]),
+	})
+}
+
+// HandleBatchSetRating sets the star rating and/or color label of multiple files
+func HandleBatchSetRating(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var op models.BatchRatingOperation
+	if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Paths outside the library are skipped and reported
+	allowed, denied := confinePaths(r, op.FilePaths)
+	etags := cleanKeys(op.ETags)
+
+	fileEditMu.Lock()
+	defer fileEditMu.Unlock()
+
+	// Files changed since the client loaded them are skipped and reported
+	paths := make([]string, 0, len(allowed))
+	conflicts := []map[string]interface{}{}
+	for _, p := range allowed {
+		if file, ok := checkETag(p, etags[p]); !ok {
+			conflicts = append(conflicts, fileState(file))
+			continue
+		}
+		paths = append(paths, p)
+	}
+
+	updated, err := applyRating(paths, op.Rating, op.Label)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"count":     len(updated),
+		"conflicts": conflicts,
+		"denied":    denied,
+	})
+}
+
+// applyRating validates a rating change, applies it to the in-memory index and
+// the cache, and queues the Spotlight/XMP mirror write. Returns the updated
+// files; paths not in the library are skipped. Callers hold fileEditMu.
+func applyRating(paths []string, rating *int, label *string) ([]models.FileInfo, error) {
+	if rating == nil && label == nil {
+		return nil, fmt.Errorf("rating or label is required")
+	}
+	if rating != nil && (*rating < 0 || *rating > scanner.MaxRating) {
+		return nil, fmt.Errorf("rating must be between 0 and %d", scanner.MaxRating)
+	}
+	if label != nil {
+		canonical, err := scanner.ParseColorLabel(*label)
+		if err != nil {
+			return nil, err
+		}
+		label = &canonical
+	}
+
+	clean := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p != "" {
+			clean = append(clean, filepath.Clean(p))
+		}
+	}
+
+	updated := scanner.UpdateFileRatingsInMemory(clean, rating, label)
+	dbCache := state.GetCache()
+	for _, f := range updated {
+		if dbCache != nil {
+			if err := dbCache.UpdateFileRating(f.Path, f.Rating, f.ColorLabel); err != nil {
+				log.Printf("Warning: Failed to update cache for %s: %v", f.Path, err)
+			}
+		}
+		persistence.QueueRatingWrite(f.Path, f.Rating, f.ColorLabel)
+	}
+	return updated, nil
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/scanner"
+)
+
+// fileEditMu serialises tag, comment and rating edits, so checking a client's
+// ETag and applying its change happen as one step, and two concurrent tag
+// edits can no longer both read the same tags and drop each other's change
+var fileEditMu sync.Mutex
+
+// sentETag returns the ETag a client sent with an edit: the body's etag
+// field, else the If-Match header. Empty means the client does not track
+// revisions and the edit is applied unconditionally.
+func sentETag(r *http.Request, bodyETag string) string {
+	if bodyETag != "" {
+		return bodyETag
+	}
+	return r.Header.Get("If-Match")
+}
+
+// fileState is the editable state of a file, returned with conflicts
+func fileState(f models.FileInfo) map[string]interface{} {
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]interface{}{
+		"path":       f.Path,
+		"tags":       tags,
+		"comment":    f.Comment,
+		"rating":     f.Rating,
+		"colorLabel": f.ColorLabel,
+		"etag":       scanner.FileETag(f),
+	}
+}
+
+// checkETag reports whether an edit of path may go ahead: the file is not
+// indexed (nothing to compare), or the ETag sent matches. Must be called
+// with fileEditMu held.
+func checkETag(path, etag string) (models.FileInfo, bool) {
+	f, ok := findFile(path)
+	if !ok {
+		return f, true
+	}
+	return f, scanner.ETagMatches(f, etag)
+}
+
+// currentETag returns the ETag of an indexed file after an edit ("" if not indexed)
+func currentETag(path string) string {
+	if f, ok := findFile(path); ok {
+		return scanner.FileETag(f)
+	}
+	return ""
+}
+
+// writeConflict rejects a stale edit with 409 and the file's current state,
+// so the client can show it and let the user redo the change
+func writeConflict(w http.ResponseWriter, f models.FileInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+scanner.FileETag(f)+`"`)
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  false,
+		"conflict": true,
+		"error":    "File was changed since it was loaded",
+		"current":  fileState(f),
+	})
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/tdsanchez/PostMac/internal/cache"
 	"github.com/tdsanchez/PostMac/internal/models"
 	"github.com/tdsanchez/PostMac/internal/search"
 	"github.com/tdsanchez/PostMac/internal/state"
@@ -29,6 +32,41 @@ func HandleSearchQuery(query string) ([]models.FileInfo, error) {
 	return results, nil
 }
 
+// resolveFileSet returns the files named by a request's ?q= search query or
+// ?category= (a "🔍 " category runs as a search), or every file when neither is
+// given. On failure it writes the error response and returns false.
+func resolveFileSet(w http.ResponseWriter, r *http.Request) ([]models.FileInfo, bool) {
+	query := r.URL.Query().Get("q")
+	category := r.URL.Query().Get("category")
+
+	switch {
+	case query != "":
+		results, err := HandleSearchQuery(query)
+		if err != nil {
+			http.Error(w, "Search query failed: "+err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		return results, true
+	case category != "":
+		files, ok := state.GetCurrent().FilesByTag[category]
+		if !ok && strings.HasPrefix(category, "🔍 ") {
+			results, err := HandleSearchQuery(strings.TrimPrefix(category, "🔍 "))
+			if err != nil {
+				http.Error(w, "Search query failed: "+err.Error(), http.StatusBadRequest)
+				return nil, false
+			}
+			return results, true
+		}
+		if !ok {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return nil, false
+		}
+		return files, true
+	default:
+		return state.GetCurrent().FilesByTag["All"], true
+	}
+}
+
 // HandleSearch executes a boolean search query
 func HandleSearch(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
@@ -63,3 +101,79 @@ func HandleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// HandleTextSearch runs a ranked full-text search over file names, comments and
+// text file contents, returning each hit with a highlighted snippet
+func HandleTextSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "Missing query parameter 'q'", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	c, ok := state.GetCache().(*cache.Cache)
+	if !ok || !c.TextSearchAvailable() {
+		http.Error(w, "Full-text search is not available (build with -tags sqlite_fts5)", http.StatusNotImplemented)
+		return
+	}
+
+	hits, err := c.SearchText(query, limit)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": err.Error(),
+			"query": query,
+		})
+		return
+	}
+
+	// Attach the in-memory file info; hits for files no longer in the
+	// library (index not yet synced) are dropped
+	current := state.GetCurrent()
+	byPath := make(map[string]models.FileInfo, len(hits))
+	wanted := make(map[string]bool, len(hits))
+	for _, hit := range hits {
+		wanted[hit.Path] = true
+	}
+	for _, f := range current.AllFiles {
+		if wanted[f.Path] {
+			byPath[f.Path] = f
+		}
+	}
+
+	type result struct {
+		File    models.FileInfo `json:"file"`
+		Score   float64         `json:"score"`
+		Snippet string          `json:"snippet"`
+	}
+	results := []result{}
+	for _, hit := range hits {
+		if f, ok := byPath[hit.Path]; ok {
+			results = append(results, result{File: f, Score: hit.Score, Snippet: hit.Snippet})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"count":   len(results),
+		"query":   query,
+	}); err != nil {
+		log.Printf("Error encoding text search results: %v", err)
+	}
+}
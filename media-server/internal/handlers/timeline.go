@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/scanner"
+)
+
+// timelineDepth returns 1, 2 or 3 for a year, month or day category and 0 for
+// anything else
+func timelineDepth(tag string) int {
+	if !strings.HasPrefix(tag, scanner.TimelinePrefix) {
+		return 0
+	}
+	return strings.Count(strings.TrimPrefix(tag, scanner.TimelinePrefix), "-") + 1
+}
+
+// timelineLabel names one level of a timeline period: "2019", "Jul" or "14"
+func timelineLabel(period string) string {
+	parts := strings.Split(period, "-")
+	if len(parts) == 2 {
+		if t, err := time.Parse("2006-01", period); err == nil {
+			return t.Format("Jan")
+		}
+	}
+	return parts[len(parts)-1]
+}
+
+// parseTimelineBreadcrumbs splits a timeline category into breadcrumb segments
+// e.g., "🗓 2019-07-14" -> [{2019, /tag/🗓 2019}, {Jul, /tag/🗓 2019-07}, {14, /tag/🗓 2019-07-14}]
+func parseTimelineBreadcrumbs(tag string) []BreadcrumbSegment {
+	period := strings.TrimPrefix(tag, scanner.TimelinePrefix)
+	parts := strings.Split(period, "-")
+
+	segments := make([]BreadcrumbSegment, 0, len(parts))
+	for i := range parts {
+		current := strings.Join(parts[:i+1], "-")
+		segments = append(segments, BreadcrumbSegment{
+			Label: timelineLabel(current),
+			URL:   "/tag/" + url.QueryEscape(scanner.TimelinePrefix+current),
+		})
+	}
+	return segments
+}
+
+// buildTimelineTree builds the year > month > day tree of timeline categories
+// for the sidebar. Counts include the roll-up of each period's children.
+func buildTimelineTree(filesByTag map[string][]models.FileInfo) []TreeNode {
+	var periods []string
+	for tag := range filesByTag {
+		if timelineDepth(tag) > 0 {
+			periods = append(periods, strings.TrimPrefix(tag, scanner.TimelinePrefix))
+		}
+	}
+	// Shorter periods first, so every parent exists before its children
+	sort.Slice(periods, func(i, j int) bool {
+		if len(periods[i]) != len(periods[j]) {
+			return len(periods[i]) < len(periods[j])
+		}
+		return periods[i] < periods[j]
+	})
+
+	var years []TreeNode
+	for _, period := range periods {
+		node := TreeNode{
+			Name:     timelineLabel(period),
+			Path:     scanner.TimelinePrefix + period,
+			Count:    len(filesByTag[scanner.TimelinePrefix+period]),
+			Children: []TreeNode{},
+			Depth:    strings.Count(period, "-"),
+		}
+		switch node.Depth {
+		case 0:
+			years = append(years, node)
+		case 1:
+			if year := findTimelineNode(years, period[:4]); year != nil {
+				year.Children = append(year.Children, node)
+			}
+		case 2:
+			if year := findTimelineNode(years, period[:4]); year != nil {
+				if month := findTimelineNode(year.Children, period[:7]); month != nil {
+					month.Children = append(month.Children, node)
+				}
+			}
+		}
+	}
+	return years
+}
+
+func findTimelineNode(nodes []TreeNode, period string) *TreeNode {
+	for i := range nodes {
+		if nodes[i].Path == scanner.TimelinePrefix+period {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+// timelineLayouts maps histogram intervals to their period format
+var timelineLayouts = map[string]string{
+	"year":  "2006",
+	"month": "2006-01",
+	"day":   "2006-01-02",
+}
+
+// timelineBucket is one period of a histogram
+type timelineBucket struct {
+	Period   string `json:"period"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// HandleTimelineHistogram returns file counts per year, month or day for a
+// category or search, with empty periods between the first and last filled in.
+// GET /api/timeline?category=...|q=...&interval=year|month|day (default month)
+func HandleTimelineHistogram(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	layout, ok := timelineLayouts[interval]
+	if !ok {
+		http.Error(w, "interval must be year, month or day", http.StatusBadRequest)
+		return
+	}
+
+	files, ok := resolveFileSet(w, r)
+	if !ok {
+		return
+	}
+
+	counts := make(map[string]int)
+	var first, last time.Time
+	undated := 0
+	for _, file := range files {
+		if file.TimelineDate.IsZero() {
+			undated++
+			continue
+		}
+		t := file.TimelineDate.In(scanner.TimelineZone)
+		counts[t.Format(layout)]++
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if last.IsZero() || t.After(last) {
+			last = t
+		}
+	}
+
+	buckets := []timelineBucket{}
+	if !first.IsZero() {
+		end := last.Format(layout)
+		for t := periodStart(first, interval); ; t = nextPeriod(t, interval) {
+			period := t.Format(layout)
+			buckets = append(buckets, timelineBucket{
+				Period:   period,
+				Category: scanner.TimelinePrefix + period,
+				Count:    counts[period],
+			})
+			if period >= end {
+				break
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"interval": interval,
+		"buckets":  buckets,
+		"total":    len(files),
+		"undated":  undated,
+	})
+}
+
+// periodStart truncates t to the start of its year, month or day
+func periodStart(t time.Time, interval string) time.Time {
+	switch interval {
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func nextPeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case "year":
+		return t.AddDate(1, 0, 0)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
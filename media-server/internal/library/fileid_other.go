@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+
+package library
+
+import "os"
+
+// FileID is unavailable on this platform; moves are matched by content hash only
+// and any existing volume directory is treated as mounted.
+func FileID(info os.FileInfo) (device, inode uint64) {
+	return 0, 0
+}
@@ -0,0 +1,18 @@
+//go:build darwin || linux
+
+package library
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileID returns the device and inode numbers of a file. The pair recognises a
+// file moved or renamed on the same volume; a device change marks a mount point.
+func FileID(info os.FileInfo) (device, inode uint64) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(stat.Dev), uint64(stat.Ino)
+}
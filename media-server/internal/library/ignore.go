@@ -0,0 +1,135 @@
+package library
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// rule is a single gitignore-style pattern
+type rule struct {
+	raw      string
+	negate   bool // "!pattern" re-includes a previously excluded path
+	dirOnly  bool // "pattern/" only matches directories
+	anchored bool // pattern contains a "/" and is matched against the full relative path
+	re       *regexp.Regexp
+}
+
+// Rules is an ordered list of gitignore-style patterns. The last matching
+// pattern wins, so "!keep.jpg" after "*.jpg" re-includes keep.jpg.
+type Rules struct {
+	rules []rule
+}
+
+// ParseRules compiles gitignore-style patterns. Blank lines and "#" comments are ignored.
+//
+// Supported syntax:
+//   - "*" matches anything except "/", "?" matches one character, "[abc]" a class
+//   - "**" matches across directories ("**/cache", "raw/**", "a/**/b")
+//   - a leading "/" or any inner "/" anchors the pattern to the root
+//   - patterns without "/" match the base name at any depth
+//   - a trailing "/" matches directories only
+//   - a leading "!" negates the pattern
+func ParseRules(patterns []string) (*Rules, error) {
+	r := &Rules{}
+	for _, p := range patterns {
+		p = strings.TrimRight(p, " \t")
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		ru := rule{raw: p}
+		if strings.HasPrefix(p, "!") {
+			ru.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			ru.dirOnly = true
+			p = strings.TrimSuffix(p, "/")
+		}
+		if strings.Contains(p, "/") {
+			ru.anchored = true
+			p = strings.TrimPrefix(p, "/")
+		}
+
+		re, err := regexp.Compile(globToRegexp(p))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", ru.raw, err)
+		}
+		ru.re = re
+		r.rules = append(r.rules, ru)
+	}
+	return r, nil
+}
+
+// Empty reports whether there are no rules
+func (r *Rules) Empty() bool {
+	return r == nil || len(r.rules) == 0
+}
+
+// Match reports whether rel (slash-separated, relative to the root) matches the rules.
+// matched is false when no rule applied at all.
+func (r *Rules) Match(rel string, isDir bool) (matched bool) {
+	if r == nil {
+		return false
+	}
+	base := path.Base(rel)
+	for _, ru := range r.rules {
+		if ru.dirOnly && !isDir {
+			continue
+		}
+		target := base
+		if ru.anchored {
+			target = rel
+		}
+		if ru.re.MatchString(target) {
+			matched = !ru.negate
+		}
+	}
+	return matched
+}
+
+// globToRegexp translates a gitignore glob into an anchored regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				// "**/" matches zero or more directories, "**" anything
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					b.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					b.WriteString(".*")
+					i++
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+	return b.String()
+}
@@ -0,0 +1,254 @@
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tdsanchez/PostMac/internal/config"
+)
+
+// Symlink policies for directory walks
+const (
+	SymlinksSkip   = "skip"   // Ignore symlinks entirely (default)
+	SymlinksFiles  = "files"  // Follow symlinks to files, not to directories
+	SymlinksFollow = "follow" // Follow symlinks to files and directories (loop-safe)
+)
+
+// Root is a directory the library is built from, walked recursively
+type Root struct {
+	Path          string   `json:"path"`
+	Include       []string `json:"include,omitempty"`  // gitignore-style; if set, files must match one
+	Exclude       []string `json:"exclude,omitempty"`  // gitignore-style; matching files/dirs are skipped
+	Symlinks      string   `json:"symlinks,omitempty"` // skip | files | follow
+	IncludeHidden bool     `json:"includeHidden,omitempty"`
+	MaxDepth      int      `json:"maxDepth,omitempty"` // 0 = unlimited, 1 = files directly in root
+
+	include *Rules
+	exclude *Rules
+}
+
+// RootsFile is the on-disk format of a --roots-config file
+type RootsFile struct {
+	Roots []Root `json:"roots"`
+}
+
+// Prepare validates the root and compiles its rules
+func (r *Root) Prepare() error {
+	abs, err := filepath.Abs(r.Path)
+	if err != nil {
+		return err
+	}
+	r.Path = filepath.Clean(abs)
+
+	switch r.Symlinks {
+	case "":
+		r.Symlinks = SymlinksSkip
+	case SymlinksSkip, SymlinksFiles, SymlinksFollow:
+	default:
+		return fmt.Errorf("invalid symlink policy %q (want skip, files or follow)", r.Symlinks)
+	}
+
+	if r.include, err = ParseRules(r.Include); err != nil {
+		return err
+	}
+	if r.exclude, err = ParseRules(r.Exclude); err != nil {
+		return err
+	}
+
+	// Checked last so a root on an unmounted volume still has its rules compiled
+	info, err := os.Stat(r.Path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", r.Path)
+	}
+	return nil
+}
+
+// Contains reports whether path lies under this root
+func (r *Root) Contains(path string) bool {
+	return path == r.Path || strings.HasPrefix(path, r.Path+string(filepath.Separator))
+}
+
+// Admits reports whether a walk of the root would collect path: it lies under
+// the root within MaxDepth, is a supported file, and neither it nor a parent
+// directory is hidden or excluded. Symlinks are not resolved here.
+func (r *Root) Admits(path string) bool {
+	if !r.Contains(path) || path == r.Path {
+		return false
+	}
+	rel := filepath.ToSlash(strings.TrimPrefix(path, r.Path+string(filepath.Separator)))
+	parts := strings.Split(rel, "/")
+	if r.MaxDepth > 0 && len(parts) > r.MaxDepth {
+		return false
+	}
+	for i, name := range parts {
+		if !r.IncludeHidden && strings.HasPrefix(name, ".") {
+			return false
+		}
+		isDir := i < len(parts)-1
+		if r.exclude.Match(strings.Join(parts[:i+1], "/"), isDir) {
+			return false
+		}
+	}
+	if !config.SupportedExts[strings.ToLower(filepath.Ext(path))] {
+		return false
+	}
+	return r.include.Empty() || r.include.Match(rel, false)
+}
+
+// LoadRootsFile reads a JSON roots config file
+func LoadRootsFile(path string) ([]Root, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rf RootsFile
+	if err := json.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return rf.Roots, nil
+}
+
+// Walk recursively collects supported files under the root, applying the
+// include/exclude rules, hidden-file policy, symlink policy and max depth.
+func (r *Root) Walk() []string {
+	var paths []string
+	visited := make(map[string]bool) // Real paths of walked dirs (symlink loop guard)
+	r.walkDir(r.Path, 1, visited, &paths)
+	return paths
+}
+
+func (r *Root) walkDir(dir string, depth int, visited map[string]bool, paths *[]string) {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if visited[real] {
+			return
+		}
+		visited[real] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("⚠️  Skipping directory (read error): %s - %v", dir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !r.IncludeHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		full := filepath.Join(dir, name)
+		isDir := entry.IsDir()
+
+		if entry.Type()&os.ModeSymlink != 0 {
+			if r.Symlinks == SymlinksSkip {
+				continue
+			}
+			target, err := os.Stat(full)
+			if err != nil {
+				continue // Dangling link
+			}
+			isDir = target.IsDir()
+			if isDir && r.Symlinks != SymlinksFollow {
+				continue
+			}
+		}
+
+		rel := filepath.ToSlash(strings.TrimPrefix(full, r.Path+string(filepath.Separator)))
+		if r.exclude.Match(rel, isDir) {
+			continue
+		}
+
+		if isDir {
+			if r.MaxDepth == 0 || depth < r.MaxDepth {
+				r.walkDir(full, depth+1, visited, paths)
+			}
+			continue
+		}
+
+		if !config.SupportedExts[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		if !r.include.Empty() && !r.include.Match(rel, false) {
+			continue
+		}
+		*paths = append(*paths, full)
+	}
+}
+
+// WalkRoots walks every root and returns the combined, de-duplicated path list
+func WalkRoots(roots []Root) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for i := range roots {
+		for _, p := range roots[i].Walk() {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+// MergePaths appends extra paths to base, skipping duplicates
+func MergePaths(base []string, extra []string) []string {
+	seen := make(map[string]bool, len(base)+len(extra))
+	merged := make([]string, 0, len(base)+len(extra))
+	for _, list := range [][]string{base, extra} {
+		for _, p := range list {
+			if !seen[p] {
+				seen[p] = true
+				merged = append(merged, p)
+			}
+		}
+	}
+	return merged
+}
+
+// ReadPaths reads a path list from r. With nulDelimited, entries are separated by
+// NUL bytes (find -print0), so paths may contain newlines; otherwise one path per
+// line with surrounding whitespace trimmed.
+func ReadPaths(r io.Reader, nulDelimited bool) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	if nulDelimited {
+		scanner.Split(splitNUL)
+	}
+
+	var paths []string
+	for scanner.Scan() {
+		path := scanner.Text()
+		if !nulDelimited {
+			path = strings.TrimSpace(path)
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// splitNUL is a bufio.SplitFunc for NUL-delimited input
+func splitNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
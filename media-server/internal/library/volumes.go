@@ -0,0 +1,88 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// volumeParents are directories whose children are mount points for removable
+// and network volumes, with the number of path segments below them that name
+// the volume ("/media/USER/DISK" needs two).
+var volumeParents = []struct {
+	prefix string
+	depth  int
+}{
+	{"/Volumes/", 1},   // macOS
+	{"/run/media/", 2}, // Linux (udisks2, per-user)
+	{"/media/", 2},     // Linux (udisks2, Debian/Ubuntu)
+	{"/mnt/", 1},       // Linux (manual mounts)
+}
+
+// RootVolume is the volume of every path outside the removable-media directories.
+// It is always considered online.
+const RootVolume = "/"
+
+// VolumeRoot returns the mount point a path lives on, following the platform
+// conventions for removable and network volumes
+func VolumeRoot(path string) string {
+	for _, vp := range volumeParents {
+		if !strings.HasPrefix(path, vp.prefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(path, vp.prefix), "/", vp.depth+1)
+		if len(parts) < vp.depth || parts[vp.depth-1] == "" {
+			return RootVolume
+		}
+		return vp.prefix + strings.Join(parts[:vp.depth], "/")
+	}
+	return RootVolume
+}
+
+// VolumeOnline reports whether a volume root is currently available. A root
+// on a different device than its parent is a mounted volume. Otherwise it may
+// be a plain directory under /mnt or /media rather than a mount point, so it
+// only counts as offline when it is missing or empty (a mount point left
+// behind by an unmounted volume).
+func VolumeOnline(root string) bool {
+	if root == RootVolume {
+		return true
+	}
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	if parent, err := os.Stat(filepath.Dir(root)); err == nil {
+		dev, _ := FileID(info)
+		parentDev, _ := FileID(parent)
+		if dev != parentDev {
+			return true
+		}
+	}
+	return !dirEmpty(root)
+}
+
+// dirEmpty reports whether a directory has no entries (unreadable counts as empty)
+func dirEmpty(dir string) bool {
+	d, err := os.Open(dir)
+	if err != nil {
+		return true
+	}
+	defer d.Close()
+	names, _ := d.Readdirnames(1)
+	return len(names) == 0
+}
+
+// VolumeStatus memoizes VolumeOnline for the duration of one pass over the library
+type VolumeStatus map[string]bool
+
+// Online reports whether the volume holding path is mounted
+func (vs VolumeStatus) Online(path string) bool {
+	root := VolumeRoot(path)
+	online, ok := vs[root]
+	if !ok {
+		online = VolumeOnline(root)
+		vs[root] = online
+	}
+	return online
+}
@@ -0,0 +1,76 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ISO base media file format (MP4, MOV, M4V, HEIC) box walking.
+// A box is a 32-bit size and a four-character type; size 1 means a 64-bit size
+// follows, size 0 means the box runs to the end of its container.
+
+// walkBoxes calls fn for each box between start and end with the range of its payload
+func walkBoxes(r io.ReadSeeker, start, end int64, fn func(typ string, dataStart, dataEnd int64) error) error {
+	var hdr [16]byte
+	for pos := start; pos+8 <= end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := io.ReadFull(r, hdr[8:16]); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || size > end-pos {
+			return fmt.Errorf("bad %q box size %d at %d", typ, size, pos)
+		}
+		if err := fn(typ, pos+headerLen, pos+size); err != nil {
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+// readRange reads the bytes between start and end, refusing payloads over max
+func readRange(r io.ReadSeeker, start, end, max int64) ([]byte, error) {
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("bad range %d-%d", start, end)
+	}
+	if end-start > max {
+		return nil, fmt.Errorf("box of %d bytes exceeds %d byte limit", end-start, max)
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, end-start)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+// beUint reads an unsigned big-endian integer of n bytes (0, 1, 2, 4 or 8)
+func beUint(b []byte, n int) uint64 {
+	switch n {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b))
+	case 8:
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
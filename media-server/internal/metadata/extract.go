@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// maxEXIFBytes bounds how much embedded EXIF is read from a container
+const maxEXIFBytes = 4 << 20
+
+// Info is what the container parsers extract from a file without decoding
+// pixels or frames. Zero values mean "not present".
+type Info struct {
+	Width  int
+	Height int
+
+	// EXIF from JPEG/TIFF, a PNG eXIf chunk, a WebP EXIF chunk or a HEIC Exif item
+	EXIF *exif.Exif
+
+	// Created is the container's own creation date (MP4/MOV mvhd, MKV DateUTC,
+	// AVI IDIT/ICRD). CreatedUTC reports whether it is an absolute UTC time;
+	// otherwise it is a camera wall-clock time with no zone, like EXIF dates.
+	Created    time.Time
+	CreatedUTC bool
+
+	Duration   time.Duration
+	VideoCodec string
+	AudioCodec string
+
+	// Location from EXIF GPS tags or a video's ISO 6709 location
+	Location *models.GeoLocation
+}
+
+// Extract reads dimensions, embedded EXIF and container metadata from any
+// supported image or video type. Parse errors in one part of a file leave the
+// fields found so far, so a truncated video can still report its dimensions.
+func Extract(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &Info{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		extractJPEG(f, info)
+	case ".tif", ".tiff":
+		extractTIFF(f, info)
+	case ".png":
+		extractPNG(f, info)
+	case ".gif":
+		extractGIF(f, info)
+	case ".webp":
+		extractWebP(f, info)
+	case ".heic", ".heif":
+		extractHEIF(f, info)
+	case ".mp4", ".mov", ".m4v":
+		extractMP4(f, info)
+	case ".avi":
+		extractAVI(f, info)
+	case ".mkv":
+		extractMKV(f, info)
+	}
+	if info.Location == nil && info.EXIF != nil {
+		info.Location = exifLocation(info.EXIF)
+	}
+	return info, nil
+}
+
+// decodeEXIF parses a raw EXIF payload (TIFF header, optionally preceded by "Exif\0\0")
+func decodeEXIF(data []byte) *exif.Exif {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return x
+}
+
+// codecNames maps container codec identifiers to familiar names
+var codecNames = map[string]string{
+	// MP4/MOV sample entries
+	"avc1": "H.264", "avc3": "H.264", "hvc1": "HEVC", "hev1": "HEVC",
+	"av01": "AV1", "vp09": "VP9", "mp4v": "MPEG-4", "jpeg": "Motion JPEG",
+	"apch": "ProRes 422 HQ", "apcn": "ProRes 422", "apcs": "ProRes 422 LT",
+	"apco": "ProRes 422 Proxy", "ap4h": "ProRes 4444",
+	"mp4a": "AAC", "ac-3": "AC-3", "ec-3": "E-AC-3", "alac": "ALAC",
+	"lpcm": "PCM", "sowt": "PCM", "twos": "PCM", "Opus": "Opus",
+	// AVI fourccs
+	"H264": "H.264", "h264": "H.264", "X264": "H.264", "XVID": "Xvid",
+	"DIVX": "DivX", "DX50": "DivX", "MJPG": "Motion JPEG", "HEVC": "HEVC",
+	// Matroska codec IDs
+	"V_MPEG4/ISO/AVC": "H.264", "V_MPEGH/ISO/HEVC": "HEVC", "V_VP8": "VP8",
+	"V_VP9": "VP9", "V_AV1": "AV1", "V_MJPEG": "Motion JPEG", "V_MPEG4/ISO/ASP": "MPEG-4",
+	"A_AAC": "AAC", "A_OPUS": "Opus", "A_VORBIS": "Vorbis", "A_AC3": "AC-3",
+	"A_EAC3": "E-AC-3", "A_FLAC": "FLAC", "A_MPEG/L3": "MP3", "A_PCM/INT/LIT": "PCM",
+}
+
+// codecName returns the familiar name of a codec identifier, or the identifier itself
+func codecName(id string) string {
+	id = strings.TrimRight(id, "\x00 ")
+	if name, ok := codecNames[id]; ok {
+		return name
+	}
+	return id
+}
@@ -0,0 +1,303 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func u16(v uint16) []byte  { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte  { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte  { return binary.BigEndian.AppendUint64(nil, v) }
+func le32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+
+func join(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+// box builds an ISO BMFF box
+func box(typ string, payload ...[]byte) []byte {
+	data := join(payload...)
+	return join(u32(uint32(8+len(data))), []byte(typ), data)
+}
+
+// riffChunk builds a RIFF chunk, padded to an even size
+func riffChunk(id string, payload ...[]byte) []byte {
+	data := join(payload...)
+	chunk := join([]byte(id), le32(uint32(len(data))), data)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// pngChunk builds a PNG chunk with its CRC
+func pngChunk(typ string, data []byte) []byte {
+	body := join([]byte(typ), data)
+	return join(u32(uint32(len(data))), body, u32(crc32.ChecksumIEEE(body)))
+}
+
+// ebml builds a Matroska element with a one- or two-byte size
+func ebml(id []byte, payload ...[]byte) []byte {
+	data := join(payload...)
+	size := []byte{0x80 | byte(len(data))}
+	if len(data) >= 0x7f {
+		size = []byte{0x40 | byte(len(data)>>8), byte(len(data))}
+	}
+	return join(id, size, data)
+}
+
+func sampleMP4() []byte {
+	created := uint32(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC).Sub(mp4Epoch) / time.Second)
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16)
+	xyz := "+37.7858-122.4064+012.345/"
+	return join(
+		box("ftyp", []byte("isom"), u32(0)),
+		box("moov",
+			box("mvhd", u32(0), u32(created), u32(created), u32(1000), u32(10000)),
+			box("trak",
+				box("tkhd", tkhd),
+				box("mdia",
+					box("hdlr", u32(0), u32(0), []byte("vide"), make([]byte, 12)),
+					box("minf", box("stbl", box("stsd", u32(0), u32(1), u32(16), []byte("avc1")))))),
+			box("udta", box("\xa9xyz", u16(uint16(len(xyz))), u16(0x15c7), []byte(xyz)))),
+		box("mdat", make([]byte, 32)),
+	)
+}
+
+// sampleHEIF has an Exif item whose iloc extent is given by offset and length
+func sampleHEIF(offset, length uint64) []byte {
+	infe := box("infe", []byte{2, 0, 0, 0}, u16(1), u16(0), []byte("Exif"), []byte{0})
+	iloc := box("iloc", []byte{0, 0, 0, 0, 0x88, 0x00}, u16(1), u16(1), u16(0), u16(1), u64(offset), u64(length))
+	return join(
+		box("ftyp", []byte("heic"), u32(0)),
+		box("meta", u32(0),
+			box("iinf", []byte{0, 0, 0, 0}, u16(1), infe),
+			iloc,
+			box("iprp", box("ipco",
+				box("ispe", u32(0), u32(512), u32(512)),
+				box("ispe", u32(0), u32(4032), u32(3024))))),
+	)
+}
+
+func samplePNG() []byte {
+	ihdr := join(u32(640), u32(480), []byte{8, 2, 0, 0, 0})
+	return join(pngSignature, pngChunk("IHDR", ihdr), pngChunk("IDAT", []byte{0}), pngChunk("IEND", nil))
+}
+
+func sampleWebP() []byte {
+	// Canvas 800x600, stored as width-1 and height-1 in 24 bits
+	vp8x := []byte{0, 0, 0, 0, 0x1f, 0x03, 0x00, 0x57, 0x02, 0x00}
+	body := join([]byte("WEBP"), riffChunk("VP8X", vp8x))
+	return join([]byte("RIFF"), le32(uint32(len(body))), body)
+}
+
+func sampleAVI() []byte {
+	avih := make([]byte, 56)
+	binary.LittleEndian.PutUint32(avih[0:], 40000) // 25 fps
+	binary.LittleEndian.PutUint32(avih[16:], 250)
+	binary.LittleEndian.PutUint32(avih[32:], 720)
+	binary.LittleEndian.PutUint32(avih[36:], 576)
+	strh := join([]byte("vids"), []byte("XVID"), make([]byte, 48))
+	strf := make([]byte, 40)
+	copy(strf[16:], "H264")
+	strl := riffChunk("LIST", []byte("strl"), riffChunk("strh", strh), riffChunk("strf", strf))
+	hdrl := riffChunk("LIST", []byte("hdrl"), riffChunk("avih", avih), strl)
+	body := join([]byte("AVI "), hdrl, riffChunk("LIST", []byte("movi")))
+	return join([]byte("RIFF"), le32(uint32(len(body))), body)
+}
+
+func sampleMKV() []byte {
+	header := ebml([]byte{0x1A, 0x45, 0xDF, 0xA3}, ebml([]byte{0x42, 0x82}, []byte("matroska")))
+	info := ebml([]byte{0x15, 0x49, 0xA9, 0x66},
+		ebml([]byte{0x2A, 0xD7, 0xB1}, []byte{0x0F, 0x42, 0x40}),
+		ebml([]byte{0x44, 0x89}, u64(math.Float64bits(5000))))
+	tracks := ebml([]byte{0x16, 0x54, 0xAE, 0x6B},
+		ebml([]byte{0xAE},
+			ebml([]byte{0x83}, []byte{1}),
+			ebml([]byte{0x86}, []byte("V_VP9")),
+			ebml([]byte{0xE0},
+				ebml([]byte{0xB0}, u16(1280)),
+				ebml([]byte{0xBA}, u16(720)))))
+	return join(header, ebml([]byte{0x18, 0x53, 0x80, 0x67}, info, tracks))
+}
+
+func writeSample(t testing.TB, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name             string
+		data             []byte
+		width, height    int
+		duration         time.Duration
+		videoCodec       string
+		latitude         float64
+		wantCreatedAfter time.Time
+	}{
+		{name: "clip.mp4", data: sampleMP4(), width: 1920, height: 1080, duration: 10 * time.Second,
+			videoCodec: "H.264", latitude: 37.7858, wantCreatedAfter: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "photo.heic", data: sampleHEIF(0, 16), width: 4032, height: 3024},
+		{name: "image.png", data: samplePNG(), width: 640, height: 480},
+		{name: "image.webp", data: sampleWebP(), width: 800, height: 600},
+		{name: "clip.avi", data: sampleAVI(), width: 720, height: 576, duration: 10 * time.Second, videoCodec: "H.264"},
+		{name: "clip.mkv", data: sampleMKV(), width: 1280, height: 720, duration: 5 * time.Second, videoCodec: "VP9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Extract(writeSample(t, tt.name, tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Width != tt.width || info.Height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", info.Width, info.Height, tt.width, tt.height)
+			}
+			if info.Duration != tt.duration {
+				t.Errorf("duration = %v, want %v", info.Duration, tt.duration)
+			}
+			if info.VideoCodec != tt.videoCodec {
+				t.Errorf("video codec = %q, want %q", info.VideoCodec, tt.videoCodec)
+			}
+			if tt.latitude != 0 && (info.Location == nil || info.Location.Latitude != tt.latitude) {
+				t.Errorf("location = %+v, want latitude %v", info.Location, tt.latitude)
+			}
+			if !tt.wantCreatedAfter.IsZero() && !info.Created.After(tt.wantCreatedAfter) {
+				t.Errorf("created = %v, want after %v", info.Created, tt.wantCreatedAfter)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"clip.mp4", sampleMP4(), true},
+		{"clip.mp4", sampleMP4()[:100], false},
+		{"photo.heic", sampleHEIF(0, 16), true},
+		{"image.png", samplePNG(), true},
+		{"image.png", samplePNG()[:30], false},
+		{"image.webp", sampleWebP(), true},
+		{"image.webp", sampleWebP()[:20], false},
+		{"clip.avi", sampleAVI(), true},
+		{"clip.mkv", sampleMKV(), true},
+		{"clip.mkv", sampleMKV()[:40], false},
+	}
+	for _, tt := range tests {
+		reason := Validate(writeSample(t, tt.name, tt.data), false)
+		if (reason == "") != tt.ok {
+			t.Errorf("Validate(%s, %d bytes) = %q, want ok=%v", tt.name, len(tt.data), reason, tt.ok)
+		}
+	}
+}
+
+// Corrupt size fields must be rejected, not turned into huge or negative allocations
+func TestCorruptSizes(t *testing.T) {
+	// iloc extents whose 64-bit offset or length overflow int64
+	for _, loc := range [][2]uint64{
+		{16, math.MaxUint64 - 8},
+		{math.MaxUint64 - 8, 16},
+		{math.MaxInt64, math.MaxInt64},
+	} {
+		info, err := Extract(writeSample(t, "photo.heic", sampleHEIF(loc[0], loc[1])))
+		if err != nil || info.Width != 4032 {
+			t.Errorf("iloc %v: info %+v, err %v", loc, info, err)
+		}
+	}
+
+	// A box with a 64-bit largesize that would overflow pos+size
+	huge := join(box("ftyp", []byte("isom")), u32(1), []byte("moov"), u64(math.MaxInt64-4), make([]byte, 16))
+	if err := walkBoxes(bytes.NewReader(huge), 0, int64(len(huge)), func(string, int64, int64) error { return nil }); err == nil {
+		t.Error("walkBoxes accepted a largesize past the end of the file")
+	}
+	if reason := Validate(writeSample(t, "clip.mp4", huge), false); reason == "" {
+		t.Error("Validate accepted a largesize past the end of the file")
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	r := bytes.NewReader([]byte("0123456789"))
+	tests := []struct {
+		start, end, max int64
+		want            string
+		ok              bool
+	}{
+		{2, 5, 16, "234", true},
+		{0, 0, 16, "", true},
+		{0, 10, 4, "", false},
+		{5, 2, 16, "", false},
+		{-1, 4, 16, "", false},
+		{8, math.MinInt64, 16, "", false},
+		{8, 12, 16, "", false}, // Past the end
+	}
+	for _, tt := range tests {
+		b, err := readRange(r, tt.start, tt.end, tt.max)
+		if (err == nil) != tt.ok || (tt.ok && string(b) != tt.want) {
+			t.Errorf("readRange(%d, %d, %d) = %q, %v", tt.start, tt.end, tt.max, b, err)
+		}
+	}
+}
+
+func TestParseISO6709(t *testing.T) {
+	tests := []struct {
+		in            string
+		ok            bool
+		lat, lon, alt float64
+		hasAlt        bool
+	}{
+		{"+37.7858-122.4064+012.345/", true, 37.7858, -122.4064, 12.345, true},
+		{"-33.8688+151.2093/", true, -33.8688, 151.2093, 0, false},
+		{"+35.6586+139.7454+040.000CRSWGS_84/", true, 35.6586, 139.7454, 40, true},
+		{"+00.0000+000.0000/", false, 0, 0, 0, false}, // Placeholder before a GPS fix
+		{"+91.0000+010.0000/", false, 0, 0, 0, false},
+		{"37.7858-122.4064", false, 0, 0, 0, false},
+		{"+37.7858", false, 0, 0, 0, false},
+		{"+1+2+3+4", false, 0, 0, 0, false},
+		{"", false, 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		loc := parseISO6709(tt.in)
+		if (loc != nil) != tt.ok {
+			t.Errorf("parseISO6709(%q) = %+v, want ok=%v", tt.in, loc, tt.ok)
+			continue
+		}
+		if loc != nil && (loc.Latitude != tt.lat || loc.Longitude != tt.lon || loc.Altitude != tt.alt || loc.HasAltitude != tt.hasAlt) {
+			t.Errorf("parseISO6709(%q) = %+v", tt.in, loc)
+		}
+	}
+}
+
+// FuzzExtract feeds arbitrary bytes to every container parser; none may panic
+func FuzzExtract(f *testing.F) {
+	exts := []string{".mp4", ".heic", ".png", ".webp", ".avi", ".mkv", ".jpg", ".gif"}
+	f.Add(uint8(0), sampleMP4())
+	f.Add(uint8(1), sampleHEIF(0, 16))
+	f.Add(uint8(1), sampleHEIF(16, math.MaxUint64-8))
+	f.Add(uint8(2), samplePNG())
+	f.Add(uint8(3), sampleWebP())
+	f.Add(uint8(4), sampleAVI())
+	f.Add(uint8(5), sampleMKV())
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, kind uint8, data []byte) {
+		path := filepath.Join(dir, "sample"+exts[int(kind)%len(exts)])
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		Extract(path)
+		Validate(path, false)
+	})
+}
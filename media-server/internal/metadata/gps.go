@@ -0,0 +1,164 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// exifLocation reads the GPS IFD. Files without GPS tags, with out-of-range
+// coordinates, or with the (0,0) placeholder some cameras write before a fix
+// return nil.
+func exifLocation(x *exif.Exif) *models.GeoLocation {
+	lat, lon, err := x.LatLong()
+	if err != nil || !validLocation(lat, lon) {
+		return nil
+	}
+	loc := &models.GeoLocation{Latitude: lat, Longitude: lon}
+
+	if tag, err := x.Get(exif.GPSAltitude); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && den != 0 {
+			loc.Altitude = float64(num) / float64(den)
+			loc.HasAltitude = true
+			// GPSAltitudeRef 1 means below sea level
+			if ref, err := x.Get(exif.GPSAltitudeRef); err == nil {
+				if v, err := ref.Int(0); err == nil && v == 1 {
+					loc.Altitude = -loc.Altitude
+				}
+			}
+		}
+	}
+	return loc
+}
+
+// parseISO6709 parses the decimal-degree form of an ISO 6709 location string
+// as written by phones and cameras, e.g. "+37.7858-122.4064+012.345/"
+func parseISO6709(s string) *models.GeoLocation {
+	s = strings.TrimSpace(strings.TrimRight(s, "/\x00"))
+	if s == "" {
+		return nil
+	}
+	// Split at each sign: latitude, longitude, optional altitude
+	var parts []string
+	for i := 0; i < len(s); {
+		if s[i] != '+' && s[i] != '-' {
+			return nil
+		}
+		j := i + 1
+		for j < len(s) && s[j] != '+' && s[j] != '-' {
+			j++
+		}
+		parts = append(parts, s[i:j])
+		i = j
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil
+	}
+
+	lat, err1 := strconv.ParseFloat(parts[0], 64)
+	lon, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || !validLocation(lat, lon) {
+		return nil
+	}
+	loc := &models.GeoLocation{Latitude: lat, Longitude: lon}
+	if len(parts) == 3 {
+		// Altitude may carry a "CRS" suffix; only the number matters here
+		alt := strings.TrimSuffix(parts[2], "CRSWGS_84")
+		if v, err := strconv.ParseFloat(alt, 64); err == nil {
+			loc.Altitude, loc.HasAltitude = v, true
+		}
+	}
+	return loc
+}
+
+func validLocation(lat, lon float64) bool {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return false
+	}
+	return lat != 0 || lon != 0
+}
+
+// mp4UserDataLocation reads the ©xyz atom from moov/udta: a 16-bit string
+// length, a 16-bit language code, then the ISO 6709 string
+func mp4UserDataLocation(f *os.File, start, stop int64) *models.GeoLocation {
+	var loc *models.GeoLocation
+	walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+		if typ != "\xa9xyz" {
+			return nil
+		}
+		b, err := readRange(f, start, stop, 256)
+		if err != nil || len(b) < 4 {
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if 4+n > len(b) {
+			n = len(b) - 4
+		}
+		loc = parseISO6709(string(b[4 : 4+n]))
+		return nil
+	})
+	return loc
+}
+
+// mp4MetaLocation reads com.apple.quicktime.location.ISO6709 from a QuickTime
+// moov/meta box, where keys names each entry and ilst holds the values by
+// 1-based key index
+func mp4MetaLocation(f *os.File, start, stop int64) *models.GeoLocation {
+	// QuickTime meta is a plain box; ISO BMFF meta is a full box. A zero
+	// version/flags word can't be a valid child box size, so skip it.
+	if b, err := readRange(f, start, start+4, 4); err == nil && len(b) == 4 && binary.BigEndian.Uint32(b) == 0 {
+		start += 4
+	}
+
+	keyIndex := uint32(0)
+	var loc *models.GeoLocation
+	walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+		switch typ {
+		case "keys":
+			b, err := readRange(f, start, stop, 64<<10)
+			if err != nil || len(b) < 8 {
+				return nil
+			}
+			count := binary.BigEndian.Uint32(b[4:])
+			p := 8
+			for i := uint32(1); i <= count && p+8 <= len(b); i++ {
+				size := int(binary.BigEndian.Uint32(b[p:]))
+				if size < 8 || p+size > len(b) {
+					break
+				}
+				if string(b[p+8:p+size]) == "com.apple.quicktime.location.ISO6709" {
+					keyIndex = i
+				}
+				p += size
+			}
+		case "ilst":
+			if keyIndex == 0 {
+				return nil
+			}
+			// Each child's box type is the big-endian key index; its data box
+			// holds an 8-byte type/locale header before the value
+			walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+				if binary.BigEndian.Uint32([]byte(typ)) != keyIndex {
+					return nil
+				}
+				walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+					if typ != "data" {
+						return nil
+					}
+					if b, err := readRange(f, start, stop, 256); err == nil && len(b) > 8 {
+						loc = parseISO6709(string(b[8:]))
+					}
+					return nil
+				})
+				return nil
+			})
+		}
+		return nil
+	})
+	return loc
+}
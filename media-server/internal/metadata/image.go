@@ -0,0 +1,341 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func extractJPEG(f *os.File, info *Info) {
+	if cfg, _, err := image.DecodeConfig(f); err == nil {
+		info.Width, info.Height = cfg.Width, cfg.Height
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if x, err := exif.Decode(f); err == nil {
+		info.EXIF = x
+	}
+}
+
+// extractTIFF reads the first IFD's dimensions; TIFF files are EXIF containers themselves
+func extractTIFF(f *os.File, info *Info) {
+	x, err := exif.Decode(f)
+	if err != nil {
+		return
+	}
+	info.EXIF = x
+	if tag, err := x.Get(exif.ImageWidth); err == nil {
+		info.Width, _ = tag.Int(0)
+	}
+	if tag, err := x.Get(exif.ImageLength); err == nil {
+		info.Height, _ = tag.Int(0)
+	}
+}
+
+func extractGIF(f *os.File, info *Info) {
+	if cfg, _, err := image.DecodeConfig(f); err == nil {
+		info.Width, info.Height = cfg.Width, cfg.Height
+	}
+}
+
+// extractPNG reads IHDR for dimensions and the eXIf chunk, skipping image data
+func extractPNG(f *os.File, info *Info) {
+	var sig [8]byte
+	if _, err := io.ReadFull(f, sig[:]); err != nil || string(sig[:]) != "\x89PNG\r\n\x1a\n" {
+		return
+	}
+
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(f, hdr[:]); err != nil {
+			return
+		}
+		length := int64(binary.BigEndian.Uint32(hdr[:4]))
+		switch string(hdr[4:8]) {
+		case "IHDR":
+			var ihdr [8]byte
+			if _, err := io.ReadFull(f, ihdr[:]); err != nil {
+				return
+			}
+			info.Width = int(binary.BigEndian.Uint32(ihdr[:4]))
+			info.Height = int(binary.BigEndian.Uint32(ihdr[4:]))
+			length -= 8
+		case "eXIf":
+			if length > maxEXIFBytes {
+				return
+			}
+			data := make([]byte, length)
+			if _, err := io.ReadFull(f, data); err != nil {
+				return
+			}
+			info.EXIF = decodeEXIF(data)
+			length = 0
+		case "IEND":
+			return
+		}
+		// Skip the rest of the chunk and its CRC
+		if _, err := f.Seek(length+4, io.SeekCurrent); err != nil {
+			return
+		}
+	}
+}
+
+// extractWebP reads the canvas size from VP8X (or the VP8/VP8L bitstream
+// header for simple files) and the EXIF chunk
+func extractWebP(f *os.File, info *Info) {
+	var riff [12]byte
+	if _, err := io.ReadFull(f, riff[:]); err != nil || string(riff[:4]) != "RIFF" || string(riff[8:]) != "WEBP" {
+		return
+	}
+
+	var hdr [8]byte
+	haveCanvas := false
+	for {
+		if _, err := io.ReadFull(f, hdr[:]); err != nil {
+			return
+		}
+		length := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		padded := length + length&1
+		read := int64(0)
+
+		switch string(hdr[:4]) {
+		case "VP8X":
+			var b [10]byte
+			if _, err := io.ReadFull(f, b[:]); err != nil {
+				return
+			}
+			read = 10
+			info.Width = int(uint32(b[4])|uint32(b[5])<<8|uint32(b[6])<<16) + 1
+			info.Height = int(uint32(b[7])|uint32(b[8])<<8|uint32(b[9])<<16) + 1
+			haveCanvas = true
+		case "VP8 ":
+			var b [10]byte
+			if _, err := io.ReadFull(f, b[:]); err != nil {
+				return
+			}
+			read = 10
+			// 3-byte frame tag, start code 9d 01 2a, then 14-bit width and height
+			if !haveCanvas && b[3] == 0x9d && b[4] == 0x01 && b[5] == 0x2a {
+				info.Width = int(binary.LittleEndian.Uint16(b[6:]) & 0x3fff)
+				info.Height = int(binary.LittleEndian.Uint16(b[8:]) & 0x3fff)
+			}
+		case "VP8L":
+			var b [5]byte
+			if _, err := io.ReadFull(f, b[:]); err != nil {
+				return
+			}
+			read = 5
+			// Signature 0x2f, then 14-bit width-1 and height-1
+			if !haveCanvas && b[0] == 0x2f {
+				bits := binary.LittleEndian.Uint32(b[1:])
+				info.Width = int(bits&0x3fff) + 1
+				info.Height = int(bits>>14&0x3fff) + 1
+			}
+		case "EXIF":
+			if length > maxEXIFBytes {
+				return
+			}
+			data := make([]byte, length)
+			if _, err := io.ReadFull(f, data); err != nil {
+				return
+			}
+			read = length
+			info.EXIF = decodeEXIF(data)
+		}
+		if _, err := f.Seek(padded-read, io.SeekCurrent); err != nil {
+			return
+		}
+	}
+}
+
+// extractHEIF reads the largest image spatial extent (ispe) and the Exif item
+// from the meta box of a HEIC/HEIF file
+func extractHEIF(f *os.File, info *Info) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return
+	}
+
+	walkBoxes(f, 0, end, func(typ string, start, stop int64) error {
+		if typ != "meta" {
+			return nil
+		}
+		var exifItem uint32
+		var locations map[uint32][2]int64
+		// meta is a full box: skip version and flags
+		walkBoxes(f, start+4, stop, func(typ string, start, stop int64) error {
+			switch typ {
+			case "iinf":
+				exifItem = heifExifItem(f, start, stop)
+			case "iloc":
+				locations = heifItemLocations(f, start, stop)
+			case "iprp":
+				walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+					if typ == "ipco" {
+						heifLargestExtent(f, start, stop, info)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+
+		if loc, ok := locations[exifItem]; ok && exifItem != 0 {
+			data, err := readRange(f, loc[0], loc[0]+loc[1], maxEXIFBytes)
+			// 4-byte offset to the TIFF header, then the EXIF payload
+			if err == nil && len(data) > 4 {
+				skip := 4 + int64(binary.BigEndian.Uint32(data[:4]))
+				if skip < int64(len(data)) {
+					info.EXIF = decodeEXIF(data[skip:])
+				}
+			}
+		}
+		return io.EOF // Only one meta box matters
+	})
+}
+
+// heifExifItem returns the item ID of the Exif item listed in iinf
+func heifExifItem(f *os.File, start, stop int64) uint32 {
+	data, err := readRange(f, start, stop, 1<<20)
+	if err != nil || len(data) < 6 {
+		return 0
+	}
+	headerLen := int64(6) // version, flags, 16-bit entry count
+	if data[0] != 0 {
+		headerLen = 8 // 32-bit entry count
+	}
+
+	var item uint32
+	walkBoxes(f, start+headerLen, stop, func(typ string, start, stop int64) error {
+		if typ != "infe" {
+			return nil
+		}
+		b, err := readRange(f, start, stop, 4096)
+		if err != nil || len(b) < 4 {
+			return nil
+		}
+		version := b[0]
+		var id uint32
+		var itemType []byte
+		switch {
+		case version == 2 && len(b) >= 12:
+			id, itemType = uint32(binary.BigEndian.Uint16(b[4:])), b[8:12]
+		case version >= 3 && len(b) >= 14:
+			id, itemType = binary.BigEndian.Uint32(b[4:]), b[10:14]
+		default:
+			return nil
+		}
+		if string(itemType) == "Exif" {
+			item = id
+			return io.EOF
+		}
+		return nil
+	})
+	return item
+}
+
+// heifItemLocations parses iloc into item ID -> (file offset, length) of each
+// item's first extent. Items stored in idat (construction method 1) are skipped.
+func heifItemLocations(f *os.File, start, stop int64) map[uint32][2]int64 {
+	b, err := readRange(f, start, stop, 4<<20)
+	if err != nil || len(b) < 8 {
+		return nil
+	}
+	version := b[0]
+	offsetSize, lengthSize := int(b[4]>>4), int(b[4]&0xf)
+	baseOffsetSize, indexSize := int(b[5]>>4), int(b[5]&0xf)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	r := bytes.NewReader(b[6:])
+	read := func(n int) (uint64, bool) {
+		if n == 0 {
+			return 0, true
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, false
+		}
+		return beUint(buf, n), true
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count, ok := read(idSize)
+	if !ok {
+		return nil
+	}
+
+	locations := make(map[uint32][2]int64)
+	for i := uint64(0); i < count; i++ {
+		id, ok := read(idSize)
+		if !ok {
+			return locations
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			if method, ok = read(2); !ok {
+				return locations
+			}
+			method &= 0xf
+		}
+		if _, ok = read(2); !ok { // data_reference_index
+			return locations
+		}
+		base, ok := read(baseOffsetSize)
+		if !ok {
+			return locations
+		}
+		extents, ok := read(2)
+		if !ok {
+			return locations
+		}
+		for e := uint64(0); e < extents; e++ {
+			if _, ok = read(indexSize); !ok {
+				return locations
+			}
+			offset, ok1 := read(offsetSize)
+			length, ok2 := read(lengthSize)
+			if !ok1 || !ok2 {
+				return locations
+			}
+			// Offsets and lengths are 64-bit fields; skip extents that overflow int64
+			start := base + offset
+			if e == 0 && method == 0 && start >= base && start <= math.MaxInt64 && length <= math.MaxInt64-start {
+				locations[uint32(id)] = [2]int64{int64(start), int64(length)}
+			}
+		}
+	}
+	return locations
+}
+
+// heifLargestExtent records the largest ispe property, which is the full
+// image rather than one of its grid tiles or thumbnails
+func heifLargestExtent(f *os.File, start, stop int64, info *Info) {
+	walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+		if typ != "ispe" {
+			return nil
+		}
+		b, err := readRange(f, start, stop, 64)
+		if err != nil || len(b) < 12 {
+			return nil
+		}
+		w, h := int(binary.BigEndian.Uint32(b[4:])), int(binary.BigEndian.Uint32(b[8:]))
+		if w*h > info.Width*info.Height {
+			info.Width, info.Height = w, h
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// EXIF 2.31 UTC offsets of the DateTime, DateTimeOriginal and DateTimeDigitized
+// tags, e.g. "+09:00". goexif predates them, so offsetParser loads them.
+const (
+	OffsetTime          exif.FieldName = "OffsetTime"
+	OffsetTimeOriginal  exif.FieldName = "OffsetTimeOriginal"
+	OffsetTimeDigitized exif.FieldName = "OffsetTimeDigitized"
+)
+
+var offsetFields = map[uint16]exif.FieldName{
+	0x9010: OffsetTime,
+	0x9011: OffsetTimeOriginal,
+	0x9012: OffsetTimeDigitized,
+}
+
+// offsetParser re-reads the EXIF sub-IFD for the offset tags. It never fails
+// a decode: files without them simply have no offsets.
+type offsetParser struct{}
+
+func (offsetParser) Parse(x *exif.Exif) error {
+	tag, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := tag.Int64(0)
+	if err != nil || offset <= 0 || offset >= int64(len(x.Raw)) {
+		return nil
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return nil
+	}
+	x.LoadTags(dir, offsetFields, false)
+	return nil
+}
+
+func init() {
+	exif.RegisterParsers(offsetParser{})
+}
+
+// EXIFOffset returns the zone recorded in an OffsetTime* tag, or nil when the
+// tag is absent or malformed
+func EXIFOffset(x *exif.Exif, name exif.FieldName) *time.Location {
+	tag, err := x.Get(name)
+	if err != nil {
+		return nil
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return nil
+	}
+	loc, err := ParseOffset(s)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// ParseOffset parses a "+09:00" / "-0530" style UTC offset into a fixed zone
+func ParseOffset(s string) (*time.Location, error) {
+	s = strings.TrimSpace(strings.TrimRight(s, "\x00"))
+	t, err := time.Parse("-07:00", s)
+	if err != nil {
+		if t, err = time.Parse("-0700", s); err != nil {
+			return nil, fmt.Errorf("invalid UTC offset %q", s)
+		}
+	}
+	_, offset := t.Zone()
+	return time.FixedZone(s, offset), nil
+}
@@ -0,0 +1,303 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	_ "image/png" // Registers PNG with image.Decode
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// maxDecodePixels caps the images Validate decodes in full: the decoder holds
+// the whole image in memory, and a 100 megapixel image already takes several
+// hundred MB
+const maxDecodePixels = 100_000_000
+
+// TooLargeToDecode is returned by Validate with full set for an image that
+// passed the structural checks but is over the size the full decode allows.
+// It is not a sign of damage.
+const TooLargeToDecode = "too large to decode"
+
+// Validate checks that a file is structurally complete and returns why it
+// isn't, or "" when it looks intact. Images have their headers and body
+// structure checked (JPEG markers up to the end-of-image marker, PNG chunk
+// CRCs, the GIF trailer); videos have their container atoms or elements
+// checked against the file size. With full set, JPEG, PNG and GIF files are
+// also decoded pixel by pixel, which catches corrupt entropy-coded data at
+// the cost of a much slower pass; images over maxDecodePixels are not decoded
+// and return TooLargeToDecode instead.
+func Validate(path string, full bool) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+	size := st.Size()
+	if size == 0 {
+		return "empty file"
+	}
+
+	var reason string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		reason = validateJPEG(f)
+	case ".png":
+		reason = validatePNG(f)
+	case ".gif":
+		reason = validateGIF(f, size)
+	case ".tif", ".tiff":
+		if _, err := tiff.Decode(f); err != nil {
+			reason = fmt.Sprintf("corrupt TIFF header: %v", err)
+		}
+	case ".webp":
+		reason = validateRIFF(f, size, "WEBP")
+	case ".avi":
+		reason = validateRIFF(f, size, "AVI ")
+	case ".heic", ".heif":
+		reason = validateBoxes(f, size, "meta")
+	case ".mp4", ".mov", ".m4v":
+		reason = validateBoxes(f, size, "moov")
+	case ".mkv":
+		reason = validateMKV(f, size)
+	case ".pdf":
+		reason = validatePDF(f, size)
+	}
+	if reason != "" || !full {
+		return reason
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Sprintf("unreadable: %v", err)
+		}
+		cfg, _, err := image.DecodeConfig(bufio.NewReader(f))
+		if err != nil {
+			return fmt.Sprintf("image data does not decode: %v", err)
+		}
+		if int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+			return TooLargeToDecode
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Sprintf("unreadable: %v", err)
+		}
+		if _, _, err := image.Decode(bufio.NewReader(f)); err != nil {
+			return fmt.Sprintf("image data does not decode: %v", err)
+		}
+	}
+	return ""
+}
+
+// validateJPEG walks the marker segments to the first scan, then looks for
+// the end-of-image marker. Inside entropy-coded data every 0xFF is followed
+// by 0x00 or a restart marker, so the first FFD9 after the scan is the main
+// image's end, and data some cameras append after it is ignored.
+func validateJPEG(f *os.File) string {
+	if _, err := jpeg.DecodeConfig(f); err != nil {
+		return fmt.Sprintf("corrupt JPEG header: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+	r := bufio.NewReader(f)
+
+	var marker [4]byte
+	if _, err := io.ReadFull(r, marker[:2]); err != nil || marker[0] != 0xFF || marker[1] != 0xD8 {
+		return "not a JPEG (missing start-of-image marker)"
+	}
+	for {
+		if _, err := io.ReadFull(r, marker[:2]); err != nil {
+			return "truncated JPEG (ends before image data)"
+		}
+		if marker[0] != 0xFF {
+			return fmt.Sprintf("corrupt JPEG (expected marker, found 0x%02X)", marker[0])
+		}
+		if marker[1] == 0xFF { // Fill byte before a marker
+			r.UnreadByte()
+			continue
+		}
+		if _, err := io.ReadFull(r, marker[2:4]); err != nil {
+			return "truncated JPEG (ends inside a marker segment)"
+		}
+		length := int64(binary.BigEndian.Uint16(marker[2:4])) - 2
+		if length < 0 {
+			return fmt.Sprintf("corrupt JPEG (bad length for marker 0x%02X)", marker[1])
+		}
+		if n, _ := io.CopyN(io.Discard, r, length); n != length {
+			return "truncated JPEG (ends inside a marker segment)"
+		}
+		if marker[1] == 0xDA { // Start of scan: entropy-coded data follows
+			break
+		}
+	}
+
+	for prev := byte(0); ; {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "truncated JPEG (missing end-of-image marker)"
+		}
+		if prev == 0xFF && b == 0xD9 {
+			return ""
+		}
+		prev = b
+	}
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// validatePNG reads every chunk, checking its CRC, through to IEND
+func validatePNG(f *os.File) string {
+	r := bufio.NewReader(f)
+	sig := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, sig); err != nil || !bytes.Equal(sig, pngSignature) {
+		return "not a PNG (bad signature)"
+	}
+
+	var hdr [8]byte
+	for first := true; ; first = false {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return "truncated PNG (missing IEND chunk)"
+		}
+		length := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		if length > 1<<31-1 {
+			return fmt.Sprintf("corrupt PNG (bad length for %q chunk)", typ)
+		}
+		if first && typ != "IHDR" {
+			return "corrupt PNG (first chunk is not IHDR)"
+		}
+
+		crc := crc32.NewIEEE()
+		crc.Write(hdr[4:8])
+		if n, _ := io.CopyN(crc, r, length); n != length {
+			return fmt.Sprintf("truncated PNG (ends inside %q chunk)", typ)
+		}
+		var sum [4]byte
+		if _, err := io.ReadFull(r, sum[:]); err != nil {
+			return fmt.Sprintf("truncated PNG (ends inside %q chunk)", typ)
+		}
+		if binary.BigEndian.Uint32(sum[:]) != crc.Sum32() {
+			return fmt.Sprintf("corrupt PNG (CRC mismatch in %q chunk)", typ)
+		}
+		if typ == "IEND" {
+			return ""
+		}
+	}
+}
+
+// validateGIF checks the header and the trailer byte that ends every GIF
+func validateGIF(f *os.File, size int64) string {
+	if _, err := gif.DecodeConfig(f); err != nil {
+		return fmt.Sprintf("corrupt GIF header: %v", err)
+	}
+	b, err := readRange(f, size-1, size, 1)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+	if b[0] != 0x3B {
+		return "truncated GIF (missing trailer)"
+	}
+	return ""
+}
+
+// validateRIFF checks the RIFF form type and that the declared size fits the file
+func validateRIFF(f *os.File, size int64, form string) string {
+	hdr, err := readRange(f, 0, 12, 12)
+	if err != nil || string(hdr[:4]) != "RIFF" || string(hdr[8:12]) != form {
+		return fmt.Sprintf("not a RIFF %s file (bad header)", strings.TrimSpace(form))
+	}
+	if declared := int64(binary.LittleEndian.Uint32(hdr[4:8])) + 8; declared > size {
+		return fmt.Sprintf("truncated (header declares %d bytes, file has %d)", declared, size)
+	}
+	return ""
+}
+
+// validateBoxes checks that every top-level box fits in the file and that the
+// box holding the movie or image metadata is present
+func validateBoxes(f *os.File, size int64, required string) string {
+	found := false
+	err := walkBoxes(f, 0, size, func(typ string, start, stop int64) error {
+		if typ == required {
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Sprintf("truncated or corrupt container: %v", err)
+	}
+	if !found {
+		return fmt.Sprintf("missing %q box", required)
+	}
+	return ""
+}
+
+// validateMKV checks the EBML header and that the Segment fits in the file.
+// Live recordings may leave the Segment size unknown, which is allowed.
+func validateMKV(f *os.File, size int64) string {
+	id, idLen, err := readVint(f, false)
+	if err != nil || id != ebmlHeader {
+		return "not a Matroska file (bad EBML header)"
+	}
+	hdrSize, sizeLen, err := readVint(f, true)
+	if err != nil {
+		return "corrupt Matroska (bad EBML header size)"
+	}
+	pos := int64(idLen+sizeLen) + int64(hdrSize)
+	if _, err := f.Seek(pos, io.SeekStart); err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+
+	id, idLen, err = readVint(f, false)
+	if err != nil || id != mkvSegment {
+		return "truncated Matroska (missing Segment)"
+	}
+	segSize, sizeLen, err := readVint(f, true)
+	if errors.Is(err, errUnknownSize) {
+		return ""
+	}
+	if err != nil {
+		return "corrupt Matroska (bad Segment size)"
+	}
+	if segSize > uint64(size) {
+		return fmt.Sprintf("truncated Matroska (Segment of %d bytes, file has %d bytes)", segSize, size)
+	}
+	if end := pos + int64(idLen+sizeLen) + int64(segSize); end > size {
+		return fmt.Sprintf("truncated Matroska (Segment ends at %d, file has %d bytes)", end, size)
+	}
+	return ""
+}
+
+// validatePDF checks for the %PDF header and an %%EOF marker near the end
+func validatePDF(f *os.File, size int64) string {
+	if b, err := readRange(f, 0, 5, 5); err != nil || string(b) != "%PDF-" {
+		return "not a PDF (missing %PDF header)"
+	}
+	start := size - 1024
+	if start < 0 {
+		start = 0
+	}
+	tail, err := readRange(f, start, size, 1024)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return "truncated PDF (missing %%EOF marker)"
+	}
+	return ""
+}
@@ -0,0 +1,507 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// mp4Epoch is the origin of MP4/QuickTime timestamps
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mkvEpoch is the origin of Matroska DateUTC
+var mkvEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// extractMP4 reads creation time and duration from mvhd, the dimensions
+// and codec of the first video track, the codec of the first audio track and
+// the recording location
+func extractMP4(f *os.File, info *Info) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return
+	}
+
+	walkBoxes(f, 0, end, func(typ string, start, stop int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+			switch typ {
+			case "mvhd":
+				mp4MovieHeader(f, start, stop, info)
+			case "trak":
+				mp4Track(f, start, stop, info)
+			case "udta":
+				if info.Location == nil {
+					info.Location = mp4UserDataLocation(f, start, stop)
+				}
+			case "meta":
+				// The QuickTime key is more precise than ©xyz where both exist
+				if loc := mp4MetaLocation(f, start, stop); loc != nil {
+					info.Location = loc
+				}
+			}
+			return nil
+		})
+		return io.EOF // mdat after moov holds nothing we read
+	})
+}
+
+func mp4MovieHeader(f *os.File, start, stop int64, info *Info) {
+	b, err := readRange(f, start, stop, 256)
+	if err != nil || len(b) < 20 {
+		return
+	}
+	var created, timescale, duration uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return
+		}
+		created = binary.BigEndian.Uint64(b[4:])
+		timescale = uint64(binary.BigEndian.Uint32(b[20:]))
+		duration = binary.BigEndian.Uint64(b[24:])
+	} else {
+		created = uint64(binary.BigEndian.Uint32(b[4:]))
+		timescale = uint64(binary.BigEndian.Uint32(b[12:]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:]))
+	}
+	// Unset creation times are 0 (1904); some encoders write Unix-epoch
+	// values, which land before 1970 here and are ignored too
+	if t := mp4Epoch.Add(time.Duration(created) * time.Second); created != 0 && t.Year() >= 1970 {
+		info.Created = t
+		info.CreatedUTC = true
+	}
+	if timescale > 0 && duration != math.MaxUint32 && duration != math.MaxUint64 {
+		info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+}
+
+// mp4Track fills in the first video and first audio track found
+func mp4Track(f *os.File, start, stop int64, info *Info) {
+	var handler, codec string
+	var width, height int
+
+	walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+		switch typ {
+		case "tkhd":
+			b, err := readRange(f, start, stop, 256)
+			if err != nil || len(b) < 84 {
+				return nil
+			}
+			// Width and height are 16.16 fixed point at the end of the box
+			width = int(binary.BigEndian.Uint32(b[len(b)-8:]) >> 16)
+			height = int(binary.BigEndian.Uint32(b[len(b)-4:]) >> 16)
+		case "mdia":
+			walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+				switch typ {
+				case "hdlr":
+					if b, err := readRange(f, start, stop, 1024); err == nil && len(b) >= 12 {
+						handler = string(b[8:12])
+					}
+				case "minf":
+					codec = mp4SampleEntry(f, start, stop)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	switch handler {
+	case "vide":
+		if info.VideoCodec == "" {
+			info.VideoCodec = codecName(codec)
+			if info.Width == 0 {
+				info.Width, info.Height = width, height
+			}
+		}
+	case "soun":
+		if info.AudioCodec == "" {
+			info.AudioCodec = codecName(codec)
+		}
+	}
+}
+
+// mp4SampleEntry returns the format of the first sample description in minf/stbl/stsd
+func mp4SampleEntry(f *os.File, start, stop int64) string {
+	var format string
+	walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+		if typ != "stbl" {
+			return nil
+		}
+		walkBoxes(f, start, stop, func(typ string, start, stop int64) error {
+			if typ != "stsd" {
+				return nil
+			}
+			// version/flags, entry count, then the first entry's size and format
+			if b, err := readRange(f, start, minInt64(stop, start+16), 16); err == nil && len(b) >= 16 {
+				format = string(b[12:16])
+			}
+			return io.EOF
+		})
+		return io.EOF
+	})
+	return format
+}
+
+// extractAVI reads the main AVI header, the first video and audio stream
+// headers and the IDIT/ICRD creation date (INFO may follow the frames, so
+// every top-level chunk is visited, but only headers are read)
+func extractAVI(f *os.File, info *Info) {
+	var riff [12]byte
+	if _, err := io.ReadFull(f, riff[:]); err != nil || string(riff[:4]) != "RIFF" || string(riff[8:]) != "AVI " {
+		return
+	}
+	end := int64(binary.LittleEndian.Uint32(riff[4:])) + 8
+	if size, err := f.Seek(0, io.SeekEnd); err == nil && size < end {
+		end = size
+	}
+	var microSecPerFrame, totalFrames uint32
+	walkRIFF(f, 12, end, func(id string, start, stop int64) error {
+		switch id {
+		case "avih":
+			b, err := readRange(f, start, stop, 256)
+			if err != nil || len(b) < 40 {
+				return nil
+			}
+			microSecPerFrame = binary.LittleEndian.Uint32(b[0:])
+			totalFrames = binary.LittleEndian.Uint32(b[16:])
+			info.Width = int(binary.LittleEndian.Uint32(b[32:]))
+			info.Height = int(binary.LittleEndian.Uint32(b[36:]))
+		case "strl":
+			aviStream(f, start, stop, info)
+		case "IDIT", "ICRD":
+			if !info.Created.IsZero() {
+				return nil
+			}
+			if b, err := readRange(f, start, stop, 256); err == nil {
+				info.Created = parseRIFFDate(string(b))
+			}
+		}
+		return nil // movi (the frames) and idx1 are skipped over
+	})
+	if microSecPerFrame > 0 && totalFrames > 0 {
+		info.Duration = time.Duration(totalFrames) * time.Duration(microSecPerFrame) * time.Microsecond
+	}
+}
+
+// aviStream records the codec of the first video and audio streams
+func aviStream(f *os.File, start, stop int64, info *Info) {
+	var streamType, handler string
+	walkRIFF(f, start, stop, func(id string, start, stop int64) error {
+		switch id {
+		case "strh":
+			if b, err := readRange(f, start, stop, 256); err == nil && len(b) >= 8 {
+				streamType, handler = string(b[:4]), string(b[4:8])
+			}
+		case "strf":
+			b, err := readRange(f, start, stop, 1024)
+			if err != nil {
+				return nil
+			}
+			switch streamType {
+			case "vids":
+				// BITMAPINFOHEADER.biCompression is more reliable than the handler
+				if len(b) >= 20 && b[16] != 0 {
+					handler = string(b[16:20])
+				}
+				if info.VideoCodec == "" {
+					info.VideoCodec = codecName(handler)
+				}
+			case "auds":
+				// WAVEFORMATEX.wFormatTag
+				if len(b) >= 2 && info.AudioCodec == "" {
+					info.AudioCodec = waveFormatName(binary.LittleEndian.Uint16(b))
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func waveFormatName(tag uint16) string {
+	switch tag {
+	case 0x0001:
+		return "PCM"
+	case 0x0055:
+		return "MP3"
+	case 0x00FF, 0x1600, 0x1610:
+		return "AAC"
+	case 0x2000:
+		return "AC-3"
+	}
+	return ""
+}
+
+// walkRIFF calls fn for every chunk between start and end, descending into
+// LIST chunks: fn sees the list type (e.g. "strl") with the list's contents
+func walkRIFF(f *os.File, start, end int64, fn func(id string, start, stop int64) error) error {
+	var hdr [12]byte
+	for pos := start; pos+8 <= end; {
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(f, hdr[:8]); err != nil {
+			return err
+		}
+		id := string(hdr[:4])
+		size := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		stop := pos + 8 + size
+		if stop > end {
+			stop = end
+		}
+
+		if id == "LIST" && size >= 4 {
+			if _, err := io.ReadFull(f, hdr[8:12]); err != nil {
+				return err
+			}
+			listType := string(hdr[8:12])
+			var err error
+			switch listType {
+			case "hdrl", "INFO":
+				err = walkRIFF(f, pos+12, stop, fn)
+			default:
+				err = fn(listType, pos+12, stop)
+			}
+			if err != nil {
+				return err
+			}
+		} else if err := fn(id, pos+8, stop); err != nil {
+			return err
+		}
+		pos = stop + size&1 // Chunks are padded to even sizes
+	}
+	return nil
+}
+
+// parseRIFFDate parses IDIT ("Sun Jul 14 10:20:30 2019") and ICRD
+// ("2019-07-14") dates as camera wall-clock times
+func parseRIFFDate(s string) time.Time {
+	s = strings.Join(strings.Fields(strings.TrimRight(s, "\x00")), " ")
+	for _, layout := range []string{
+		"Mon Jan 2 15:04:05 2006",
+		"2006:01:02 15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Matroska element IDs (EBML)
+const (
+	ebmlHeader       = 0x1A45DFA3
+	mkvSegment       = 0x18538067
+	mkvInfo          = 0x1549A966
+	mkvTracks        = 0x1654AE6B
+	mkvCluster       = 0x1F43B675
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDuration      = 0x4489
+	mkvDateUTC       = 0x4461
+	mkvTrackEntry    = 0xAE
+	mkvTrackType     = 0x83
+	mkvCodecID       = 0x86
+	mkvVideo         = 0xE0
+	mkvPixelWidth    = 0xB0
+	mkvPixelHeight   = 0xBA
+)
+
+// errUnknownSize marks a master element whose size is not recorded (live streams)
+var errUnknownSize = errors.New("unknown element size")
+
+// extractMKV reads segment info (duration, date) and the first video and
+// audio tracks, stopping at the first cluster of frames
+func extractMKV(f *os.File, info *Info) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return
+	}
+	timecodeScale := uint64(1000000)
+	var duration float64
+
+	walkEBML(f, 0, end, func(id uint64, start, stop int64) error {
+		switch id {
+		case ebmlHeader:
+			return nil
+		case mkvSegment:
+			return walkEBML(f, start, stop, func(id uint64, start, stop int64) error {
+				switch id {
+				case mkvInfo:
+					walkEBML(f, start, stop, func(id uint64, start, stop int64) error {
+						b, err := readRange(f, start, stop, 64)
+						if err != nil {
+							return nil
+						}
+						switch id {
+						case mkvTimecodeScale:
+							timecodeScale = beUintN(b)
+						case mkvDuration:
+							duration = ebmlFloat(b)
+						case mkvDateUTC:
+							if len(b) == 8 {
+								info.Created = mkvEpoch.Add(time.Duration(int64(binary.BigEndian.Uint64(b))))
+								info.CreatedUTC = true
+							}
+						}
+						return nil
+					})
+				case mkvTracks:
+					walkEBML(f, start, stop, func(id uint64, start, stop int64) error {
+						if id == mkvTrackEntry {
+							mkvTrack(f, start, stop, info)
+						}
+						return nil
+					})
+				case mkvCluster:
+					return io.EOF
+				}
+				return nil
+			})
+		}
+		return io.EOF // Not Matroska
+	})
+
+	if duration > 0 {
+		info.Duration = time.Duration(duration * float64(timecodeScale))
+	}
+}
+
+func mkvTrack(f *os.File, start, stop int64, info *Info) {
+	var trackType uint64
+	var codec string
+	var width, height int
+	walkEBML(f, start, stop, func(id uint64, start, stop int64) error {
+		switch id {
+		case mkvTrackType:
+			if b, err := readRange(f, start, stop, 8); err == nil {
+				trackType = beUintN(b)
+			}
+		case mkvCodecID:
+			if b, err := readRange(f, start, stop, 256); err == nil {
+				codec = string(b)
+			}
+		case mkvVideo:
+			walkEBML(f, start, stop, func(id uint64, start, stop int64) error {
+				b, err := readRange(f, start, stop, 8)
+				if err != nil {
+					return nil
+				}
+				switch id {
+				case mkvPixelWidth:
+					width = int(beUintN(b))
+				case mkvPixelHeight:
+					height = int(beUintN(b))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	switch trackType {
+	case 1:
+		if info.VideoCodec == "" {
+			info.VideoCodec = codecName(codec)
+			info.Width, info.Height = width, height
+		}
+	case 2:
+		if info.AudioCodec == "" {
+			info.AudioCodec = codecName(codec)
+		}
+	}
+}
+
+// walkEBML calls fn for each element between start and end. Elements of
+// unknown size are given the rest of the range.
+func walkEBML(f *os.File, start, end int64, fn func(id uint64, start, stop int64) error) error {
+	for pos := start; pos < end; {
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		id, idLen, err := readVint(f, false)
+		if err != nil {
+			return err
+		}
+		size, sizeLen, err := readVint(f, true)
+		if err != nil && err != errUnknownSize {
+			return err
+		}
+		dataStart := pos + int64(idLen) + int64(sizeLen)
+		stop := dataStart + int64(size)
+		if err == errUnknownSize || stop > end || stop < dataStart {
+			stop = end
+		}
+		if err := fn(id, dataStart, stop); err != nil {
+			return err
+		}
+		pos = stop
+	}
+	return nil
+}
+
+// readVint reads an EBML variable-length integer. IDs keep their length
+// marker bit; sizes have it stripped and report all-ones as unknown.
+func readVint(r io.Reader, stripMarker bool) (uint64, int, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, errors.New("invalid EBML length")
+	}
+
+	value := uint64(first[0])
+	if stripMarker {
+		value &= uint64(0xff >> length)
+	}
+	allOnes := value == uint64(0xff>>length)
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, 0, err
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xff
+	}
+	if stripMarker && allOnes {
+		return 0, length, errUnknownSize
+	}
+	return value, length, nil
+}
+
+// beUintN reads a big-endian unsigned integer of any length up to 8 bytes
+func beUintN(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func ebmlFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,288 @@
+// Package metrics keeps the server's counters and histograms and writes them
+// in the Prometheus text exposition format (see handlers.HandleMetrics).
+//
+// Instruments are package variables, updated where the work happens; values
+// that already live elsewhere (queue depth, file counts, scan progress) are
+// written as gauges at scrape time instead of being mirrored here.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the Prometheus text format version written by WriteAll
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Prefix starts every metric name
+const Prefix = "media_server_"
+
+// Instruments updated across the server
+var (
+	HTTPRequests = NewCounter("http_requests_total",
+		"HTTP requests served, by route pattern and status code", "route", "code")
+	HTTPDuration = NewHistogram("http_request_duration_seconds",
+		"HTTP request latency by route pattern (event streams count until they close)",
+		[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}, "route")
+	XattrWriteFailures = NewCounter("xattr_write_failures_total",
+		"Queued tag and rating writes to extended attributes that failed (and were re-queued)", "kind")
+	ScanDuration = NewHistogram("scan_duration_seconds",
+		"Duration of scan pipeline runs, by kind (startup, rescan, freshness)",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}, "kind")
+	StateSwaps = NewCounter("state_swaps_total",
+		"Library state rebuilds swapped in (scans, volume changes, index rebuilds)")
+)
+
+// collector is a registered counter or histogram
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// Counter is a monotonically increasing value, optionally split by labels
+type Counter struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // Keyed by rendered label set
+}
+
+// NewCounter creates and registers a counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: Prefix + name, help: help, labels: labels, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the series with the given label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := labelSet(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	if len(c.values) == 0 && len(c.labels) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+		return
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// Histogram counts observations into cumulative buckets, optionally split by labels
+type Histogram struct {
+	name, help string
+	labels     []string
+	leLabels   []string  // labels plus "le", for bucket lines
+	buckets    []float64 // Upper bounds, ascending; +Inf is implied
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries // Keyed by label values joined with \xff
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // Per bucket, not cumulative; the last is +Inf
+	sum         float64
+	count       uint64
+}
+
+// NewHistogram creates and registers a histogram with the given bucket upper
+// bounds (ascending) and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: Prefix + name, help: help, labels: labels, buckets: buckets,
+		leLabels: append(append([]string(nil), labels...), "le"),
+		series:   make(map[string]*histogramSeries)}
+	register(h)
+	return h
+}
+
+// Observe records one value in the series with the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, v) // First bucket with bound >= v
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// ObserveSince records the time elapsed since start, in seconds
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := h.series[k]
+		le := len(s.labelValues)
+		values := append(append(make([]string, 0, le+1), s.labelValues...), "")
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			values[le] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.leLabels, values), cumulative)
+		}
+		values[le] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.leLabels, values), s.count)
+		labels := labelSet(h.labels, s.labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	}
+}
+
+// WriteGauge writes a single unlabelled gauge, for values read at scrape time
+func WriteGauge(w io.Writer, name, help string, value float64) {
+	writeHeader(w, Prefix+name, help, "gauge")
+	fmt.Fprintf(w, "%s%s %s\n", Prefix, name, formatValue(value))
+}
+
+// WriteAll writes every registered counter and histogram
+func WriteAll(w io.Writer) {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Instrument records the count and latency of every request served by mux,
+// labelled with the pattern of the route that handled it
+func Instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+		HTTPDuration.ObserveSince(start, route)
+		HTTPRequests.Inc(route, strconv.Itoa(rec.status))
+	})
+}
+
+// statusRecorder remembers the status a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = status, true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelSet renders {name="value",...}, or "" without labels. Missing values
+// are empty.
+func labelSet(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
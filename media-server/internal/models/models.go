@@ -21,6 +21,40 @@ type FileInfo struct {
 	NeedsDateCorrection bool
 	LargeDiscrepancy    bool
 	MaxDiffHours        int
+	TimezoneMismatch    bool // Dates disagree only by a camera clock set to another zone
+
+	// Identity fields for move/rename tracking
+	Inode       uint64
+	Device      uint64
+	ContentHash string // Quick hash of size + head + tail (see scanner.quickHash)
+
+	// Volume the file lives on (see library.VolumeRoot). Offline files are kept
+	// with their cached metadata while the volume is unmounted.
+	Volume  string
+	Offline bool
+
+	// GPS position from EXIF or a video's ISO 6709 location (nil when untagged)
+	Location *GeoLocation
+
+	// Curation fields, mirrored to Spotlight or XMP (see scanner.SetFileRating)
+	Rating     int    // 0–5 stars, 0 = unrated
+	ColorLabel string // Finder label color, e.g. "red" ("" = none)
+
+	// Why the integrity validator flagged the file as broken ("" when intact or
+	// not yet checked). Derived on index build from cached check results.
+	BrokenReason string
+
+	// Date the file is filed under on the 🗓 timeline: the user's corrected
+	// date, else EarliestDate, else Created. Derived on index build, not cached.
+	TimelineDate time.Time
+}
+
+// GeoLocation is a WGS 84 position
+type GeoLocation struct {
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Altitude    float64 `json:"altitude,omitempty"` // Meters above sea level
+	HasAltitude bool    `json:"-"`
 }
 
 // CategoryPreview represents a tag category with preview information
@@ -30,16 +64,73 @@ type CategoryPreview struct {
 	PreviewFile FileInfo
 }
 
-// TagOperation represents a request to add or remove a tag from a file
+// TagOperation represents a request to add or remove a tag from a file.
+// ETag, when set, must match the file's current one (see scanner.FileETag).
 type TagOperation struct {
 	FilePath string `json:"filePath"`
 	Tag      string `json:"tag"`
+	ETag     string `json:"etag,omitempty"`
 }
 
-// BatchTagOperation represents a request to add or remove a tag from multiple files
+// BatchTagOperation represents a request to add or remove a tag from multiple
+// files. ETags optionally maps paths to the ETag each was loaded with.
 type BatchTagOperation struct {
-	FilePaths []string `json:"filePaths"`
-	Tag       string   `json:"tag"`
+	FilePaths []string          `json:"filePaths"`
+	Tag       string            `json:"tag"`
+	ETags     map[string]string `json:"etags,omitempty"`
+}
+
+// RatingOperation sets the star rating and/or color label of a file. Omitted
+// fields are left unchanged; an empty label clears it.
+type RatingOperation struct {
+	FilePath string  `json:"filePath"`
+	Rating   *int    `json:"rating,omitempty"`
+	Label    *string `json:"label,omitempty"`
+	ETag     string  `json:"etag,omitempty"`
+}
+
+// BatchRatingOperation sets the star rating and/or color label of multiple files
+type BatchRatingOperation struct {
+	FilePaths []string          `json:"filePaths"`
+	Rating    *int              `json:"rating,omitempty"`
+	Label     *string           `json:"label,omitempty"`
+	ETags     map[string]string `json:"etags,omitempty"`
+}
+
+// CollectionOperation creates or edits a collection. Files are given either
+// as FilePaths or, with notes, as Items; FilePath and Note set one item's note.
+type CollectionOperation struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	FilePaths   []string         `json:"filePaths,omitempty"`
+	Items       []CollectionItem `json:"items,omitempty"`
+	FilePath    string           `json:"filePath,omitempty"`
+	Note        string           `json:"note,omitempty"`
+}
+
+// CollectionItem is a file to add to a collection with an optional note
+type CollectionItem struct {
+	Path string `json:"path"`
+	Note string `json:"note,omitempty"`
+}
+
+// UserOperation creates or edits a user account. On update, an empty
+// Password or Role is left unchanged.
+type UserOperation struct {
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// TokenOperation creates or revokes an API token. Role defaults to the
+// caller's; Scope limits its writes (e.g. "tags", "" = unscoped); ExpiresIn
+// is a Go duration such as "720h" ("" never expires).
+type TokenOperation struct {
+	ID        int64  `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ExpiresIn string `json:"expiresIn,omitempty"`
 }
 
 // RevealRequest represents a request to reveal a file in Finder
@@ -56,23 +147,31 @@ type WriteQueueItem struct {
 
 // FileMetadata represents EXIF and file system metadata for a file
 type FileMetadata struct {
-	FileName     string    `json:"fileName"`
-	FileSize     int64     `json:"fileSize"`
-	Created      time.Time `json:"created"`
-	Modified     time.Time `json:"modified"`
-	Width        int       `json:"width,omitempty"`
-	Height       int       `json:"height,omitempty"`
-	Make         string    `json:"make,omitempty"`
-	Model        string    `json:"model,omitempty"`
-	DateTime     string    `json:"dateTime,omitempty"`
-	Orientation  string    `json:"orientation,omitempty"`
-	ISO          string    `json:"iso,omitempty"`
-	FNumber      string    `json:"fNumber,omitempty"`
-	ExposureTime string    `json:"exposureTime,omitempty"`
-	FocalLength  string    `json:"focalLength,omitempty"`
-	Flash        string    `json:"flash,omitempty"`
-	WhiteBalance string    `json:"whiteBalance,omitempty"`
-	Artist       string    `json:"artist,omitempty"`
-	Copyright    string    `json:"copyright,omitempty"`
-	Software     string    `json:"software,omitempty"`
+	FileName     string       `json:"fileName"`
+	FileSize     int64        `json:"fileSize"`
+	Created      time.Time    `json:"created"`
+	Modified     time.Time    `json:"modified"`
+	Width        int          `json:"width,omitempty"`
+	Height       int          `json:"height,omitempty"`
+	Make         string       `json:"make,omitempty"`
+	Model        string       `json:"model,omitempty"`
+	DateTime     string       `json:"dateTime,omitempty"`
+	Orientation  string       `json:"orientation,omitempty"`
+	ISO          string       `json:"iso,omitempty"`
+	FNumber      string       `json:"fNumber,omitempty"`
+	ExposureTime string       `json:"exposureTime,omitempty"`
+	FocalLength  string       `json:"focalLength,omitempty"`
+	Flash        string       `json:"flash,omitempty"`
+	WhiteBalance string       `json:"whiteBalance,omitempty"`
+	Artist       string       `json:"artist,omitempty"`
+	Copyright    string       `json:"copyright,omitempty"`
+	Software     string       `json:"software,omitempty"`
+	Duration     string       `json:"duration,omitempty"`
+	VideoCodec   string       `json:"videoCodec,omitempty"`
+	AudioCodec   string       `json:"audioCodec,omitempty"`
+	Location     *GeoLocation `json:"location,omitempty"`
+	Broken       string       `json:"broken,omitempty"` // Integrity check failure reason
+	Rating       int          `json:"rating,omitempty"`
+	ColorLabel   string       `json:"colorLabel,omitempty"`
+	ETag         string       `json:"etag,omitempty"` // Revision of the editable fields, see scanner.FileETag
 }
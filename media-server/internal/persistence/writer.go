@@ -1,14 +1,21 @@
 package persistence
 
 import (
+	"context"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/tdsanchez/PostMac/internal/metrics"
 	"github.com/tdsanchez/PostMac/internal/models"
 	"github.com/tdsanchez/PostMac/internal/scanner"
 	"github.com/tdsanchez/PostMac/internal/state"
 )
 
+func init() {
+	scanner.SetPendingWrites(ApplyPending)
+}
+
 // QueueDiskWrite adds a tag update to the write queue for batched persistence.
 // filePath is now always absolute.
 func QueueDiskWrite(filePath string, tags []string) {
@@ -34,81 +41,209 @@ func QueueDiskWrite(filePath string, tags []string) {
 	state.SetWriteQueue(writeQueue)
 }
 
-// GetQueueSize returns the current size of the write queue
-func GetQueueSize() int {
+// PendingTags returns the queued (not yet persisted) tags for a file, if any.
+// Used when re-reading a file from disk so unflushed edits are not lost.
+func PendingTags(filePath string) ([]string, bool) {
 	state.LockWriteQueue()
 	defer state.UnlockWriteQueue()
-	return len(state.GetWriteQueue())
+
+	writeQueue := state.GetWriteQueue()
+	for i := len(writeQueue) - 1; i >= 0; i-- {
+		if writeQueue[i].FilePath == filePath {
+			return writeQueue[i].Tags, true
+		}
+	}
+	return nil, false
 }
 
-// ProcessBatchWrites is the background goroutine that persists queued tag changes to disk.
-// Runs every 5 seconds, batching multiple tag operations into efficient bulk writes.
-func ProcessBatchWrites() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// ApplyPending overlays the tag and rating edits still waiting in the write
+// queues onto f, a file just read from disk
+func ApplyPending(f *models.FileInfo) {
+	if tags, ok := PendingTags(f.Path); ok {
+		f.Tags = tags
+	}
+	if rating, label, ok := PendingRating(f.Path); ok {
+		f.Rating, f.ColorLabel = rating, label
+	}
+}
 
-	for range ticker.C {
-		state.LockWriteQueue()
-		writeQueue := state.GetWriteQueue()
-		if len(writeQueue) == 0 {
-			state.UnlockWriteQueue()
-			continue
-		}
+// ratingWrite is a queued star rating and color label for one file
+type ratingWrite struct {
+	Rating int
+	Label  string
+}
 
-		// Copy queue and clear it atomically
-		items := make([]models.WriteQueueItem, len(writeQueue))
-		copy(items, writeQueue)
-		state.SetWriteQueue([]models.WriteQueueItem{})
-		state.UnlockWriteQueue()
+// Rating writes are queued separately from tags so either can change without
+// waiting for or overwriting the other
+var (
+	ratingQueueMu sync.Mutex
+	ratingQueue   = make(map[string]ratingWrite)
+)
 
-		// Write to disk outside the lock (can take time with APFS)
-		dbCache := state.GetCache()
-		for _, item := range items {
-			// FilePath is now always absolute
-			if err := scanner.SetMacOSTags(item.FilePath, item.Tags); err != nil {
-				log.Printf("Error writing tags to disk for %s: %v", item.FilePath, err)
-				// Re-queue on failure (will retry in next batch)
-				QueueDiskWrite(item.FilePath, item.Tags)
-			} else if dbCache != nil {
-				// Also update the database cache
-				if err := dbCache.UpdateFileTags(item.FilePath, item.Tags); err != nil {
-					log.Printf("Warning: Failed to update cache for %s: %v", item.FilePath, err)
-				}
-			}
+// QueueRatingWrite adds a rating and label update to the write queue, replacing
+// any update still pending for the file
+func QueueRatingWrite(filePath string, rating int, label string) {
+	ratingQueueMu.Lock()
+	defer ratingQueueMu.Unlock()
+	ratingQueue[filePath] = ratingWrite{Rating: rating, Label: label}
+}
+
+// PendingRating returns the queued (not yet persisted) rating and label for a file, if any
+func PendingRating(filePath string) (rating int, label string, ok bool) {
+	ratingQueueMu.Lock()
+	defer ratingQueueMu.Unlock()
+	w, ok := ratingQueue[filePath]
+	return w.Rating, w.Label, ok
+}
+
+// takeRatingWrites empties the rating queue and returns what it held
+func takeRatingWrites() map[string]ratingWrite {
+	ratingQueueMu.Lock()
+	defer ratingQueueMu.Unlock()
+	items := ratingQueue
+	ratingQueue = make(map[string]ratingWrite)
+	return items
+}
+
+// writeRatings mirrors queued ratings to disk, re-queueing failures unless a
+// newer value was queued meanwhile. Once ctx is done the remaining items are
+// re-queued unwritten. Returns how many were written and how many failed.
+func writeRatings(ctx context.Context, items map[string]ratingWrite) (written, failed int) {
+	requeue := func(path string, w ratingWrite) {
+		ratingQueueMu.Lock()
+		if _, newer := ratingQueue[path]; !newer {
+			ratingQueue[path] = w
+		}
+		ratingQueueMu.Unlock()
+	}
+	for path, w := range items {
+		if ctx.Err() != nil {
+			requeue(path, w)
+			continue
 		}
+		if err := scanner.SetFileRating(path, w.Rating, w.Label); err != nil {
+			log.Printf("Error writing rating to disk for %s: %v", path, err)
+			metrics.XattrWriteFailures.Inc("rating")
+			requeue(path, w)
+			failed++
+			continue
+		}
+		written++
 	}
+	return written, failed
+}
+
+// GetQueueSize returns the current size of the write queue
+func GetQueueSize() int {
+	state.LockWriteQueue()
+	n := len(state.GetWriteQueue())
+	state.UnlockWriteQueue()
+
+	ratingQueueMu.Lock()
+	defer ratingQueueMu.Unlock()
+	return n + len(ratingQueue)
+}
+
+// FlushResult reports what a flush of the write queue persisted
+type FlushResult struct {
+	Tags    int `json:"tags"`    // Files whose tags were written
+	Ratings int `json:"ratings"` // Files whose rating and label were written
+	Failed  int `json:"failed"`  // Writes that failed and were re-queued
+	Pending int `json:"pending"` // Writes still queued afterwards (failed, timed out or queued meanwhile)
+}
+
+// Written returns the number of writes that reached disk
+func (r FlushResult) Written() int {
+	return r.Tags + r.Ratings
 }
 
-// FlushWriteQueue immediately writes all pending items in the queue to disk
-func FlushWriteQueue() {
+// writeBatch persists everything queued: ratings first, then tags (which are
+// also saved to the database cache). Failed writes are re-queued for the next
+// batch; once ctx is done, unwritten items are re-queued without trying.
+func writeBatch(ctx context.Context) FlushResult {
+	var result FlushResult
+	result.Ratings, result.Failed = writeRatings(ctx, takeRatingWrites())
+
 	state.LockWriteQueue()
 	writeQueue := state.GetWriteQueue()
 	if len(writeQueue) == 0 {
 		state.UnlockWriteQueue()
-		return
+		result.Pending = GetQueueSize()
+		return result
 	}
 
+	// Copy queue and clear it atomically
 	items := make([]models.WriteQueueItem, len(writeQueue))
 	copy(items, writeQueue)
 	state.SetWriteQueue([]models.WriteQueueItem{})
 	state.UnlockWriteQueue()
 
+	// Write to disk outside the lock (can take time with APFS)
 	dbCache := state.GetCache()
 	for _, item := range items {
+		if ctx.Err() != nil {
+			requeueTags(item)
+			continue
+		}
 		// FilePath is now always absolute
 		if err := scanner.SetMacOSTags(item.FilePath, item.Tags); err != nil {
-			log.Printf("Error flushing tags to disk for %s: %v", item.FilePath, err)
-			QueueDiskWrite(item.FilePath, item.Tags)
-		} else if dbCache != nil {
+			log.Printf("Error writing tags to disk for %s: %v", item.FilePath, err)
+			metrics.XattrWriteFailures.Inc("tags")
+			// Re-queue on failure (will retry in next batch)
+			requeueTags(item)
+			result.Failed++
+			continue
+		}
+		result.Tags++
+		if dbCache != nil {
 			// Also update the database cache
 			if err := dbCache.UpdateFileTags(item.FilePath, item.Tags); err != nil {
 				log.Printf("Warning: Failed to update cache for %s: %v", item.FilePath, err)
 			}
 		}
 	}
+	result.Pending = GetQueueSize()
+	return result
+}
+
+// requeueTags puts an unwritten tag update back on the queue unless a newer
+// one was queued for the file meanwhile
+func requeueTags(item models.WriteQueueItem) {
+	if _, newer := PendingTags(item.FilePath); !newer {
+		QueueDiskWrite(item.FilePath, item.Tags)
+	}
+}
+
+// ProcessBatchWrites is the background goroutine that persists queued tag changes to disk.
+// Runs every 5 seconds, batching multiple tag operations into efficient bulk writes,
+// until ctx is done. A batch in progress is finished first.
+func ProcessBatchWrites(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			writeBatch(context.Background())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// FlushWriteQueue immediately writes all pending items in the queue to disk,
+// giving up on the rest when ctx is done (they stay queued)
+func FlushWriteQueue(ctx context.Context) FlushResult {
+	return writeBatch(ctx)
 }
 
-// StartBatchProcessor starts the background batch write processor
-func StartBatchProcessor() {
-	ProcessBatchWrites()
+// StartBatchProcessor starts the background batch write processor. The
+// returned channel is closed once it has stopped after ctx is done.
+func StartBatchProcessor(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ProcessBatchWrites(ctx)
+	}()
+	return done
 }
@@ -0,0 +1,56 @@
+package scanner
+
+import (
+	"log"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// CollectionPrefix starts the category of each collection, e.g. "📚 Portfolio"
+const CollectionPrefix = "📚 "
+
+// CollectionCategory returns the category name of a collection
+func CollectionCategory(name string) string {
+	return CollectionPrefix + name
+}
+
+// loadCollections returns the collections from the cache DB
+func loadCollections() []cache.Collection {
+	c, ok := state.GetCache().(*cache.Cache)
+	if !ok {
+		return nil
+	}
+	collections, err := c.Collections()
+	if err != nil {
+		log.Printf("⚠️  Failed to load collections: %v", err)
+		return nil
+	}
+	return collections
+}
+
+// addCollectionCategories adds a category per collection holding its files in
+// collection order, so the viewer's prev/next follows that order. Empty
+// collections still get a (empty) category so they can be opened and filled.
+func addCollectionCategories(filesByTag map[string][]models.FileInfo, files []models.FileInfo) {
+	collections := loadCollections()
+	if len(collections) == 0 {
+		return
+	}
+
+	byPath := make(map[string]models.FileInfo, len(files))
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+	for _, col := range collections {
+		category := CollectionCategory(col.Name)
+		items := make([]models.FileInfo, 0, len(col.Items))
+		for _, item := range col.Items {
+			if file, ok := byPath[item.Path]; ok {
+				items = append(items, file)
+			}
+		}
+		filesByTag[category] = items
+	}
+}
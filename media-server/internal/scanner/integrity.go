@@ -0,0 +1,211 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/metadata"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// BrokenCategory lists files that failed the integrity check
+const BrokenCategory = "⚠️ Broken Files"
+
+// integrityWorkers is kept low: a pass reads every file end to end and should
+// not starve thumbnail and page requests of disk bandwidth
+const integrityWorkers = 2
+
+// integritySaveBatch is how many results are written to the cache at a time,
+// so an interrupted pass keeps most of its work
+const integritySaveBatch = 200
+
+// IntegrityValidator checks library files for truncation and corruption in the
+// background (see metadata.Validate) and caches the results
+type IntegrityValidator struct {
+	cache     *cache.Cache
+	full      bool
+	ctx       context.Context // Passes stop early once done
+	progress  atomic.Int64
+	total     atomic.Int64
+	isRunning atomic.Bool
+}
+
+var globalIntegrityValidator *IntegrityValidator
+
+// GetIntegrityValidator returns the global integrity validator, or nil when disabled
+func GetIntegrityValidator() *IntegrityValidator {
+	return globalIntegrityValidator
+}
+
+// GetProgress returns how many files the current or last pass checked of its total
+func (v *IntegrityValidator) GetProgress() (checked, total int64) {
+	return v.progress.Load(), v.total.Load()
+}
+
+// IsRunning returns whether a pass is in progress
+func (v *IntegrityValidator) IsRunning() bool {
+	return v.isRunning.Load()
+}
+
+// FullDecode reports whether images are fully decoded rather than structurally checked
+func (v *IntegrityValidator) FullDecode() bool {
+	return v.full
+}
+
+// StartIntegrityValidator checks files not yet validated once the startup
+// freshness check is done, then re-checks changed and new files every
+// interval. Passes are skipped while a scan runs. It stops when ctx is done,
+// cutting a pass in progress short; the returned channel is closed once it has.
+func StartIntegrityValidator(ctx context.Context, c *cache.Cache, interval time.Duration, full bool) <-chan struct{} {
+	globalIntegrityValidator = &IntegrityValidator{cache: c, full: full, ctx: ctx}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for fs := GetFreshnessScanner(); fs != nil && fs.IsRunning(); {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+		globalIntegrityValidator.Run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				globalIntegrityValidator.Run()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// Run checks every online file without a current result and rebuilds the
+// index if any file's status changed. Returns false without doing anything
+// when a pass or a scan is already running.
+func (v *IntegrityValidator) Run() bool {
+	if state.IsScanning() || !v.isRunning.CompareAndSwap(false, true) {
+		return false
+	}
+	defer v.isRunning.Store(false)
+
+	checks, err := v.cache.FileChecks()
+	if err != nil {
+		log.Printf("⚠️  Failed to load integrity checks: %v", err)
+		return true
+	}
+
+	var pending []models.FileInfo
+	for _, f := range state.GetCurrent().AllFiles {
+		if f.Offline {
+			continue
+		}
+		if fc, ok := checks[f.Path]; ok && fc.Current(f.OSModTime, f.Size, v.full) {
+			continue
+		}
+		pending = append(pending, f)
+	}
+
+	v.progress.Store(0)
+	v.total.Store(int64(len(pending)))
+	if len(pending) == 0 {
+		return true
+	}
+	log.Printf("🩺 Checking integrity of %d files...", len(pending))
+
+	jobs := make(chan models.FileInfo)
+	var mu sync.Mutex
+	var batch []cache.FileCheck
+	changed, broken := 0, 0
+	save := func() {
+		if err := v.cache.SaveFileChecks(batch); err != nil {
+			log.Printf("⚠️  Failed to save integrity checks: %v", err)
+		}
+		batch = batch[:0]
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < integrityWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				reason := metadata.Validate(f.Path, v.full)
+				v.progress.Add(1)
+				if reason == metadata.TooLargeToDecode {
+					log.Printf("🩺 Skipped full decode of %s: %s", f.Path, reason)
+					reason = "" // Structurally intact; only the pixel check was skipped
+				}
+
+				mu.Lock()
+				batch = append(batch, cache.FileCheck{
+					Path: f.Path, MtimeNs: f.OSModTime.UnixNano(), Size: f.Size,
+					Reason: reason, Full: v.full,
+				})
+				if reason != f.BrokenReason {
+					changed++
+				}
+				if reason != "" {
+					broken++
+					log.Printf("⚠️  Broken file %s: %s", f.Path, reason)
+				}
+				if len(batch) >= integritySaveBatch {
+					save()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, f := range pending {
+		if state.IsScanning() || v.ctx.Err() != nil {
+			break // The scan rebuilds the index (or the server is stopping); the rest is checked next pass
+		}
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+	save()
+
+	log.Printf("✅ Integrity check complete: %d checked, %d broken", v.progress.Load(), broken)
+	if changed > 0 && !state.IsScanning() {
+		RebuildIndex()
+	}
+	return true
+}
+
+// Broken returns the number of files currently flagged as broken
+func (v *IntegrityValidator) Broken() int {
+	return len(state.GetCurrent().FilesByTag[BrokenCategory])
+}
+
+// loadFileChecks returns cached integrity check results, keyed by path
+func loadFileChecks() map[string]cache.FileCheck {
+	c, ok := state.GetCache().(*cache.Cache)
+	if !ok {
+		return nil
+	}
+	checks, err := c.FileChecks()
+	if err != nil {
+		log.Printf("⚠️  Failed to load integrity checks: %v", err)
+		return nil
+	}
+	return checks
+}
+
+// brokenReason returns the cached failure reason for a file, ignoring results
+// from before the file last changed
+func brokenReason(file models.FileInfo, checks map[string]cache.FileCheck) string {
+	fc, ok := checks[file.Path]
+	if !ok || !fc.Current(file.OSModTime, file.Size, false) {
+		return ""
+	}
+	return fc.Reason
+}
@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// hashChunkSize is how much of the head and tail of a file goes into quickHash
+const hashChunkSize = 64 * 1024
+
+// quickHash fingerprints a file from its size plus the first and last 64KB.
+// It is the fallback for recognising a moved file when inode numbers change
+// (cross-volume moves, copies followed by deletes, network volumes).
+func quickHash(path string, size int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	var sizeBuf [8]byte
+	binary.LittleEndian.PutUint64(sizeBuf[:], uint64(size))
+	h.Write(sizeBuf[:])
+
+	if _, err := io.CopyN(h, f, hashChunkSize); err != nil && err != io.EOF {
+		return ""
+	}
+	if size > 2*hashChunkSize {
+		if _, err := f.Seek(size-hashChunkSize, io.SeekStart); err != nil {
+			return ""
+		}
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// contentHash returns the quickHash of a file, reusing the cached hash when
+// the file's size and mtime are unchanged, so scans only read new and
+// modified files (a moved file has no row under its new path and is hashed)
+func contentHash(path string, size int64, modTime time.Time) string {
+	if c, ok := state.GetCache().(*cache.Cache); ok && c != nil {
+		if hash, ok := c.GetContentHash(path, size, modTime.UnixNano()); ok {
+			return hash
+		}
+	}
+	return quickHash(path, size)
+}
+
+// FindMoves pairs files that disappeared with files that appeared and returns
+// old path → new path for every pair recognised as the same file. Matching, in order:
+//  1. same device + inode with unchanged size and mtime
+//  2. same size + content hash, when exactly one candidate exists on each side
+//  3. rows from older caches without identity: same name, size and mtime, unique on both sides
+func FindMoves(removed, added []models.FileInfo) map[string]string {
+	moves := make(map[string]string)
+	if len(removed) == 0 || len(added) == 0 {
+		return moves
+	}
+
+	claimed := make(map[string]bool) // New paths already matched
+
+	// 1. Inode + device
+	type fileID struct{ device, inode uint64 }
+	byID := make(map[fileID]int)
+	for i, f := range added {
+		if f.Inode != 0 {
+			byID[fileID{f.Device, f.Inode}] = i
+		}
+	}
+	for _, old := range removed {
+		if old.Inode == 0 {
+			continue
+		}
+		i, ok := byID[fileID{old.Device, old.Inode}]
+		if !ok || !sameSizeAndMtime(old, added[i]) {
+			continue
+		}
+		moves[old.Path] = added[i].Path
+		claimed[added[i].Path] = true
+	}
+
+	// 2. Content hash
+	type hashKey struct {
+		size int64
+		hash string
+	}
+	oldByHash := make(map[hashKey][]int)
+	for i, old := range removed {
+		if _, done := moves[old.Path]; !done && old.ContentHash != "" {
+			k := hashKey{old.Size, old.ContentHash}
+			oldByHash[k] = append(oldByHash[k], i)
+		}
+	}
+	newByHash := make(map[hashKey][]int)
+	for i, f := range added {
+		if !claimed[f.Path] && f.ContentHash != "" {
+			k := hashKey{f.Size, f.ContentHash}
+			newByHash[k] = append(newByHash[k], i)
+		}
+	}
+	for k, olds := range oldByHash {
+		news := newByHash[k]
+		if len(olds) != 1 || len(news) != 1 {
+			continue // Duplicates are ambiguous; leave them as remove + create
+		}
+		moves[removed[olds[0]].Path] = added[news[0]].Path
+		claimed[added[news[0]].Path] = true
+	}
+
+	// 3. Name + size + mtime for rows without identity
+	type nameKey struct {
+		name  string
+		size  int64
+		mtime int64
+	}
+	oldByName := make(map[nameKey][]int)
+	for i, old := range removed {
+		if _, done := moves[old.Path]; !done && old.Inode == 0 && old.ContentHash == "" {
+			k := nameKey{old.Name, old.Size, old.OSModTime.Unix()}
+			oldByName[k] = append(oldByName[k], i)
+		}
+	}
+	if len(oldByName) > 0 {
+		newByName := make(map[nameKey][]int)
+		for i, f := range added {
+			if !claimed[f.Path] {
+				k := nameKey{f.Name, f.Size, f.OSModTime.Unix()}
+				newByName[k] = append(newByName[k], i)
+			}
+		}
+		for k, olds := range oldByName {
+			news := newByName[k]
+			if len(olds) != 1 || len(news) != 1 {
+				continue
+			}
+			moves[removed[olds[0]].Path] = added[news[0]].Path
+		}
+	}
+
+	return moves
+}
+
+// sameSizeAndMtime compares at second granularity, which is what the cache stores
+func sameSizeAndMtime(a, b models.FileInfo) bool {
+	return a.Size == b.Size && a.OSModTime.Unix() == b.OSModTime.Unix()
+}
+
+// relocateMoves re-keys cache rows for every detected move and logs it
+func relocateMoves(dbCache state.CacheInterface, moves map[string]string) {
+	if len(moves) == 0 {
+		return
+	}
+	for oldPath, newPath := range moves {
+		log.Printf("🚚 Moved: %s → %s", oldPath, newPath)
+		if dbCache == nil {
+			continue
+		}
+		if err := dbCache.RelocatePath(oldPath, newPath); err != nil {
+			log.Printf("⚠️  Failed to relocate cache rows for %s: %v", oldPath, err)
+		}
+	}
+	log.Printf("🚚 Tracked %d moved/renamed files", len(moves))
+}
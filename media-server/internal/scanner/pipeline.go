@@ -0,0 +1,499 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/config"
+	"github.com/tdsanchez/PostMac/internal/events"
+	"github.com/tdsanchez/PostMac/internal/library"
+	"github.com/tdsanchez/PostMac/internal/metrics"
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// Stage names reported through /api/scan-progress
+const (
+	StageStat    = "stat"
+	StageXattr   = "xattr"
+	StageComment = "comment"
+	StageEXIF    = "exif"
+)
+
+// ScanOptions controls worker-pool concurrency and pacing for the scanning pipeline.
+// Concurrency is configured per volume: SSDs can take far more parallel I/O than
+// SSHFS mounts or spinning disks.
+type ScanOptions struct {
+	DefaultWorkers int            // Workers per stage for paths not matching any volume
+	VolumeWorkers  map[string]int // Path prefix -> workers per stage
+	TargetLatency  time.Duration  // Per-stat latency the background pacer aims to stay under
+	MaxPaceDelay   time.Duration  // Upper bound on the delay the pacer inserts between files
+}
+
+var (
+	scanOptions = ScanOptions{
+		DefaultWorkers: 4,
+		VolumeWorkers:  map[string]int{},
+		TargetLatency:  20 * time.Millisecond,
+		MaxPaceDelay:   200 * time.Millisecond,
+	}
+	scanOptionsMu sync.RWMutex
+)
+
+// SetScanOptions replaces the pipeline configuration. Zero values keep the defaults.
+func SetScanOptions(opts ScanOptions) {
+	scanOptionsMu.Lock()
+	defer scanOptionsMu.Unlock()
+
+	if opts.DefaultWorkers > 0 {
+		scanOptions.DefaultWorkers = opts.DefaultWorkers
+	}
+	if opts.VolumeWorkers != nil {
+		scanOptions.VolumeWorkers = opts.VolumeWorkers
+	}
+	if opts.TargetLatency > 0 {
+		scanOptions.TargetLatency = opts.TargetLatency
+	}
+	if opts.MaxPaceDelay > 0 {
+		scanOptions.MaxPaceDelay = opts.MaxPaceDelay
+	}
+
+	log.Printf("⚙️  Scan pipeline: %s", describeVolumeWorkers(scanOptions))
+}
+
+func getScanOptions() ScanOptions {
+	scanOptionsMu.RLock()
+	defer scanOptionsMu.RUnlock()
+	return scanOptions
+}
+
+// ParseVolumeWorkers parses a "prefix=N,prefix=N" spec into a volume worker map.
+// Example: "/Volumes/SSD=16,/mnt/sshfs=2"
+func ParseVolumeWorkers(spec string) (map[string]int, error) {
+	result := make(map[string]int)
+	if strings.TrimSpace(spec) == "" {
+		return result, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		eq := strings.LastIndex(part, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid volume worker entry %q (want prefix=N)", part)
+		}
+		n, err := strconv.Atoi(part[eq+1:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid worker count in %q", part)
+		}
+		result[filepath.Clean(part[:eq])] = n
+	}
+	return result, nil
+}
+
+// volumeFor returns the configured volume prefix covering path (longest match),
+// or "" for the default pool.
+func volumeFor(path string, volumes map[string]int) string {
+	best := ""
+	for prefix := range volumes {
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return best
+}
+
+// StageProgress is the done/total count for a single pipeline stage
+type StageProgress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+// ScanProgress tracks per-stage progress of one pipeline run
+type ScanProgress struct {
+	Kind      string // "rescan", "startup" or "freshness"
+	StartedAt time.Time
+
+	running atomic.Bool
+	done    [4]atomic.Int64
+	total   [4]atomic.Int64
+}
+
+var stageOrder = [4]string{StageStat, StageXattr, StageComment, StageEXIF}
+
+// IsRunning returns whether the pipeline run is still in progress
+func (p *ScanProgress) IsRunning() bool {
+	return p.running.Load()
+}
+
+// Stages returns a snapshot of progress keyed by stage name
+func (p *ScanProgress) Stages() map[string]StageProgress {
+	stages := make(map[string]StageProgress, len(stageOrder))
+	for i, name := range stageOrder {
+		stages[name] = StageProgress{Done: p.done[i].Load(), Total: p.total[i].Load()}
+	}
+	return stages
+}
+
+// Checked returns how many paths have passed the stat stage, and the total queued
+func (p *ScanProgress) Checked() (checked, total int64) {
+	return p.done[0].Load(), p.total[0].Load()
+}
+
+// Each kind of run keeps its own record, so a background freshness run does
+// not overwrite the progress of a rescan that overlaps it
+var (
+	progressMu   sync.Mutex
+	progressRuns = make(map[string]*ScanProgress)
+)
+
+// progressInterval is how often a running pipeline publishes a scan-progress event
+const progressInterval = time.Second
+
+// publishProgress publishes the run's progress every progressInterval until
+// the returned stop function marks it finished and publishes the final count
+func publishProgress(p *ScanProgress) (stop func()) {
+	publish := func() {
+		checked, total := p.Checked()
+		events.Publish(events.ScanProgress, map[string]interface{}{
+			"kind":      p.Kind,
+			"isRunning": p.IsRunning(),
+			"checked":   checked,
+			"total":     total,
+			"stages":    p.Stages(),
+		})
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				publish()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+		p.running.Store(false)
+		publish()
+	}
+}
+
+// GetScanProgress returns the progress of the most recently started pipeline
+// run of kind (nil if none)
+func GetScanProgress(kind string) *ScanProgress {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	return progressRuns[kind]
+}
+
+// pacer adapts the delay between files to observed filesystem latency.
+// Slow stats (busy disk, network mount) double the delay; fast stats halve it.
+type pacer struct {
+	target   time.Duration
+	maxDelay time.Duration
+	delay    atomic.Int64 // nanoseconds
+}
+
+func newPacer(target, maxDelay time.Duration) *pacer {
+	return &pacer{target: target, maxDelay: maxDelay}
+}
+
+// Wait sleeps for the current delay
+func (p *pacer) Wait() {
+	if d := time.Duration(p.delay.Load()); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Observe feeds one latency sample into the pacer
+func (p *pacer) Observe(latency time.Duration) {
+	d := time.Duration(p.delay.Load())
+	switch {
+	case latency > p.target:
+		d = d*2 + time.Millisecond
+		if d > p.maxDelay {
+			d = p.maxDelay
+		}
+	case latency < p.target/2:
+		d /= 2
+	}
+	p.delay.Store(int64(d))
+}
+
+// pipelineOptions configures a single pipeline run
+type pipelineOptions struct {
+	kind string
+	pace bool            // Adaptive pacing (background work should yield to the UI)
+	ctx  context.Context // Stops feeding paths once done (nil = run to completion)
+
+	// keep is called after stat; returning false drops the path from later stages
+	keep func(path string, info os.FileInfo) bool
+
+	// onStatError is called when a path cannot be stat'ed (default: log and skip)
+	onStatError func(path string, err error)
+}
+
+// scanItem carries one path through the pipeline stages
+type scanItem struct {
+	index int
+	info  os.FileInfo
+	file  models.FileInfo
+}
+
+// runPipeline scans paths through the stat → xattr → comment → exif stages using
+// per-volume worker pools. Results are returned in input order.
+func runPipeline(paths []string, opts pipelineOptions) []models.FileInfo {
+	scanOpts := getScanOptions()
+
+	progress := &ScanProgress{Kind: opts.kind, StartedAt: time.Now()}
+	progress.running.Store(true)
+	progress.total[0].Store(int64(len(paths)))
+	progressMu.Lock()
+	progressRuns[opts.kind] = progress
+	progressMu.Unlock()
+	stopProgress := publishProgress(progress)
+	defer stopProgress()
+	defer metrics.ScanDuration.ObserveSince(progress.StartedAt, opts.kind)
+
+	if opts.onStatError == nil {
+		opts.onStatError = func(path string, err error) {
+			log.Printf("⚠️  Skipping path (stat error): %s - %v", path, err)
+		}
+	}
+
+	// Group path indexes by volume so each volume gets its own pool
+	groups := make(map[string][]int)
+	for i, path := range paths {
+		vol := volumeFor(path, scanOpts.VolumeWorkers)
+		groups[vol] = append(groups[vol], i)
+	}
+
+	results := make([]*models.FileInfo, len(paths))
+	var wg sync.WaitGroup
+	for vol, indexes := range groups {
+		workers := scanOpts.DefaultWorkers
+		if n, ok := scanOpts.VolumeWorkers[vol]; ok {
+			workers = n
+		}
+
+		var p *pacer
+		if opts.pace {
+			p = newPacer(scanOpts.TargetLatency, scanOpts.MaxPaceDelay)
+		}
+
+		wg.Add(1)
+		go func(indexes []int, workers int, p *pacer) {
+			defer wg.Done()
+			runVolume(paths, indexes, workers, p, opts, progress, results)
+		}(indexes, workers, p)
+	}
+	wg.Wait()
+
+	files := make([]models.FileInfo, 0, len(paths))
+	for _, f := range results {
+		if f != nil {
+			files = append(files, *f)
+		}
+	}
+	return files
+}
+
+// runVolume runs the four stages for the paths belonging to one volume
+func runVolume(paths []string, indexes []int, workers int, p *pacer, opts pipelineOptions, progress *ScanProgress, results []*models.FileInfo) {
+	in := make(chan *scanItem, workers*2)
+	var stop <-chan struct{}
+	if opts.ctx != nil {
+		stop = opts.ctx.Done()
+	}
+	go func() {
+		defer close(in)
+		for _, idx := range indexes {
+			select {
+			case in <- &scanItem{index: idx}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	// Stage 1: stat + extension filter
+	statOut := runStage(workers, in, func(it *scanItem) bool {
+		defer progress.done[0].Add(1)
+		path := paths[it.index]
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if !config.SupportedExts[ext] {
+			return false
+		}
+
+		if p != nil {
+			p.Wait()
+		}
+		start := time.Now()
+		info, err := os.Stat(path)
+		if p != nil {
+			p.Observe(time.Since(start))
+		}
+		if err != nil {
+			opts.onStatError(path, err)
+			return false
+		}
+		if info.IsDir() {
+			return false
+		}
+		if opts.keep != nil && !opts.keep(path, info) {
+			return false
+		}
+
+		it.info = info
+		it.file = models.FileInfo{
+			Name:    info.Name(),
+			Path:    path, // Absolute path is the primary identifier
+			Created: getBirthTime(info),
+			Size:    info.Size(),
+		}
+		it.file.Device, it.file.Inode = library.FileID(info)
+		it.file.Volume = library.VolumeRoot(path)
+		for i := 1; i < len(stageOrder); i++ {
+			progress.total[i].Add(1)
+		}
+		return true
+	})
+
+	// Stage 2: Finder tags, star rating and color label (xattr or XMP sidecar)
+	xattrOut := runStage(workers, statOut, func(it *scanItem) bool {
+		it.file.Tags = GetMacOSTags(it.file.Path)
+		it.file.Rating, it.file.ColorLabel = GetFileRating(it.file.Path)
+		progress.done[1].Add(1)
+		return true
+	})
+
+	// Stage 3: Finder comment
+	commentOut := runStage(workers, xattrOut, func(it *scanItem) bool {
+		it.file.Comment = GetMacOSComment(it.file.Path)
+		progress.done[2].Add(1)
+		return true
+	})
+
+	// Stage 4: EXIF date analysis, location + content hash
+	exifOut := runStage(workers, commentOut, func(it *scanItem) bool {
+		f := &it.file
+		extracted := extractMedia(f.Path)
+		f.OSModTime, f.OSBirthTime, f.EXIFCreateDate, f.EXIFModifyDate, f.EarliestDate,
+			f.NeedsDateCorrection, f.LargeDiscrepancy, f.MaxDiffHours, f.TimezoneMismatch = analyzeDateMetadata(f.Path, it.info, extracted)
+		if extracted != nil {
+			f.Location = extracted.Location
+		}
+		f.ContentHash = contentHash(f.Path, f.Size, it.info.ModTime())
+		progress.done[3].Add(1)
+		return true
+	})
+
+	for it := range exifOut {
+		f := it.file
+		results[it.index] = &f
+	}
+}
+
+// ScanFile runs all pipeline stages for a single path. Used for watcher events,
+// where one changed file should not trigger a library-wide scan.
+func ScanFile(path string) (models.FileInfo, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if !config.SupportedExts[ext] {
+		return models.FileInfo{}, fmt.Errorf("unsupported file type: %s", path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.FileInfo{}, err
+	}
+	if info.IsDir() {
+		return models.FileInfo{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	f := models.FileInfo{
+		Name:    info.Name(),
+		Path:    path,
+		Tags:    GetMacOSTags(path),
+		Comment: GetMacOSComment(path),
+		Created: getBirthTime(info),
+		Size:    info.Size(),
+	}
+	f.Rating, f.ColorLabel = GetFileRating(path)
+	extracted := extractMedia(path)
+	f.OSModTime, f.OSBirthTime, f.EXIFCreateDate, f.EXIFModifyDate, f.EarliestDate,
+		f.NeedsDateCorrection, f.LargeDiscrepancy, f.MaxDiffHours, f.TimezoneMismatch = analyzeDateMetadata(path, info, extracted)
+	if extracted != nil {
+		f.Location = extracted.Location
+	}
+	f.Device, f.Inode = library.FileID(info)
+	f.Volume = library.VolumeRoot(path)
+	f.ContentHash = contentHash(path, f.Size, info.ModTime())
+	return f, nil
+}
+
+// runStage starts a pool of workers applying fn to every item from in.
+// Items for which fn returns true are forwarded to the returned channel,
+// which is closed once all workers have drained in.
+func runStage(workers int, in <-chan *scanItem, fn func(*scanItem) bool) <-chan *scanItem {
+	if workers < 1 {
+		workers = 1
+	}
+	out := make(chan *scanItem, workers*2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range in {
+				if fn(it) {
+					out <- it
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// describeVolumeWorkers formats the volume worker map for startup logging
+func describeVolumeWorkers(opts ScanOptions) string {
+	if len(opts.VolumeWorkers) == 0 {
+		return fmt.Sprintf("%d workers/stage", opts.DefaultWorkers)
+	}
+	prefixes := make([]string, 0, len(opts.VolumeWorkers))
+	for prefix := range opts.VolumeWorkers {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	parts := []string{fmt.Sprintf("default=%d", opts.DefaultWorkers)}
+	for _, prefix := range prefixes {
+		parts = append(parts, fmt.Sprintf("%s=%d", prefix, opts.VolumeWorkers[prefix]))
+	}
+	return strings.Join(parts, ", ") + " workers/stage"
+}
@@ -0,0 +1,159 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tdsanchez/PostMac/internal/config"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// MaxRating is the highest star rating
+const MaxRating = 5
+
+// RatingPrefix and LabelPrefix start the synthetic per-rating and per-label
+// categories, e.g. "⭐ 4 Stars", "⭐ Unrated" and "🎨 Red"
+const (
+	RatingPrefix = "⭐ "
+	LabelPrefix  = "🎨 "
+)
+
+// ColorLabels are the Finder label colors in Finder's label index order (1–7)
+var ColorLabels = []string{"gray", "green", "purple", "blue", "yellow", "red", "orange"}
+
+// ParseColorLabel returns the canonical name of a color label ("" for none),
+// accepting any case and "grey"
+func ParseColorLabel(s string) (string, error) {
+	label := strings.ToLower(strings.TrimSpace(s))
+	switch label {
+	case "", "none":
+		return "", nil
+	case "grey":
+		return "gray", nil
+	}
+	for _, l := range ColorLabels {
+		if l == label {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown color label %q (use one of %s)", s, strings.Join(ColorLabels, ", "))
+}
+
+// RatingCategory returns the synthetic category name for a star rating
+func RatingCategory(rating int) string {
+	switch rating {
+	case 0:
+		return RatingPrefix + "Unrated"
+	case 1:
+		return RatingPrefix + "1 Star"
+	}
+	return fmt.Sprintf("%s%d Stars", RatingPrefix, rating)
+}
+
+// LabelCategory returns the synthetic category name for a color label
+func LabelCategory(label string) string {
+	return LabelPrefix + strings.ToUpper(label[:1]) + label[1:]
+}
+
+// addRatingCategories files media under its star rating and any file with a
+// color label under that label
+func addRatingCategories(filesByTag map[string][]models.FileInfo, file models.FileInfo, typeCategory string) {
+	if typeCategory == "📷 Images" || typeCategory == "🎬 Videos" || file.Rating > 0 {
+		category := RatingCategory(file.Rating)
+		filesByTag[category] = append(filesByTag[category], file)
+	}
+	if file.ColorLabel != "" {
+		category := LabelCategory(file.ColorLabel)
+		filesByTag[category] = append(filesByTag[category], file)
+	}
+}
+
+// clampRating limits a stored rating to 0–MaxRating. XMP uses -1 for rejected,
+// which is treated as unrated.
+func clampRating(rating int) int {
+	if rating < 0 {
+		return 0
+	}
+	if rating > MaxRating {
+		return MaxRating
+	}
+	return rating
+}
+
+// UpdateFileRatingsInMemory applies a rating and/or label change to files in
+// the in-memory index in place, moving them between the ⭐ and 🎨 categories.
+// Returns the files that were found.
+func UpdateFileRatingsInMemory(paths []string, rating *int, label *string) []models.FileInfo {
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+
+	state.LockRebuild()
+	defer state.UnlockRebuild()
+	state.LockData()
+	defer state.UnlockData()
+
+	allFiles := state.GetAllFiles()
+	filesByTag := state.GetFilesByTag()
+
+	var updated []models.FileInfo
+	byPath := make(map[string]models.FileInfo)
+	for i := range allFiles {
+		if !wanted[allFiles[i].Path] {
+			continue
+		}
+		old := allFiles[i]
+		if rating != nil {
+			allFiles[i].Rating = *rating
+		}
+		if label != nil {
+			allFiles[i].ColorLabel = *label
+		}
+		state.NoteEdit(old.Path)
+		updated = append(updated, allFiles[i])
+		byPath[old.Path] = allFiles[i]
+
+		// Move the file from its old rating and label categories to the new ones
+		for _, category := range []string{RatingCategory(old.Rating), labelCategoryOf(old.ColorLabel)} {
+			if category == "" {
+				continue
+			}
+			files := filesByTag[category]
+			for j := range files {
+				if files[j].Path == old.Path {
+					files = append(files[:j], files[j+1:]...)
+					break
+				}
+			}
+			if len(files) == 0 {
+				delete(filesByTag, category)
+			} else {
+				filesByTag[category] = files
+			}
+		}
+		addRatingCategories(filesByTag, allFiles[i], config.GetFileTypeCategory(old.Name))
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+
+	// Update the file's copies in ALL other categories
+	for _, files := range filesByTag {
+		for j := range files {
+			if f, ok := byPath[files[j].Path]; ok {
+				files[j].Rating, files[j].ColorLabel = f.Rating, f.ColorLabel
+			}
+		}
+	}
+	return updated
+}
+
+// labelCategoryOf is LabelCategory, or "" for no label
+func labelCategoryOf(label string) string {
+	if label == "" {
+		return ""
+	}
+	return LabelCategory(label)
+}
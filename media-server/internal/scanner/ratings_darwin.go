@@ -0,0 +1,70 @@
+//go:build darwin
+
+package scanner
+
+import (
+	"errors"
+
+	"github.com/pkg/xattr"
+	"howett.net/plist"
+)
+
+const (
+	starRatingXattr = "com.apple.metadata:kMDItemStarRating"
+	finderInfoXattr = "com.apple.FinderInfo"
+)
+
+// GetFileRating reads the Spotlight star rating and the Finder label color
+func GetFileRating(path string) (rating int, label string) {
+	if data, err := xattr.Get(path, starRatingXattr); err == nil {
+		var v int
+		if _, err := plist.Unmarshal(data, &v); err == nil {
+			rating = clampRating(v)
+		}
+	}
+	// The label index lives in bits 1–3 of the Finder flags (byte 9)
+	if info, err := xattr.Get(path, finderInfoXattr); err == nil && len(info) == 32 {
+		if idx := int(info[9]>>1) & 7; idx > 0 {
+			label = ColorLabels[idx-1]
+		}
+	}
+	return rating, label
+}
+
+// SetFileRating writes the star rating as kMDItemStarRating (removed when 0)
+// and the color label into the Finder info, keeping its other flags
+func SetFileRating(path string, rating int, label string) error {
+	if rating > 0 {
+		data, err := plist.Marshal(rating, plist.BinaryFormat)
+		if err != nil {
+			return err
+		}
+		if err := xattr.Set(path, starRatingXattr, data); err != nil {
+			return err
+		}
+	} else if err := xattr.Remove(path, starRatingXattr); err != nil && !isNoAttr(err) {
+		return err
+	}
+
+	idx := 0
+	for i, l := range ColorLabels {
+		if l == label {
+			idx = i + 1
+		}
+	}
+	info, err := xattr.Get(path, finderInfoXattr)
+	if err != nil || len(info) != 32 {
+		if idx == 0 {
+			return nil
+		}
+		info = make([]byte, 32)
+	}
+	info[9] = info[9]&^0x0E | byte(idx)<<1
+	return xattr.Set(path, finderInfoXattr, info)
+}
+
+// isNoAttr reports whether err means the attribute was not set
+func isNoAttr(err error) bool {
+	var xerr *xattr.Error
+	return errors.As(err, &xerr) && xerr.Err == xattr.ENOATTR
+}
@@ -0,0 +1,131 @@
+//go:build !darwin
+
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Without Spotlight, ratings and labels are mirrored to an XMP sidecar next to
+// the file (photo.jpg → photo.jpg.xmp), the layout darktable and digiKam read.
+// Existing sidecars are edited in place so other tools' metadata survives.
+
+const xmpNamespace = "http://ns.adobe.com/xap/1.0/"
+
+var (
+	xmpRatingAttr = regexp.MustCompile(`xmp:Rating\s*=\s*["'](-?\d+)["']`)
+	xmpRatingElem = regexp.MustCompile(`<xmp:Rating>\s*(-?\d+)\s*</xmp:Rating>`)
+	xmpLabelAttr  = regexp.MustCompile(`xmp:Label\s*=\s*["']([^"']*)["']`)
+	xmpLabelElem  = regexp.MustCompile(`<xmp:Label>([^<]*)</xmp:Label>`)
+	rdfDesc       = regexp.MustCompile(`<rdf:Description\b`)
+)
+
+const xmpSidecarTemplate = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="` + xmpNamespace + `"
+    xmp:Rating="%d"
+    xmp:Label="%s"/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`
+
+// xmpSidecarPath returns the sidecar path for a file
+func xmpSidecarPath(path string) string {
+	return path + ".xmp"
+}
+
+// GetFileRating reads xmp:Rating and xmp:Label from the file's XMP sidecar
+func GetFileRating(path string) (rating int, label string) {
+	data, err := os.ReadFile(xmpSidecarPath(path))
+	if err != nil {
+		return 0, ""
+	}
+	if m := xmpMatch(data, xmpRatingAttr, xmpRatingElem); m != "" {
+		v, _ := strconv.Atoi(m)
+		rating = clampRating(v)
+	}
+	label, _ = ParseColorLabel(xmpMatch(data, xmpLabelAttr, xmpLabelElem))
+	return rating, label
+}
+
+// SetFileRating writes xmp:Rating and xmp:Label to the file's XMP sidecar,
+// creating it unless there is nothing to record
+func SetFileRating(path string, rating int, label string) error {
+	sidecar := xmpSidecarPath(path)
+	xmpLabel := ""
+	if label != "" {
+		xmpLabel = strings.ToUpper(label[:1]) + label[1:]
+	}
+
+	data, err := os.ReadFile(sidecar)
+	if os.IsNotExist(err) {
+		if rating == 0 && label == "" {
+			return nil
+		}
+		return os.WriteFile(sidecar, []byte(fmt.Sprintf(xmpSidecarTemplate, rating, xmpLabel)), 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	s := string(data)
+	s, err = setXMPProperty(s, "Rating", strconv.Itoa(rating), xmpRatingAttr, xmpRatingElem)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sidecar, err)
+	}
+	s, err = setXMPProperty(s, "Label", xmpLabel, xmpLabelAttr, xmpLabelElem)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sidecar, err)
+	}
+	if s == string(data) {
+		return nil
+	}
+
+	// Write a sibling and rename so a crash never leaves a half-written sidecar
+	tmp := sidecar + ".tmp"
+	if err := os.WriteFile(tmp, []byte(s), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, sidecar)
+}
+
+// xmpMatch returns the first capture of the attribute or element form of a property
+func xmpMatch(data []byte, attr, elem *regexp.Regexp) string {
+	for _, re := range []*regexp.Regexp{attr, elem} {
+		if m := re.FindSubmatch(data); m != nil {
+			return string(m[1])
+		}
+	}
+	return ""
+}
+
+// setXMPProperty replaces an xmp: property written as an attribute or element,
+// or adds it as an attribute of the first rdf:Description. Unset values ("" or
+// a 0 rating) are not added.
+func setXMPProperty(s, name, value string, attr, elem *regexp.Regexp) (string, error) {
+	if loc := attr.FindStringSubmatchIndex(s); loc != nil {
+		return s[:loc[2]] + value + s[loc[3]:], nil
+	}
+	if loc := elem.FindStringSubmatchIndex(s); loc != nil {
+		return s[:loc[2]] + value + s[loc[3]:], nil
+	}
+	if value == "" || value == "0" {
+		return s, nil
+	}
+
+	loc := rdfDesc.FindStringIndex(s)
+	if loc == nil {
+		return s, fmt.Errorf("no rdf:Description to add xmp:%s to", name)
+	}
+	insert := fmt.Sprintf(` xmp:%s="%s"`, name, value)
+	if !strings.Contains(s, `xmlns:xmp=`) {
+		insert = ` xmlns:xmp="` + xmpNamespace + `"` + insert
+	}
+	return s[:loc[1]] + insert + s[loc[1]:], nil
+}
@@ -0,0 +1,28 @@
+package scanner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// FileETag returns the revision of a file's user-editable fields (tags,
+// comment, rating and color label). Clients send it back with an edit so a
+// change made since they loaded the file, in another tab, by another
+// annotator or in Finder, is reported as a conflict instead of overwritten.
+// Being derived from the values, it needs no storage and survives restarts.
+func FileETag(f models.FileInfo) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s", strings.Join(f.Tags, "\x1f"), f.Comment, f.Rating, f.ColorLabel)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// ETagMatches reports whether an ETag a client sent matches the file. An empty
+// ETag (a client that does not track revisions) or "*" always matches; HTTP
+// quoting and the weak prefix are ignored.
+func ETagMatches(f models.FileInfo, sent string) bool {
+	sent = strings.Trim(strings.TrimPrefix(strings.TrimSpace(sent), "W/"), `"`)
+	return sent == "" || sent == "*" || sent == FileETag(f)
+}
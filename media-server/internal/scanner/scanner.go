@@ -1,17 +1,22 @@
 package scanner
 
 import (
+	"context"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
 	"github.com/tdsanchez/PostMac/internal/cache"
 	"github.com/tdsanchez/PostMac/internal/config"
+	"github.com/tdsanchez/PostMac/internal/events"
+	"github.com/tdsanchez/PostMac/internal/library"
+	"github.com/tdsanchez/PostMac/internal/metadata"
 	"github.com/tdsanchez/PostMac/internal/models"
 	"github.com/tdsanchez/PostMac/internal/state"
 )
@@ -22,6 +27,8 @@ type FreshnessScanner struct {
 	progress  atomic.Int64
 	total     atomic.Int64
 	isRunning atomic.Bool
+	cancel    context.CancelFunc
+	done      chan struct{}
 }
 
 var globalFreshnessScanner *FreshnessScanner
@@ -41,24 +48,150 @@ func (fs *FreshnessScanner) IsRunning() bool {
 	return fs.isRunning.Load()
 }
 
-// ProcessPaths processes stdin paths using double-buffered state (no blocking)
+// startFreshnessScanner starts the background freshness check of paths
+func startFreshnessScanner(c *cache.Cache, paths []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	globalFreshnessScanner = &FreshnessScanner{cache: c, cancel: cancel, done: make(chan struct{})}
+	go globalFreshnessScanner.runFreshnessCheck(ctx, paths)
+}
+
+// Stop cancels a freshness check in progress and waits for it to finish
+// saving what it found so far
+func (fs *FreshnessScanner) Stop() {
+	fs.cancel()
+	<-fs.done
+}
+
+// LibraryPaths returns the full library path list: stdin paths (plus files the
+// watcher discovered) merged with a fresh walk of every directory root, so
+// rescans pick up subfolders created since startup, plus known files on
+// offline volumes.
+func LibraryPaths() []string {
+	paths := library.MergePaths(state.GetStdinPaths(), library.WalkRoots(state.GetRoots()))
+
+	// Files on unmounted volumes can't be walked; list them so the rescan keeps them
+	volumes := make(library.VolumeStatus)
+	var offline []string
+	for _, f := range state.GetCurrent().AllFiles {
+		if !volumes.Online(f.Path) {
+			offline = append(offline, f.Path)
+		}
+	}
+	return library.MergePaths(paths, offline)
+}
+
+// ProcessPaths processes stdin paths using double-buffered state. Files are
+// read from disk with no locks held; only building and swapping in the new
+// state holds the rebuild lock.
 func ProcessPaths(paths []string) error {
 	// Get inactive state buffer
 	inactive := state.GetInactiveState()
 
-	// Build into inactive state (no locks held!)
-	if err := ProcessPathsInto(paths, inactive); err != nil {
+	editsBefore := state.EditSeq()
+	scanned := scanPaths(paths)
+
+	// Edits wait from here to the swap, so none can land in the old state
+	// after its values have been carried over
+	state.LockRebuild()
+	defer state.UnlockRebuild()
+	keepEdits(scanned, editsBefore)
+
+	if err := ProcessPathsInto(scanned, inactive); err != nil {
 		return err
 	}
 
+	// Files that vanished from one path and appeared at another are moves;
+	// carry their DB rows (date decisions) over before the cache is rewritten
+	previous := state.GetCurrent().AllFiles
+	if len(previous) > 0 {
+		newPaths := make(map[string]bool, len(inactive.AllFiles))
+		for _, f := range inactive.AllFiles {
+			newPaths[f.Path] = true
+		}
+		oldPaths := make(map[string]bool, len(previous))
+		var vanished, appeared []models.FileInfo
+		for _, f := range previous {
+			oldPaths[f.Path] = true
+			if !newPaths[f.Path] {
+				vanished = append(vanished, f)
+			}
+		}
+		for _, f := range inactive.AllFiles {
+			if !oldPaths[f.Path] {
+				appeared = append(appeared, f)
+			}
+		}
+		relocateMoves(state.GetCache(), FindMoves(vanished, appeared))
+	}
+
 	// Atomic swap when complete
 	state.SwapState(inactive)
 	return nil
 }
 
-// ProcessPathsInto processes stdin paths, populating the provided state
+// scanPaths reads every path from disk through the scan pipeline. Files on
+// unmounted volumes keep their last known metadata instead of being dropped
+// (and deleted from the cache by SaveToCache).
+func scanPaths(paths []string) []models.FileInfo {
+	if len(paths) == 0 {
+		return nil
+	}
+	log.Printf("📥 Processing %d paths...\n", len(paths))
+
+	// Stat, xattr, comment and EXIF stages run in parallel worker pools
+	var missingMu sync.Mutex
+	var missing []string
+	scanned := runPipeline(paths, pipelineOptions{
+		kind: "rescan",
+		onStatError: func(path string, err error) {
+			log.Printf("⚠️  Skipping path (stat error): %s - %v", path, err)
+			missingMu.Lock()
+			missing = append(missing, path)
+			missingMu.Unlock()
+		},
+	})
+	return append(scanned, keepOfflineFiles(missing)...)
+}
+
+// pendingWrites overlays tag and rating edits still waiting in the write
+// queue onto a file read from disk. Set by package persistence, which owns
+// the queue (and imports this package).
+var pendingWrites = func(f *models.FileInfo) {}
+
+// SetPendingWrites registers the write-queue overlay used by rescans
+func SetPendingWrites(fn func(f *models.FileInfo)) {
+	pendingWrites = fn
+}
+
+// keepEdits carries edits over into files just read from disk, so a rescan
+// doesn't revert them to older on-disk values: edits made in place after the
+// scan started (by editsBefore) are copied from the current state, which holds
+// them even if the queue has since written them, and otherwise edits still in
+// the write queue are applied. Call with LockRebuild held.
+func keepEdits(files []models.FileInfo, editsBefore uint64) {
+	edited := state.EditedSince(editsBefore)
+	current := make(map[string]models.FileInfo, len(edited))
+	if len(edited) > 0 {
+		for _, f := range state.GetCurrent().AllFiles {
+			if edited[f.Path] {
+				current[f.Path] = f
+			}
+		}
+	}
+
+	for i := range files {
+		f := &files[i]
+		if c, ok := current[f.Path]; ok {
+			f.Tags, f.Comment, f.Rating, f.ColorLabel = c.Tags, c.Comment, c.Rating, c.ColorLabel
+			continue
+		}
+		pendingWrites(f)
+	}
+}
+
+// ProcessPathsInto builds the provided state from files read by scanPaths.
 // This function does NOT acquire locks - it builds into the provided state buffer
-func ProcessPathsInto(paths []string, targetState *state.AppState) error {
+func ProcessPathsInto(scanned []models.FileInfo, targetState *state.AppState) error {
 	// Initialize target state
 	targetState.FilesByTag = make(map[string][]models.FileInfo)
 	targetState.AllFiles = make([]models.FileInfo, 0)
@@ -68,60 +201,23 @@ func ProcessPathsInto(paths []string, targetState *state.AppState) error {
 	// Track files by directory path for hierarchical categories
 	filesByDir := make(map[string][]models.FileInfo)
 
-	if len(paths) > 0 {
-		log.Printf("📥 Processing %d paths...\n", len(paths))
-		for _, path := range paths {
-			// Get file info
-			info, err := os.Stat(path)
-			if err != nil {
-				log.Printf("⚠️  Skipping path (stat error): %s - %v", path, err)
-				continue
-			}
-
-			// Skip directories
-			if info.IsDir() {
-				continue
-			}
-
-			// Check if file type is supported
-			ext := strings.ToLower(filepath.Ext(path))
-			if !config.SupportedExts[ext] {
-				continue
-			}
-
-			// Get tags and metadata
-			tags := GetMacOSTags(path)
-			comment := GetMacOSComment(path)
-
-			// Perform date analysis (Phase 1: JPEG enrichment)
-			osModTime, osBirthTime, exifCreate, exifModify, earliest, needsCorrection, largeDiscrepancy, maxDiffHours := analyzeDateMetadata(path, info)
-
-			fileInfo := models.FileInfo{
-				Name:                info.Name(),
-				Path:                path, // Absolute path is the primary identifier
-				Tags:                tags,
-				Comment:             comment,
-				Created:             getBirthTime(info),
-				Size:                info.Size(),
-				OSModTime:           osModTime,
-				OSBirthTime:         osBirthTime,
-				EXIFCreateDate:      exifCreate,
-				EXIFModifyDate:      exifModify,
-				EarliestDate:        earliest,
-				NeedsDateCorrection: needsCorrection,
-				LargeDiscrepancy:    largeDiscrepancy,
-				MaxDiffHours:        maxDiffHours,
-			}
+	if len(scanned) > 0 {
+		corrected := loadCorrectedDates()
+		checks := loadFileChecks()
+		for _, fileInfo := range scanned {
+			tags := fileInfo.Tags
+			fileInfo.TimelineDate = timelineDate(fileInfo, corrected)
+			fileInfo.BrokenReason = brokenReason(fileInfo, checks)
 
 			// Add to master list
 			targetState.AllFiles = append(targetState.AllFiles, fileInfo)
 
 			// Track by parent directory for hierarchical categories
-			dirPath := filepath.Dir(path)
+			dirPath := filepath.Dir(fileInfo.Path)
 			filesByDir[dirPath] = append(filesByDir[dirPath], fileInfo)
 
 			// Add to file type category
-			typeCategory := config.GetFileTypeCategory(info.Name())
+			typeCategory := config.GetFileTypeCategory(fileInfo.Name)
 			filesByTag[typeCategory] = append(filesByTag[typeCategory], fileInfo)
 
 			// Add to tag categories
@@ -144,6 +240,19 @@ func ProcessPathsInto(paths []string, targetState *state.AppState) error {
 					filesByTag["🔍 Needs Review (>24h)"] = append(filesByTag["🔍 Needs Review (>24h)"], fileInfo)
 				}
 			}
+			if fileInfo.TimezoneMismatch {
+				filesByTag[TimezoneCategory] = append(filesByTag[TimezoneCategory], fileInfo)
+			}
+
+			if fileInfo.Offline {
+				filesByTag[OfflineCategory] = append(filesByTag[OfflineCategory], fileInfo)
+			}
+			if fileInfo.BrokenReason != "" {
+				filesByTag[BrokenCategory] = append(filesByTag[BrokenCategory], fileInfo)
+			}
+
+			addLocationCategory(filesByTag, fileInfo, typeCategory)
+			addRatingCategories(filesByTag, fileInfo, typeCategory)
 		}
 		log.Printf("✅ Processed %d files\n", len(targetState.AllFiles))
 	}
@@ -155,6 +264,9 @@ func ProcessPathsInto(paths []string, targetState *state.AppState) error {
 	})
 	filesByTag["All"] = allFilesList
 
+	addTimelineCategories(filesByTag, allFilesList)
+	addCollectionCategories(filesByTag, allFilesList)
+
 	// Create tag count synthetic views
 	tagCountBuckets := map[string][]models.FileInfo{
 		"1 Tag":   {},
@@ -251,6 +363,8 @@ func ProcessPathsInto(paths []string, targetState *state.AppState) error {
 
 // UpdateFileTagsInMemory updates the in-memory data structures when tags change
 func UpdateFileTagsInMemory(absPath string, newTags []string) {
+	state.LockRebuild()
+	defer state.UnlockRebuild()
 	state.LockData()
 	defer state.UnlockData()
 
@@ -262,6 +376,7 @@ func UpdateFileTagsInMemory(absPath string, newTags []string) {
 		if allFiles[i].Path == absPath {
 			oldTags := allFiles[i].Tags
 			allFiles[i].Tags = newTags
+			state.NoteEdit(absPath)
 
 			// Remove file from old tag categories in inverted index
 			for _, oldTag := range oldTags {
@@ -292,7 +407,7 @@ func UpdateFileTagsInMemory(absPath string, newTags []string) {
 			// Rebuild allTags list (excluding system categories like "All", type icons, subdirs)
 			tagSet := make(map[string]bool)
 			for tag := range filesByTag {
-				if tag != "All" && tag != "Untagged" && !strings.HasPrefix(tag, "📷") && !strings.HasPrefix(tag, "🎬") && !strings.HasPrefix(tag, "📄") && !strings.HasPrefix(tag, "📝") && !strings.HasPrefix(tag, "🌐") && !strings.HasPrefix(tag, "📃") && !strings.HasPrefix(tag, "📦") && !strings.HasPrefix(tag, "📁") {
+				if tag != "All" && tag != "Untagged" && !strings.HasPrefix(tag, "📷") && !strings.HasPrefix(tag, "🎬") && !strings.HasPrefix(tag, "📄") && !strings.HasPrefix(tag, "📝") && !strings.HasPrefix(tag, "🌐") && !strings.HasPrefix(tag, "📃") && !strings.HasPrefix(tag, "📦") && !strings.HasPrefix(tag, "📁") && !strings.HasPrefix(tag, "📍") && !strings.HasPrefix(tag, TimelinePrefix) && !strings.HasPrefix(tag, RatingPrefix) && !strings.HasPrefix(tag, LabelPrefix) && !strings.HasPrefix(tag, CollectionPrefix) && tag != BrokenCategory {
 					tagSet[tag] = true
 				}
 			}
@@ -303,6 +418,11 @@ func UpdateFileTagsInMemory(absPath string, newTags []string) {
 			sort.Strings(allTags)
 			state.SetAllTags(allTags)
 
+			events.Publish(events.TagsChanged, map[string]interface{}{
+				"path": absPath,
+				"tags": newTags,
+				"etag": FileETag(allFiles[i]),
+			})
 			break
 		}
 	}
@@ -310,6 +430,8 @@ func UpdateFileTagsInMemory(absPath string, newTags []string) {
 
 // RemoveFileFromMemory removes a file from all in-memory data structures and cache
 func RemoveFileFromMemory(absPath string) {
+	state.LockRebuild()
+	defer state.UnlockRebuild()
 	state.LockData()
 	defer state.UnlockData()
 
@@ -343,86 +465,302 @@ func RemoveFileFromMemory(absPath string) {
 			log.Printf("⚠️ Warning: Failed to remove file from cache: %v", err)
 		}
 	}
+
+	events.Publish(events.FileDeleted, map[string]interface{}{"path": absPath})
 }
 
-// analyzeDateMetadata performs date analysis for JPEG files (Phase 1: read-only)
-// Compares OS timestamps (mtime, btime) with EXIF dates (CreateDate, ModifyDate)
-// and determines if correction is needed
-func analyzeDateMetadata(filePath string, info os.FileInfo) (osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate time.Time, needsCorrection, largeDiscrepancy bool, maxDiffHours int) {
-	// Fixed MST timezone (UTC-7, no DST) for Arizona
-	mstFixed := time.FixedZone("MST", -7*3600)
+// ApplyFileChanges applies single-file updates and removals without rescanning the
+// library: the in-memory index is rebuilt from the current file list (no disk I/O)
+// into the inactive buffer and swapped in, and the cache is updated per file.
+// Removing a directory path removes every file beneath it.
+func ApplyFileChanges(updated []models.FileInfo, removed []string) {
+	if len(updated) == 0 && len(removed) == 0 {
+		return
+	}
 
-	// Get OS timestamps and convert to fixed MST for consistent display
-	osModTime = info.ModTime().In(mstFixed)
-	osBirthTime = getBirthTime(info).In(mstFixed)
+	state.LockRebuild()
+	current := state.GetCurrent()
 
-	// Check if file is JPEG
-	ext := strings.ToLower(filepath.Ext(filePath))
-	isJPEG := ext == ".jpg" || ext == ".jpeg"
+	updatedByPath := make(map[string]models.FileInfo, len(updated))
+	for _, f := range updated {
+		updatedByPath[f.Path] = f
+		state.NoteEdit(f.Path) // Newer than what a running rescan may have read
+	}
+	removedSet := make(map[string]bool, len(removed))
+	for _, p := range removed {
+		removedSet[p] = true
+	}
+	isRemoved := func(path string) bool {
+		for dir := path; ; dir = filepath.Dir(dir) {
+			if removedSet[dir] {
+				return true
+			}
+			if dir == "/" || dir == "." {
+				return false
+			}
+		}
+	}
 
-	if !isJPEG {
-		// Not a JPEG - return OS timestamps only, no analysis
-		return osModTime, osBirthTime, time.Time{}, time.Time{}, time.Time{}, false, false, 0
+	files := make([]models.FileInfo, 0, len(current.AllFiles)+len(updated))
+	volumes := make(library.VolumeStatus)
+	var removedFiles []models.FileInfo
+	for _, f := range current.AllFiles {
+		if nf, ok := updatedByPath[f.Path]; ok {
+			files = append(files, nf)
+			delete(updatedByPath, f.Path)
+			continue
+		}
+		if isRemoved(f.Path) {
+			if !volumes.Online(f.Path) {
+				files = append(files, f) // Volume unmounted, not deleted; flagged offline on rebuild
+				continue
+			}
+			removedFiles = append(removedFiles, f)
+			continue
+		}
+		files = append(files, f)
 	}
 
-	// Parse EXIF data for JPEGs
-	f, err := os.Open(filePath)
-	if err != nil {
-		// Can't open file - return OS timestamps only
-		return osModTime, osBirthTime, time.Time{}, time.Time{}, time.Time{}, false, false, 0
+	// Files not yet in the library
+	var addedFiles []models.FileInfo
+	for _, f := range updated {
+		if _, isNew := updatedByPath[f.Path]; isNew {
+			files = append(files, f)
+			addedFiles = append(addedFiles, f)
+			state.AddStdinPath(f.Path)
+		}
+	}
+
+	// A rename arrives as remove + create; re-key the old rows before upserting
+	moves := FindMoves(removedFiles, addedFiles)
+	relocateMoves(state.GetCache(), moves)
+	var removedPaths, gonePaths []string
+	for _, f := range removedFiles {
+		gonePaths = append(gonePaths, f.Path) // Deleted or moved away; rescans must not look for it
+		if _, moved := moves[f.Path]; !moved {
+			removedPaths = append(removedPaths, f.Path)
+		}
 	}
-	defer f.Close()
+	state.RemoveStdinPaths(gonePaths)
 
-	x, err := exif.Decode(f)
+	inactive := state.GetInactiveState()
+	buildInMemoryStructuresInto(files, inactive)
+	state.SwapState(inactive)
+	state.UnlockRebuild()
+
+	if dbCache := state.GetCache(); dbCache != nil {
+		if c, ok := dbCache.(*cache.Cache); ok {
+			for _, f := range updated {
+				if err := c.UpsertFile(f); err != nil {
+					log.Printf("⚠️  Failed to cache file %s: %v", f.Path, err)
+				}
+			}
+		}
+		for _, p := range removedPaths {
+			if err := dbCache.DeleteFile(p); err != nil {
+				log.Printf("⚠️ Warning: Failed to remove file from cache: %v", err)
+			}
+		}
+	}
+
+	publishFileChanges(current.AllFiles, updated, removedFiles, addedFiles)
+	log.Printf("⚡ Applied %d file updates, %d removals, %d moves", len(updated), len(removedPaths), len(moves))
+}
+
+// publishFileChanges broadcasts the result of ApplyFileChanges: additions and
+// removals (a move is both), and tag or comment edits made outside the server
+func publishFileChanges(previous, updated, removed, added []models.FileInfo) {
+	before := make(map[string]models.FileInfo, len(updated))
+	for _, f := range updated {
+		before[f.Path] = models.FileInfo{}
+	}
+	for _, f := range previous {
+		if _, ok := before[f.Path]; ok {
+			before[f.Path] = f
+		}
+	}
+
+	for _, f := range removed {
+		events.Publish(events.FileDeleted, map[string]interface{}{"path": f.Path})
+	}
+	for _, f := range added {
+		tags := f.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		events.Publish(events.FileAdded, map[string]interface{}{
+			"path": f.Path,
+			"name": f.Name,
+			"tags": tags,
+		})
+	}
+	for _, f := range updated {
+		old := before[f.Path]
+		if old.Path == "" {
+			continue // Added
+		}
+		if !equalTags(old.Tags, f.Tags) {
+			events.Publish(events.TagsChanged, map[string]interface{}{
+				"path": f.Path,
+				"tags": f.Tags,
+				"etag": FileETag(f),
+			})
+		}
+		if old.Comment != f.Comment {
+			events.Publish(events.CommentChanged, map[string]interface{}{
+				"path":    f.Path,
+				"comment": f.Comment,
+				"etag":    FileETag(f),
+			})
+		}
+	}
+}
+
+// equalTags reports whether two tag lists hold the same tags in the same order
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Location synthetic categories
+const (
+	HasLocationCategory = "📍 Has Location"
+	NoLocationCategory  = "📍 No Location"
+)
+
+// addLocationCategory files media under 📍 Has Location or 📍 No Location.
+// Other file types never carry a location, so they are left out of both.
+func addLocationCategory(filesByTag map[string][]models.FileInfo, file models.FileInfo, typeCategory string) {
+	switch {
+	case file.Location != nil:
+		filesByTag[HasLocationCategory] = append(filesByTag[HasLocationCategory], file)
+	case typeCategory == "📷 Images" || typeCategory == "🎬 Videos":
+		filesByTag[NoLocationCategory] = append(filesByTag[NoLocationCategory], file)
+	}
+}
+
+// extractMedia reads embedded metadata once per scanned file, for both date
+// analysis and location. Returns nil for non-media files or unreadable ones.
+func extractMedia(filePath string) *metadata.Info {
+	category := config.GetFileTypeCategory(filePath)
+	if category != "📷 Images" && category != "🎬 Videos" {
+		return nil
+	}
+	extracted, err := metadata.Extract(filePath)
 	if err != nil {
-		// No EXIF data or parse error - return OS timestamps only
-		return osModTime, osBirthTime, time.Time{}, time.Time{}, time.Time{}, false, false, 0
+		return nil
+	}
+	return extracted
+}
+
+// analyzeDateMetadata performs date analysis for images and videos (Phase 1: read-only)
+// Compares OS timestamps (mtime, btime) with the embedded dates (EXIF CreateDate
+// and ModifyDate, or a video container's creation date) and determines if
+// correction is needed. Discrepancies fully explained by a camera clock set to
+// another zone are reported as tzMismatch instead of needsCorrection.
+func analyzeDateMetadata(filePath string, info os.FileInfo, extracted *metadata.Info) (osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate time.Time, needsCorrection, largeDiscrepancy bool, maxDiffHours int, tzMismatch bool) {
+	// Get OS timestamps and convert to fixed MST for consistent display
+	osModTime = info.ModTime().In(displayZone)
+	osBirthTime = getBirthTime(info).In(displayZone)
+
+	// Only media types carry embedded dates (see extractMedia)
+	if extracted == nil {
+		return osModTime, osBirthTime, time.Time{}, time.Time{}, time.Time{}, false, false, 0, false
 	}
 
-	// Helper to parse EXIF date bypassing DST completely
-	// EXIF dates are "naive" - they represent local time with no timezone/DST info
-	// Arizona: Use MST (-7) always, never PDT (-6)
-	parseEXIFDate := func(dateStr string) (time.Time, error) {
-		// Use MST fixed offset: -7 hours = -25200 seconds
-		// This avoids DST adjustments that Go incorrectly applies to Arizona historical dates
-		mstFixed := time.FixedZone("MST", -7*3600)
+	// Embedded dates whose zone had to be guessed, and dates that are absolute
+	// instants (OS timestamps, UTC container dates, EXIF dates with an offset)
+	var wallClock []time.Time
+	absolute := []time.Time{osModTime, osBirthTime}
 
-		// Parse in fixed MST - displays correctly without DST offset
-		parsed, err := time.ParseInLocation("2006:01:02 15:04:05", dateStr, mstFixed)
+	x := extracted.EXIF
+	if x == nil {
+		if extracted.Created.IsZero() {
+			// No EXIF data or container date - return OS timestamps only
+			return osModTime, osBirthTime, time.Time{}, time.Time{}, time.Time{}, false, false, 0, false
+		}
+		// Video containers record an absolute UTC time (MP4/MOV, MKV) or a
+		// camera wall-clock time (AVI), which is read like an EXIF date
+		created := extracted.Created
+		if extracted.CreatedUTC {
+			exifCreateDate = created.In(displayZone)
+			absolute = append(absolute, exifCreateDate)
+		} else {
+			exifCreateDate = time.Date(created.Year(), created.Month(), created.Day(),
+				created.Hour(), created.Minute(), created.Second(), 0, cameraZone(filePath, "")).In(displayZone)
+			wallClock = append(wallClock, exifCreateDate)
+		}
+	}
+
+	// Helper to parse an EXIF date in the zone it was taken in
+	// EXIF dates are "naive" local times: the matching OffsetTime* tag gives
+	// their zone when present, otherwise the camera timezone rules (default
+	// Arizona MST, -7 always, never PDT) guess it. The result is converted to
+	// MST so every date compares component-wise with the OS timestamps.
+	var zone *time.Location
+	parseEXIFDate := func(dateStr string, offsetTag exif.FieldName) (time.Time, error) {
+		loc := metadata.EXIFOffset(x, offsetTag)
+		guessed := loc == nil
+		if guessed {
+			loc = zone
+		}
+
+		parsed, err := time.ParseInLocation("2006:01:02 15:04:05", dateStr, loc)
 		if err != nil {
 			return time.Time{}, err
 		}
+		parsed = parsed.In(displayZone)
 
+		if guessed {
+			wallClock = append(wallClock, parsed)
+		} else {
+			absolute = append(absolute, parsed)
+		}
 		return parsed, nil
 	}
 
-	// Extract EXIF ModifyDate (DateTime tag - when file was last modified)
-	if dtTag, err := x.Get(exif.DateTime); err == nil {
-		if dtStr, err := dtTag.StringVal(); err == nil {
-			if parsed, err := parseEXIFDate(dtStr); err == nil {
-				exifModifyDate = parsed
-			}
+	if x != nil {
+		model := ""
+		if tag, err := x.Get(exif.Model); err == nil {
+			model, _ = tag.StringVal()
 		}
-	}
+		zone = cameraZone(filePath, model)
 
-	// Extract EXIF CreateDate (DateTimeOriginal - when photo was originally taken)
-	if dtOrig, err := x.Get(exif.DateTimeOriginal); err == nil {
-		if dtOrigStr, err := dtOrig.StringVal(); err == nil {
-			if parsed, err := parseEXIFDate(dtOrigStr); err == nil {
-				exifCreateDate = parsed
+		// Extract EXIF ModifyDate (DateTime tag - when file was last modified)
+		if dtTag, err := x.Get(exif.DateTime); err == nil {
+			if dtStr, err := dtTag.StringVal(); err == nil {
+				if parsed, err := parseEXIFDate(dtStr, metadata.OffsetTime); err == nil {
+					exifModifyDate = parsed
+				}
 			}
 		}
-	}
 
-	// If CreateDate not found, use DateTimeDigitized as fallback
-	if exifCreateDate.IsZero() {
-		if dtDig, err := x.Get(exif.DateTimeDigitized); err == nil {
-			if dtDigStr, err := dtDig.StringVal(); err == nil {
-				if parsed, err := parseEXIFDate(dtDigStr); err == nil {
+		// Extract EXIF CreateDate (DateTimeOriginal - when photo was originally taken)
+		if dtOrig, err := x.Get(exif.DateTimeOriginal); err == nil {
+			if dtOrigStr, err := dtOrig.StringVal(); err == nil {
+				if parsed, err := parseEXIFDate(dtOrigStr, metadata.OffsetTimeOriginal); err == nil {
 					exifCreateDate = parsed
 				}
 			}
 		}
+
+		// If CreateDate not found, use DateTimeDigitized as fallback
+		if exifCreateDate.IsZero() {
+			if dtDig, err := x.Get(exif.DateTimeDigitized); err == nil {
+				if dtDigStr, err := dtDig.StringVal(); err == nil {
+					if parsed, err := parseEXIFDate(dtDigStr, metadata.OffsetTimeDigitized); err == nil {
+						exifCreateDate = parsed
+					}
+				}
+			}
+		}
 	}
 
 	// Helper function to compare dates component-wise (ignore timezone)
@@ -521,7 +859,14 @@ func analyzeDateMetadata(filePath string, info os.FileInfo) (osModTime, osBirthT
 		}
 	}
 
-	return osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate, needsCorrection, largeDiscrepancy, maxDiffHours
+	// A camera clock set to another zone shows up as a whole-hour (or 15/30/45
+	// minute) offset between its wall-clock dates and everything else. That is
+	// a timezone mismatch, not a wrong date, so it stays out of the training queue.
+	if needsCorrection && timezoneShifted(wallClock, absolute) {
+		needsCorrection, largeDiscrepancy, tzMismatch = false, false, true
+	}
+
+	return osModTime, osBirthTime, exifCreateDate, exifModifyDate, earliestDate, needsCorrection, largeDiscrepancy, maxDiffHours, tzMismatch
 }
 
 
@@ -536,6 +881,10 @@ func LoadOrScan(stdinPaths []string, port string) (*cache.Cache, error) {
 		return nil, err
 	}
 
+	// Registered early so startup processing can fall back to cached rows
+	// for files on offline volumes
+	state.SetCache(c)
+
 	// Check if we have cached data
 	lastScan, totalFiles, _, err := c.GetScanMetadata()
 	if err != nil {
@@ -562,60 +911,51 @@ func LoadOrScan(stdinPaths []string, port string) (*cache.Cache, error) {
 			existingMap[f.Path] = true
 		}
 
-		// Process stdin paths - check which ones need parsing
-		var newFiles []models.FileInfo
-		for _, path := range stdinPaths {
-			// Check if already in cache with fresh data
-			if cachedMtime, ok := c.GetFileMtime(path); ok {
-				info, err := os.Stat(path)
-				if err == nil && info.ModTime().UnixNano() == cachedMtime {
-					// File is fresh in cache, skip re-parsing
-					continue
-				}
-			}
-
-			// Need to parse this file
-			info, err := os.Stat(path)
-			if err != nil {
-				log.Printf("⚠️  Skipping path (stat error): %s - %v", path, err)
-				continue
+		// Cached files on unmounted volumes are neither walked nor listed;
+		// carry them through so the rebuilt cache keeps them
+		inputSet := make(map[string]bool, len(stdinPaths))
+		for _, p := range stdinPaths {
+			inputSet[p] = true
+		}
+		volumes := make(library.VolumeStatus)
+		for _, f := range existingFiles {
+			if !inputSet[f.Path] && !volumes.Online(f.Path) {
+				stdinPaths = append(stdinPaths, f.Path)
 			}
+		}
 
-			if info.IsDir() {
-				continue
-			}
+		// Process stdin paths - only files missing from cache or with a changed
+		// mtime continue past the stat stage
+		newFiles := runPipeline(stdinPaths, pipelineOptions{
+			kind: "startup",
+			keep: func(path string, info os.FileInfo) bool {
+				if !existingMap[path] {
+					return true
+				}
+				cachedMtime, ok := c.GetFileMtime(path)
+				return !ok || info.ModTime().UnixNano() != cachedMtime
+			},
+		})
 
-			ext := strings.ToLower(filepath.Ext(path))
-			if !config.SupportedExts[ext] {
-				continue
+		// Cached files gone from disk that reappear under a new path were moved
+		// while the server was down; re-key their rows before upserting
+		var vanished, appeared []models.FileInfo
+		for _, f := range existingFiles {
+			if _, err := os.Lstat(f.Path); os.IsNotExist(err) && volumes.Online(f.Path) {
+				vanished = append(vanished, f)
 			}
-
-			tags := GetMacOSTags(path)
-			comment := GetMacOSComment(path)
-			osModTime, osBirthTime, exifCreate, exifModify, earliest, needsCorrection, largeDiscrepancy, maxDiffHours := analyzeDateMetadata(path, info)
-
-			fileInfo := models.FileInfo{
-				Name:                info.Name(),
-				Path:                path,
-				Tags:                tags,
-				Comment:             comment,
-				Created:             getBirthTime(info),
-				Size:                info.Size(),
-				OSModTime:           osModTime,
-				OSBirthTime:         osBirthTime,
-				EXIFCreateDate:      exifCreate,
-				EXIFModifyDate:      exifModify,
-				EarliestDate:        earliest,
-				NeedsDateCorrection: needsCorrection,
-				LargeDiscrepancy:    largeDiscrepancy,
-				MaxDiffHours:        maxDiffHours,
+		}
+		for _, f := range newFiles {
+			if !existingMap[f.Path] {
+				appeared = append(appeared, f)
 			}
+		}
+		relocateMoves(c, FindMoves(vanished, appeared))
 
-			newFiles = append(newFiles, fileInfo)
-
-			// Upsert to cache
+		// Upsert to cache
+		for _, fileInfo := range newFiles {
 			if err := c.UpsertFile(fileInfo); err != nil {
-				log.Printf("⚠️  Failed to cache file %s: %v", path, err)
+				log.Printf("⚠️  Failed to cache file %s: %v", fileInfo.Path, err)
 			}
 		}
 
@@ -630,8 +970,7 @@ func LoadOrScan(stdinPaths []string, port string) (*cache.Cache, error) {
 		SaveToCache(c)
 
 		// Start background freshness scanner
-		globalFreshnessScanner = &FreshnessScanner{cache: c}
-		go globalFreshnessScanner.runFreshnessCheck(stdinPaths)
+		startFreshnessScanner(c, stdinPaths)
 
 		return c, nil
 	}
@@ -659,13 +998,15 @@ func LoadOrScan(stdinPaths []string, port string) (*cache.Cache, error) {
 
 		log.Printf("✅ Loaded %d files from cache", len(files))
 
+		// Index anything missing from the text index (e.g. first FTS5 build)
+		go syncTextIndex(c, files)
+
 		// Start background freshness scanner
-		globalFreshnessScanner = &FreshnessScanner{cache: c}
 		paths := make([]string, len(files))
 		for i, f := range files {
 			paths[i] = f.Path
 		}
-		go globalFreshnessScanner.runFreshnessCheck(paths)
+		startFreshnessScanner(c, paths)
 
 		return c, nil
 	}
@@ -674,65 +1015,98 @@ func LoadOrScan(stdinPaths []string, port string) (*cache.Cache, error) {
 	return c, nil
 }
 
-// runFreshnessCheck validates cached files against filesystem
-func (fs *FreshnessScanner) runFreshnessCheck(paths []string) {
+// runFreshnessCheck validates cached files against filesystem until done or
+// ctx is cancelled
+func (fs *FreshnessScanner) runFreshnessCheck(ctx context.Context, paths []string) {
 	fs.isRunning.Store(true)
+	defer close(fs.done)
 	defer fs.isRunning.Store(false)
 
 	fs.total.Store(int64(len(paths)))
+	events.Publish(events.ScanStarted, map[string]interface{}{"kind": "freshness", "total": len(paths)})
 	log.Printf("🔄 Starting background freshness check for %d files...", len(paths))
 
-	var staleCount int
-	var missingCount int
-
-	for i, path := range paths {
-		fs.progress.Store(int64(i + 1))
+	var missingCount, offlineCount atomic.Int64
+	var volumesMu sync.Mutex
+	volumes := make(library.VolumeStatus)
+
+	// Adaptive pacing replaces the fixed per-file sleep: workers slow down when
+	// stat latency climbs and speed back up when the disk is idle.
+	stale := runPipeline(paths, pipelineOptions{
+		kind: "freshness",
+		pace: true,
+		ctx:  ctx,
+		keep: func(path string, info os.FileInfo) bool {
+			fs.progress.Add(1)
+
+			// Check if mtime matches cached value
+			cachedMtime, hasIdentity, ok := fs.cache.GetFileIdentity(path)
+			if !ok {
+				return false
+			}
+			// Only changed files are re-parsed, plus rows cached before
+			// inode/hash tracking so they can be recognised after a move
+			return info.ModTime().UnixNano() != cachedMtime || !hasIdentity
+		},
+		onStatError: func(path string, err error) {
+			fs.progress.Add(1)
+
+			// Files on an unmounted volume are offline, not missing
+			volumesMu.Lock()
+			online := volumes.Online(path)
+			volumesMu.Unlock()
+			if !online {
+				offlineCount.Add(1)
+				return
+			}
 
-		info, err := os.Stat(path)
-		if err != nil {
 			// File missing - will be hidden from UI
-			missingCount++
-			continue
-		}
+			missingCount.Add(1)
+		},
+	})
 
-		// Check if mtime matches cached value
-		cachedMtime, ok := fs.cache.GetFileMtime(path)
-		if !ok {
-			continue
+	for _, fileInfo := range stale {
+		if err := fs.cache.UpsertFile(fileInfo); err != nil {
+			log.Printf("⚠️  Failed to cache file %s: %v", fileInfo.Path, err)
 		}
+	}
 
-		if info.ModTime().UnixNano() != cachedMtime {
-			// File changed - re-parse and update
-			staleCount++
-			tags := GetMacOSTags(path)
-			comment := GetMacOSComment(path)
-			osModTime, osBirthTime, exifCreate, exifModify, earliest, needsCorrection, largeDiscrepancy, maxDiffHours := analyzeDateMetadata(path, info)
+	if ctx.Err() != nil {
+		events.Publish(events.ScanCompleted, map[string]interface{}{
+			"kind":      "freshness",
+			"success":   false,
+			"cancelled": true,
+			"stale":     len(stale),
+		})
+		log.Printf("⏹  Freshness check stopped after %d of %d files (%d stale saved)", fs.progress.Load(), fs.total.Load(), len(stale))
+		return
+	}
 
-			fileInfo := models.FileInfo{
-				Name:                info.Name(),
-				Path:                path,
-				Tags:                tags,
-				Comment:             comment,
-				Created:             getBirthTime(info),
-				Size:                info.Size(),
-				OSModTime:           osModTime,
-				OSBirthTime:         osBirthTime,
-				EXIFCreateDate:      exifCreate,
-				EXIFModifyDate:      exifModify,
-				EarliestDate:        earliest,
-				NeedsDateCorrection: needsCorrection,
-				LargeDiscrepancy:    largeDiscrepancy,
-				MaxDiffHours:        maxDiffHours,
-			}
+	fs.progress.Store(fs.total.Load())
+	events.Publish(events.ScanCompleted, map[string]interface{}{
+		"kind":    "freshness",
+		"success": true,
+		"stale":   len(stale),
+		"missing": missingCount.Load(),
+		"offline": offlineCount.Load(),
+	})
+	log.Printf("✅ Freshness check complete: %d stale, %d missing, %d offline", len(stale), missingCount.Load(), offlineCount.Load())
+}
 
-			fs.cache.UpsertFile(fileInfo)
-		}
+// RebuildIndex rebuilds the in-memory index from the current file list, so
+// derived state such as a saved date correction or a new integrity check
+// result shows up in the synthetic categories
+func RebuildIndex() {
+	state.LockRebuild()
+	defer state.UnlockRebuild()
 
-		// Pacing: ~100 files/second
-		time.Sleep(10 * time.Millisecond)
-	}
+	current := state.GetCurrent()
+	files := make([]models.FileInfo, len(current.AllFiles))
+	copy(files, current.AllFiles)
 
-	log.Printf("✅ Freshness check complete: %d stale, %d missing", staleCount, missingCount)
+	inactive := state.GetInactiveState()
+	buildInMemoryStructuresInto(files, inactive)
+	state.SwapState(inactive)
 }
 
 // buildInMemoryStructuresInto rebuilds the in-memory file index from cached files
@@ -742,7 +1116,18 @@ func buildInMemoryStructuresInto(files []models.FileInfo, targetState *state.App
 	filesByDir := make(map[string][]models.FileInfo)
 
 	// Process files and build indexes
+	volumes := make(library.VolumeStatus)
+	corrected := loadCorrectedDates()
+	checks := loadFileChecks()
 	for _, file := range files {
+		// Files on unmounted volumes stay listed, flagged offline
+		if file.Volume == "" {
+			file.Volume = library.VolumeRoot(file.Path)
+		}
+		file.Offline = !volumes.Online(file.Path)
+		file.TimelineDate = timelineDate(file, corrected)
+		file.BrokenReason = brokenReason(file, checks)
+
 		// Add to all files list
 		targetState.AllFiles = append(targetState.AllFiles, file)
 
@@ -775,6 +1160,19 @@ func buildInMemoryStructuresInto(files []models.FileInfo, targetState *state.App
 				filesByTag["🔍 Needs Review (>24h)"] = append(filesByTag["🔍 Needs Review (>24h)"], file)
 			}
 		}
+		if file.TimezoneMismatch {
+			filesByTag[TimezoneCategory] = append(filesByTag[TimezoneCategory], file)
+		}
+
+		if file.Offline {
+			filesByTag[OfflineCategory] = append(filesByTag[OfflineCategory], file)
+		}
+		if file.BrokenReason != "" {
+			filesByTag[BrokenCategory] = append(filesByTag[BrokenCategory], file)
+		}
+
+		addLocationCategory(filesByTag, file, category)
+		addRatingCategories(filesByTag, file, category)
 	}
 
 	// Create "All" category
@@ -784,6 +1182,9 @@ func buildInMemoryStructuresInto(files []models.FileInfo, targetState *state.App
 	})
 	filesByTag["All"] = allFilesList
 
+	addTimelineCategories(filesByTag, allFilesList)
+	addCollectionCategories(filesByTag, allFilesList)
+
 	// Create tag count synthetic views
 	tagCountBuckets := map[string][]models.FileInfo{
 		"1 Tag":   {},
@@ -872,13 +1273,38 @@ func buildInMemoryStructuresInto(files []models.FileInfo, targetState *state.App
 func SaveToCache(c *cache.Cache) {
 	log.Println("💾 Saving scan results to cache...")
 
-	allFiles := state.GetAllFiles()
-	allTags := state.GetAllTags()
+	// Copy under the data lock; tag and comment edits change files in place
+	state.RLockData()
+	allFiles := append([]models.FileInfo(nil), state.GetAllFiles()...)
+	tagCount := len(state.GetAllTags())
+	state.RUnlockData()
 
-	if err := c.SaveFiles(allFiles, len(allTags)); err != nil {
+	stats, err := c.SaveFiles(allFiles, tagCount)
+	if err != nil {
 		log.Printf("⚠️  Failed to save to cache: %v", err)
 		return
 	}
 
-	log.Println("✅ Cache saved successfully")
+	log.Printf("✅ Cache saved: %d inserted, %d updated, %d deleted, %d unchanged",
+		stats.Inserted, stats.Updated, stats.Deleted, stats.Unchanged)
+
+	syncTextIndex(c, allFiles)
+}
+
+// syncTextIndex brings the full-text index in line with files, reading the
+// contents of new and changed text files
+func syncTextIndex(c *cache.Cache, files []models.FileInfo) {
+	if !c.TextSearchAvailable() {
+		return
+	}
+	start := time.Now()
+	stats, err := c.SyncTextIndex(files)
+	if err != nil {
+		log.Printf("⚠️  Failed to update text index: %v", err)
+		return
+	}
+	if stats.Indexed > 0 || stats.Removed > 0 {
+		log.Printf("🔎 Text index updated: %d indexed, %d removed, %d unchanged (%v)",
+			stats.Indexed, stats.Removed, stats.Unchanged, time.Since(start).Round(time.Millisecond))
+	}
 }
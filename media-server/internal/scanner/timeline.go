@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"log"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// TimelinePrefix starts the synthetic year, month and day categories,
+// e.g. "🗓 2019", "🗓 2019-07" and "🗓 2019-07-14"
+const TimelinePrefix = "🗓 "
+
+// TimelineZone is the zone timeline days are cut in, the same zone analysed
+// dates are stored in (see analyzeDateMetadata)
+var TimelineZone = displayZone
+
+// loadCorrectedDates returns the user's date corrections from the ML database
+func loadCorrectedDates() map[string]time.Time {
+	c, ok := state.GetCache().(*cache.Cache)
+	if !ok {
+		return nil
+	}
+	dates, err := c.CorrectedDates()
+	if err != nil {
+		log.Printf("⚠️  Failed to load date corrections: %v", err)
+		return nil
+	}
+	return dates
+}
+
+// timelineDate picks the date a file is filed under on the timeline
+func timelineDate(file models.FileInfo, corrected map[string]time.Time) time.Time {
+	if t, ok := corrected[file.Path]; ok {
+		return t
+	}
+	if !file.EarliestDate.IsZero() {
+		return file.EarliestDate
+	}
+	return file.Created
+}
+
+// TimelinePeriods returns the year, month and day category names of a date
+func TimelinePeriods(t time.Time) [3]string {
+	day := t.In(TimelineZone).Format("2006-01-02")
+	return [3]string{TimelinePrefix + day[:4], TimelinePrefix + day[:7], TimelinePrefix + day}
+}
+
+// addTimelineCategories files each dated file under its day and rolls it up
+// into the month and year, like parent folder aggregation
+func addTimelineCategories(filesByTag map[string][]models.FileInfo, files []models.FileInfo) {
+	for _, file := range files {
+		if file.TimelineDate.IsZero() {
+			continue
+		}
+		for _, period := range TimelinePeriods(file.TimelineDate) {
+			filesByTag[period] = append(filesByTag[period], file)
+		}
+	}
+}
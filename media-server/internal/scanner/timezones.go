@@ -0,0 +1,176 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/metadata"
+)
+
+// TimezoneCategory lists files whose only date discrepancy is a camera clock
+// set to another zone (see timezoneShifted). They stay out of the training queue.
+const TimezoneCategory = "🕓 Timezone Mismatch"
+
+// displayZone is the zone all analysed dates are stored and compared in:
+// Arizona time, fixed UTC-7 with no DST
+var displayZone = time.FixedZone("MST", -7*3600)
+
+// TimezoneRules choose the zone of camera wall-clock dates: EXIF dates without
+// an OffsetTime* tag and AVI dates. The longest matching folder wins, then the
+// EXIF camera model, then Default. Zones are IANA names or offsets like "+09:00".
+type TimezoneRules struct {
+	Default string            `json:"default,omitempty"`
+	Folders map[string]string `json:"folders,omitempty"` // Folder path -> zone
+	Models  map[string]string `json:"models,omitempty"`  // EXIF Model -> zone
+
+	def     *time.Location
+	folders map[string]*time.Location
+	models  map[string]*time.Location
+}
+
+var (
+	timezoneRules   = &TimezoneRules{def: displayZone}
+	timezoneRulesMu sync.RWMutex
+)
+
+// LoadTimezoneRules reads a --camera-tz-config JSON file
+func LoadTimezoneRules(path string) (*TimezoneRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules TimezoneRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+// Prepare resolves every zone name, failing on the first unknown one
+func (r *TimezoneRules) Prepare() error {
+	r.def = displayZone
+	if r.Default != "" {
+		loc, err := parseZone(r.Default)
+		if err != nil {
+			return err
+		}
+		r.def = loc
+	}
+
+	r.folders = make(map[string]*time.Location, len(r.Folders))
+	for dir, name := range r.Folders {
+		loc, err := parseZone(name)
+		if err != nil {
+			return fmt.Errorf("folder %s: %w", dir, err)
+		}
+		r.folders[filepath.Clean(dir)] = loc
+	}
+
+	r.models = make(map[string]*time.Location, len(r.Models))
+	for model, name := range r.Models {
+		loc, err := parseZone(name)
+		if err != nil {
+			return fmt.Errorf("model %s: %w", model, err)
+		}
+		r.models[strings.ToLower(strings.TrimSpace(model))] = loc
+	}
+	return nil
+}
+
+// SetTimezoneRules replaces the camera timezone rules. Call Prepare first.
+func SetTimezoneRules(r *TimezoneRules) {
+	timezoneRulesMu.Lock()
+	defer timezoneRulesMu.Unlock()
+	timezoneRules = r
+}
+
+// cameraZone returns the zone a camera's wall clock was most likely set to
+func cameraZone(path, model string) *time.Location {
+	timezoneRulesMu.RLock()
+	r := timezoneRules
+	timezoneRulesMu.RUnlock()
+
+	best := ""
+	for dir := range r.folders {
+		if strings.HasPrefix(path, dir+"/") && len(dir) > len(best) {
+			best = dir
+		}
+	}
+	if best != "" {
+		return r.folders[best]
+	}
+	if loc, ok := r.models[strings.ToLower(strings.TrimSpace(model))]; ok && model != "" {
+		return loc
+	}
+	return r.def
+}
+
+// parseZone accepts an IANA zone name ("Asia/Tokyo", "UTC") or a fixed offset
+func parseZone(name string) (*time.Location, error) {
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		return metadata.ParseOffset(name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// zoneShiftTolerance absorbs the seconds between a camera writing its
+// wall-clock time and the file landing on disk
+const zoneShiftTolerance = 2 * time.Minute
+
+// isZoneShift reports whether d is a plausible difference between two UTC
+// offsets (which run from -12:00 to +14:00): a multiple of 15 minutes between
+// 15 minutes and 26 hours, give or take the tolerance
+func isZoneShift(d time.Duration) bool {
+	if d < 0 {
+		d = -d
+	}
+	if d < 15*time.Minute-zoneShiftTolerance || d > 26*time.Hour+zoneShiftTolerance {
+		return false
+	}
+	rem := d % (15 * time.Minute)
+	return rem <= zoneShiftTolerance || rem >= 15*time.Minute-zoneShiftTolerance
+}
+
+// timezoneShifted reports whether the wall-clock dates (whose zone was
+// guessed) disagree with the absolute timestamps by exactly one zone shift:
+// moving the wall-clock dates by that shift makes every date agree.
+func timezoneShifted(wallClock, absolute []time.Time) bool {
+	if len(wallClock) == 0 {
+		return false
+	}
+	near := func(a, b time.Time) bool {
+		d := a.Sub(b)
+		return d <= zoneShiftTolerance && d >= -zoneShiftTolerance
+	}
+
+	for _, anchor := range absolute {
+		shift := wallClock[0].Sub(anchor)
+		if !isZoneShift(shift) {
+			continue
+		}
+		explained := true
+		for _, w := range wallClock {
+			if !near(w.Add(-shift), anchor) {
+				explained = false
+			}
+		}
+		for _, a := range absolute {
+			if !near(a, anchor) {
+				explained = false
+			}
+		}
+		if explained {
+			return true
+		}
+	}
+	return false
+}
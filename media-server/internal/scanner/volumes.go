@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/library"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/state"
+)
+
+// OfflineCategory lists files whose volume is currently unmounted
+const OfflineCategory = "💤 Offline Volume"
+
+// VolumeInfo summarises one volume of the library for /api/volumes
+type VolumeInfo struct {
+	Root   string `json:"root"`
+	Online bool   `json:"online"`
+	Files  int    `json:"files"`
+}
+
+// GetVolumes returns every volume holding library files, sorted by root
+func GetVolumes() []VolumeInfo {
+	byRoot := make(map[string]*VolumeInfo)
+	for _, f := range state.GetCurrent().AllFiles {
+		root := f.Volume
+		if root == "" {
+			root = library.VolumeRoot(f.Path)
+		}
+		v, ok := byRoot[root]
+		if !ok {
+			v = &VolumeInfo{Root: root, Online: true}
+			byRoot[root] = v
+		}
+		v.Files++
+		if f.Offline {
+			v.Online = false
+		}
+	}
+
+	volumes := make([]VolumeInfo, 0, len(byRoot))
+	for _, v := range byRoot {
+		volumes = append(volumes, *v)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Root < volumes[j].Root })
+	return volumes
+}
+
+// keepOfflineFiles returns the last known metadata for paths that could not be
+// stat'ed because their volume is unmounted. Paths on mounted volumes are
+// genuinely gone and are not returned.
+func keepOfflineFiles(missing []string) []models.FileInfo {
+	if len(missing) == 0 {
+		return nil
+	}
+
+	known := make(map[string]models.FileInfo)
+	for _, f := range state.GetCurrent().AllFiles {
+		known[f.Path] = f
+	}
+	c, _ := state.GetCache().(*cache.Cache)
+
+	volumes := make(library.VolumeStatus)
+	var kept []models.FileInfo
+	for _, path := range missing {
+		if volumes.Online(path) {
+			continue
+		}
+		f, ok := known[path]
+		if !ok && c != nil {
+			if cached := c.GetFile(path); cached != nil {
+				f, ok = *cached, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		f.Offline = true
+		f.Volume = library.VolumeRoot(path)
+		kept = append(kept, f)
+	}
+
+	if len(kept) > 0 {
+		log.Printf("💤 Keeping %d files on offline volumes", len(kept))
+	}
+	return kept
+}
+
+// StartVolumeMonitor periodically checks the mount state of every volume in the
+// library and rebuilds the in-memory state when one goes offline or comes back,
+// until ctx is done. The returned channel is closed once it has stopped.
+func StartVolumeMonitor(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !state.IsScanning() {
+					refreshVolumes()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// refreshVolumes re-evaluates offline flags and swaps in a rebuilt state if any changed
+func refreshVolumes() {
+	current := state.GetCurrent()
+	volumes := make(library.VolumeStatus)
+
+	changed := make(map[string]bool) // volume root -> now online
+	for _, f := range current.AllFiles {
+		if online := volumes.Online(f.Path); online == f.Offline {
+			changed[library.VolumeRoot(f.Path)] = online
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	for root, online := range changed {
+		if online {
+			log.Printf("💾 Volume back online: %s", root)
+		} else {
+			log.Printf("💤 Volume went offline: %s", root)
+		}
+	}
+
+	state.LockRebuild()
+	defer state.UnlockRebuild()
+	files := make([]models.FileInfo, len(state.GetCurrent().AllFiles))
+	copy(files, state.GetCurrent().AllFiles)
+
+	inactive := state.GetInactiveState()
+	buildInMemoryStructuresInto(files, inactive)
+	state.SwapState(inactive)
+}
+
+// RelocatePrefix moves every library path under oldPrefix to newPrefix, in the
+// cache, the ML database, the stored library paths and the in-memory state.
+// Used when a volume is mounted at a different location than before.
+func RelocatePrefix(oldPrefix, newPrefix string) (files int, decisions int, err error) {
+	oldPrefix = filepath.Clean(oldPrefix)
+	newPrefix = filepath.Clean(newPrefix)
+	if !filepath.IsAbs(oldPrefix) || !filepath.IsAbs(newPrefix) {
+		return 0, 0, fmt.Errorf("relocation prefixes must be absolute paths")
+	}
+	if oldPrefix == newPrefix {
+		return 0, 0, nil
+	}
+
+	if c, ok := state.GetCache().(*cache.Cache); ok {
+		files, decisions, err = c.RelocatePrefix(oldPrefix, newPrefix)
+		if err != nil {
+			return files, decisions, err
+		}
+	}
+
+	state.RelocateLibraryPaths(oldPrefix, newPrefix)
+
+	state.LockRebuild()
+	defer state.UnlockRebuild()
+	current := state.GetCurrent()
+	updated := make([]models.FileInfo, len(current.AllFiles))
+	for i, f := range current.AllFiles {
+		if f.Path == oldPrefix || strings.HasPrefix(f.Path, oldPrefix+"/") {
+			f.Path = newPrefix + strings.TrimPrefix(f.Path, oldPrefix)
+			f.Volume = library.VolumeRoot(f.Path)
+		}
+		updated[i] = f
+	}
+	inactive := state.GetInactiveState()
+	buildInMemoryStructuresInto(updated, inactive)
+	state.SwapState(inactive)
+
+	log.Printf("🔀 Relocated %s → %s (%d files, %d date decisions)", oldPrefix, newPrefix, files, decisions)
+	return files, decisions, nil
+}
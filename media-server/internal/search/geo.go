@@ -0,0 +1,123 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// earthRadiusKm is the mean Earth radius used for great-circle distances
+const earthRadiusKm = 6371.0088
+
+// NearNode represents a near:lat,lon,radius predicate. The radius is in
+// kilometres unless suffixed with m, km or mi.
+type NearNode struct {
+	Latitude, Longitude float64
+	RadiusKm            float64
+}
+
+func newNearNode(value string) (QueryNode, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("near: expects lat,lon,radius (got %q)", value)
+	}
+	coords, err := parseFloats(parts[:2])
+	if err != nil {
+		return nil, fmt.Errorf("near: %v", err)
+	}
+	if coords[0] < -90 || coords[0] > 90 || coords[1] < -180 || coords[1] > 180 {
+		return nil, fmt.Errorf("near: coordinates out of range")
+	}
+
+	radius := strings.ToLower(strings.TrimSpace(parts[2]))
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(radius, "km"):
+		radius = strings.TrimSuffix(radius, "km")
+	case strings.HasSuffix(radius, "mi"):
+		radius, scale = strings.TrimSuffix(radius, "mi"), 1.609344
+	case strings.HasSuffix(radius, "m"):
+		radius, scale = strings.TrimSuffix(radius, "m"), 0.001
+	}
+	r, err := strconv.ParseFloat(radius, 64)
+	if err != nil || r <= 0 {
+		return nil, fmt.Errorf("near: invalid radius %q", parts[2])
+	}
+	return &NearNode{Latitude: coords[0], Longitude: coords[1], RadiusKm: r * scale}, nil
+}
+
+// Evaluate returns all files located within the radius
+func (n *NearNode) Evaluate(filesByTag map[string][]models.FileInfo) []models.FileInfo {
+	result := []models.FileInfo{}
+	for _, file := range filesByTag["All"] {
+		if file.Location != nil && DistanceKm(n.Latitude, n.Longitude, file.Location.Latitude, file.Location.Longitude) <= n.RadiusKm {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// BBoxNode represents a bbox:south,west,north,east predicate. A box with
+// west > east crosses the antimeridian.
+type BBoxNode struct {
+	South, West, North, East float64
+}
+
+func newBBoxNode(value string) (QueryNode, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox: expects south,west,north,east (got %q)", value)
+	}
+	v, err := parseFloats(parts)
+	if err != nil {
+		return nil, fmt.Errorf("bbox: %v", err)
+	}
+	if v[0] > v[2] {
+		return nil, fmt.Errorf("bbox: south %g is north of north %g", v[0], v[2])
+	}
+	return &BBoxNode{South: v[0], West: v[1], North: v[2], East: v[3]}, nil
+}
+
+// Evaluate returns all files located inside the box
+func (n *BBoxNode) Evaluate(filesByTag map[string][]models.FileInfo) []models.FileInfo {
+	result := []models.FileInfo{}
+	for _, file := range filesByTag["All"] {
+		loc := file.Location
+		if loc == nil || loc.Latitude < n.South || loc.Latitude > n.North {
+			continue
+		}
+		inLon := loc.Longitude >= n.West && loc.Longitude <= n.East
+		if n.West > n.East {
+			inLon = loc.Longitude >= n.West || loc.Longitude <= n.East
+		}
+		if inLon {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// DistanceKm returns the haversine great-circle distance between two points
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func parseFloats(parts []string) ([]float64, error) {
+	out := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
@@ -27,9 +27,10 @@ const (
 )
 
 type token struct {
-	typ   tokenType
-	value string
-	pos   int
+	typ    tokenType
+	value  string
+	pos    int
+	quoted bool // Quoted tags are never predicates
 }
 
 // Parse parses a query string and returns the root QueryNode
@@ -93,7 +94,7 @@ func (p *Parser) tokenize() error {
 			}
 			value := string(runes[start:runePos])
 			runePos++ // skip closing quote
-			p.tokens = append(p.tokens, token{typ: tokenTag, value: value, pos: start - 1})
+			p.tokens = append(p.tokens, token{typ: tokenTag, value: value, pos: start - 1, quoted: true})
 		default:
 			// Read identifier (tag name or keyword)
 			// Allow any printable character except whitespace and special parser chars
@@ -110,6 +111,21 @@ func (p *Parser) tokenize() error {
 				return fmt.Errorf("unexpected character at position %d: %c", runePos, ch)
 			}
 
+			// Predicate with a quoted argument: text:"two words"
+			if strings.HasSuffix(value, ":") && runePos < len(runes) && runes[runePos] == '"' {
+				end := runePos + 1
+				for end < len(runes) && runes[end] != '"' {
+					end++
+				}
+				if end >= len(runes) {
+					return fmt.Errorf("unterminated quoted string at position %d", runePos)
+				}
+				value += string(runes[runePos+1 : end])
+				runePos = end + 1
+				p.tokens = append(p.tokens, token{typ: tokenTag, value: value, pos: start})
+				continue
+			}
+
 			upper := strings.ToUpper(value)
 
 			switch upper {
@@ -205,13 +221,21 @@ func (p *Parser) parseFactor() (QueryNode, error) {
 	return p.parsePrimary()
 }
 
-// parsePrimary parses: tag | ( expression )
+// parsePrimary parses: tag | predicate | ( expression )
 func (p *Parser) parsePrimary() (QueryNode, error) {
 	tok := p.current()
 
 	switch tok.typ {
 	case tokenTag:
 		p.advance()
+		if !tok.quoted {
+			if node, ok, err := parsePredicate(tok.value); ok {
+				if err != nil {
+					return nil, fmt.Errorf("%v at position %d", err, tok.pos)
+				}
+				return node, nil
+			}
+		}
 		return &TagNode{TagName: tok.value}, nil
 
 	case tokenLParen:
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// predicates maps the name before the colon in name:value terms to the
+// function that builds their node. Terms with any other prefix are tags.
+var predicates = map[string]func(value string) (QueryNode, error){
+	"text":   newTextNode,
+	"near":   newNearNode,
+	"bbox":   newBBoxNode,
+	"rating": newRatingEquals,
+	"label":  newLabelNode,
+}
+
+// parsePredicate recognises name:value and comparison terms. ok is false for
+// plain tags. text:... is only a predicate when the full-text index is
+// available, so existing tags named text:... keep working without it.
+func parsePredicate(term string) (node QueryNode, ok bool, err error) {
+	if node, ok, err := parseComparison(term); ok {
+		return node, ok, err
+	}
+	name, value, found := strings.Cut(term, ":")
+	if !found {
+		return nil, false, nil
+	}
+	build, ok := predicates[strings.ToLower(name)]
+	if !ok {
+		return nil, false, nil
+	}
+	if strings.EqualFold(name, "text") && TextMatcher == nil {
+		return nil, false, nil
+	}
+	node, err = build(value)
+	if text, ok := node.(*TextNode); ok {
+		text.Tag = term
+	}
+	return node, true, err
+}
+
+// TextMatcher returns the paths whose name, comment or text contents match a
+// full-text query. Set at startup when the full-text index is available.
+var TextMatcher func(query string) (map[string]bool, error)
+
+// TextNode represents a text:"..." full-text predicate
+type TextNode struct {
+	Query string
+	Tag   string // The term as typed; a tag with this exact name is matched instead
+}
+
+func newTextNode(value string) (QueryNode, error) {
+	if strings.TrimSpace(strings.Trim(value, "*")) == "" {
+		return nil, fmt.Errorf("empty text: query")
+	}
+	return &TextNode{Query: value}, nil
+}
+
+// Evaluate returns all files matching the full-text query
+func (n *TextNode) Evaluate(filesByTag map[string][]models.FileInfo) []models.FileInfo {
+	if _, ok := filesByTag[n.Tag]; ok && n.Tag != "" {
+		return (&TagNode{TagName: n.Tag}).Evaluate(filesByTag)
+	}
+
+	matches, err := TextMatcher(n.Query)
+	if err != nil {
+		log.Printf("⚠️  Text search %q failed: %v", n.Query, err)
+		return []models.FileInfo{}
+	}
+
+	result := []models.FileInfo{}
+	for _, file := range filesByTag["All"] {
+		if matches[file.Path] {
+			result = append(result, file)
+		}
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tdsanchez/PostMac/internal/models"
+)
+
+// comparisons maps the name in name<op>value terms (rating>=4) to the function
+// that builds their node
+var comparisons = map[string]func(op string, value string) (QueryNode, error){
+	"rating": newRatingNode,
+}
+
+// comparisonOps are tried longest first so ">=" is not read as ">"
+var comparisonOps = []string{">=", "<=", "!=", ">", "<", "="}
+
+// parseComparison recognises name<op>value terms. ok is false for anything else.
+func parseComparison(term string) (node QueryNode, ok bool, err error) {
+	i := strings.IndexAny(term, "<>=!")
+	if i <= 0 {
+		return nil, false, nil
+	}
+	build, ok := comparisons[strings.ToLower(term[:i])]
+	if !ok {
+		return nil, false, nil
+	}
+	for _, op := range comparisonOps {
+		if strings.HasPrefix(term[i:], op) {
+			node, err = build(op, term[i+len(op):])
+			return node, true, err
+		}
+	}
+	return nil, true, fmt.Errorf("invalid comparison %q", term)
+}
+
+// RatingNode represents a rating comparison such as rating>=4 or rating:5
+type RatingNode struct {
+	Op     string
+	Rating int
+}
+
+func newRatingNode(op, value string) (QueryNode, error) {
+	rating, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || rating < 0 || rating > 5 {
+		return nil, fmt.Errorf("rating: expects a number from 0 to 5 (got %q)", value)
+	}
+	return &RatingNode{Op: op, Rating: rating}, nil
+}
+
+// newRatingEquals handles the rating:N predicate form
+func newRatingEquals(value string) (QueryNode, error) {
+	return newRatingNode("=", value)
+}
+
+// Matches reports whether a rating satisfies the comparison
+func (n *RatingNode) Matches(rating int) bool {
+	switch n.Op {
+	case ">=":
+		return rating >= n.Rating
+	case "<=":
+		return rating <= n.Rating
+	case "!=":
+		return rating != n.Rating
+	case ">":
+		return rating > n.Rating
+	case "<":
+		return rating < n.Rating
+	}
+	return rating == n.Rating
+}
+
+// Evaluate returns all files whose star rating satisfies the comparison
+func (n *RatingNode) Evaluate(filesByTag map[string][]models.FileInfo) []models.FileInfo {
+	result := []models.FileInfo{}
+	for _, file := range filesByTag["All"] {
+		if n.Matches(file.Rating) {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// LabelNode represents a label:red color label predicate; label:none matches
+// files without a label
+type LabelNode struct {
+	Label string
+}
+
+func newLabelNode(value string) (QueryNode, error) {
+	label := strings.ToLower(strings.TrimSpace(value))
+	switch label {
+	case "":
+		return nil, fmt.Errorf("empty label: predicate")
+	case "none":
+		label = ""
+	case "grey":
+		label = "gray"
+	}
+	return &LabelNode{Label: label}, nil
+}
+
+// Evaluate returns all files with the color label
+func (n *LabelNode) Evaluate(filesByTag map[string][]models.FileInfo) []models.FileInfo {
+	result := []models.FileInfo{}
+	for _, file := range filesByTag["All"] {
+		if file.ColorLabel == n.Label {
+			result = append(result, file)
+		}
+	}
+	return result
+}
@@ -1,10 +1,13 @@
 package state
 
 import (
+	"strings"
 	"sync"
 	"sync/atomic"
 
 	"github.com/tdsanchez/PostMac/internal/cache"
+	"github.com/tdsanchez/PostMac/internal/library"
+	"github.com/tdsanchez/PostMac/internal/metrics"
 	"github.com/tdsanchez/PostMac/internal/models"
 )
 
@@ -12,7 +15,9 @@ import (
 type CacheInterface interface {
 	UpdateFileComment(absPath, comment string) error
 	UpdateFileTags(absPath string, tags []string) error
+	UpdateFileRating(absPath string, rating int, label string) error
 	DeleteFile(absPath string) error
+	RelocatePath(oldPath, newPath string) error
 	SaveDateDecision(absPath, decision string, osModTime, osBirthTime, exifCreateTime, exifModifyTime, earliestTime int64, maxDiffHours int, hasExif bool) error
 	GetDateDecision(absPath string) (decision string, exists bool, err error)
 	GetDateDecisionStats() (*cache.DateDecisionStats, error)
@@ -30,6 +35,7 @@ type AppState struct {
 var (
 	stdinPaths []string     // Store stdin paths for rescans
 	stdinMutex sync.RWMutex // Protect stdin paths
+	roots      []library.Root // Directory roots, re-walked on every rescan
 
 	// Double-buffered state for lock-free reads
 	stateA       *AppState
@@ -37,6 +43,9 @@ var (
 	currentState atomic.Value // Holds *AppState - lock-free reads!
 	inactiveIdx  int          // 0=A is inactive, 1=B is inactive
 	stateMutex   sync.Mutex   // Only for swap operation
+	rebuildMutex sync.Mutex   // Serialises in-place edits with copy-build-swap rebuilds
+	editSeq      uint64            // Counts in-place edits (guarded by rebuildMutex)
+	editedAt     map[string]uint64 // Path -> editSeq of its latest in-place edit
 
 	// Legacy variables (kept for compatibility during transition)
 	filesByTag      map[string][]models.FileInfo // DEPRECATED: Use GetCurrent()
@@ -125,6 +134,50 @@ func RUnlockData() {
 	dataMutex.RUnlock()
 }
 
+// LockRebuild is held by in-place edits of the current state (tags, comments,
+// removals) and by rebuilds that copy the current file list into the inactive
+// buffer and swap it in, so an edit can't land between the copy and the swap
+// and be lost. Take it before LockData.
+func LockRebuild() {
+	rebuildMutex.Lock()
+}
+
+// UnlockRebuild releases LockRebuild
+func UnlockRebuild() {
+	rebuildMutex.Unlock()
+}
+
+// NoteEdit records an in-place edit of a file's tags, comment or rating, so a
+// rescan that read the file from disk before the edit keeps the edited values.
+// Call with LockRebuild held.
+func NoteEdit(path string) {
+	if editedAt == nil {
+		editedAt = make(map[string]uint64)
+	}
+	editSeq++
+	editedAt[path] = editSeq
+}
+
+// EditSeq returns the sequence number of the latest in-place edit; pass it to
+// EditedSince once a scan started now has finished
+func EditSeq() uint64 {
+	rebuildMutex.Lock()
+	defer rebuildMutex.Unlock()
+	return editSeq
+}
+
+// EditedSince returns the paths edited in place after seq. Call with
+// LockRebuild held.
+func EditedSince(seq uint64) map[string]bool {
+	edited := make(map[string]bool)
+	for path, at := range editedAt {
+		if at > seq {
+			edited[path] = true
+		}
+	}
+	return edited
+}
+
 // GetServerReady returns the server ready channel
 func GetServerReady() chan bool {
 	return serverReady
@@ -287,6 +340,7 @@ func SwapState(newState *AppState) {
 
 	// Flip which buffer is inactive
 	inactiveIdx = 1 - inactiveIdx
+	metrics.StateSwaps.Inc()
 
 	// Update legacy variables for backward compatibility
 	filesByTag = newState.FilesByTag
@@ -314,3 +368,62 @@ func AddStdinPath(path string) {
 	defer stdinMutex.Unlock()
 	stdinPaths = append(stdinPaths, path)
 }
+
+// RemoveStdinPaths drops deleted or moved-away paths from the stdin paths list
+func RemoveStdinPaths(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	gone := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		gone[p] = true
+	}
+
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+	kept := make([]string, 0, len(stdinPaths))
+	for _, p := range stdinPaths {
+		if !gone[p] {
+			kept = append(kept, p)
+		}
+	}
+	stdinPaths = kept
+}
+
+// SetRoots stores the directory roots the library is built from
+func SetRoots(r []library.Root) {
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+	roots = r
+}
+
+// GetRoots returns the configured directory roots
+func GetRoots() []library.Root {
+	stdinMutex.RLock()
+	defer stdinMutex.RUnlock()
+	return roots
+}
+
+// RelocateLibraryPaths rewrites stdin paths and root directories under
+// oldPrefix to newPrefix, so rescans find files at a volume's new mount point
+func RelocateLibraryPaths(oldPrefix, newPrefix string) {
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+
+	relocate := func(p string) string {
+		if p == oldPrefix || strings.HasPrefix(p, oldPrefix+"/") {
+			return newPrefix + strings.TrimPrefix(p, oldPrefix)
+		}
+		return p
+	}
+
+	rewritten := make([]string, len(stdinPaths))
+	for i, p := range stdinPaths {
+		rewritten[i] = relocate(p)
+	}
+	stdinPaths = rewritten
+
+	for i := range roots {
+		roots[i].Path = relocate(roots[i].Path)
+	}
+}
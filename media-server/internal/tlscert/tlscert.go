@@ -0,0 +1,243 @@
+// Package tlscert keeps the local certificate authority and server
+// certificate that "media-server --tls-self-signed" serves HTTPS with.
+//
+// The CA is generated once and kept, so clients that trust its ca.pem keep
+// trusting the server when its certificate is renewed or the machine's
+// addresses change. The server certificate is reissued when it nears expiry
+// or no longer names every host the server is reached by.
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File names in the certificate directory
+const (
+	CAFile        = "ca.pem"
+	caKeyFile     = "ca-key.pem"
+	ServerFile    = "server.pem"
+	serverKeyFile = "server-key.pem"
+)
+
+const (
+	caLifetime     = 10 * 365 * 24 * time.Hour
+	serverLifetime = 397 * 24 * time.Hour // Longest validity browsers accept
+	renewBefore    = 30 * 24 * time.Hour
+)
+
+// DefaultDir returns ~/.media-server-conf/tls
+func DefaultDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".media-server-conf", "tls"), nil
+}
+
+// Hosts returns the names and addresses the server certificate should cover:
+// localhost, this machine's host name (and its .local Bonjour name), every
+// interface address, and any extra names given
+func Hosts(extra []string) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	add := func(h string) {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+
+	add("localhost")
+	if name, err := os.Hostname(); err == nil {
+		add(name)
+		if !strings.Contains(name, ".") {
+			add(name + ".local")
+		}
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				add(ipNet.IP.String())
+			}
+		}
+	}
+	for _, h := range extra {
+		add(h)
+	}
+	return hosts
+}
+
+// EnsureSelfSigned returns the server certificate and key files in dir,
+// creating the local CA on first use and (re)issuing the server certificate
+// when it is missing, expires within 30 days or does not cover hosts
+func EnsureSelfSigned(dir string, hosts []string) (certFile, keyFile string, err error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	certFile = filepath.Join(dir, ServerFile)
+	keyFile = filepath.Join(dir, serverKeyFile)
+
+	ca, caKey, err := loadOrCreateCA(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	if cert, err := readCert(certFile); err == nil {
+		_, keyErr := os.Stat(keyFile)
+		if keyErr == nil && cert.CheckSignatureFrom(ca) == nil &&
+			time.Until(cert.NotAfter) > renewBefore && covers(cert, hosts) {
+			return certFile, keyFile, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	tmpl, err := newTemplate("media-server", serverLifetime)
+	if err != nil {
+		return "", "", err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+	if err := writeKeyPair(certFile, keyFile, der, key); err != nil {
+		return "", "", err
+	}
+	log.Printf("🔏 Issued server certificate for %s (valid until %s)",
+		strings.Join(hosts, ", "), tmpl.NotAfter.Format("2006-01-02"))
+	return certFile, keyFile, nil
+}
+
+// loadOrCreateCA reads the local CA from dir, generating it on first use
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caPath := filepath.Join(dir, CAFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	cert, certErr := readCert(caPath)
+	key, keyErr := readKey(keyPath)
+	if certErr == nil && keyErr == nil {
+		return cert, key, nil
+	}
+	if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("local CA in %s is incomplete or unreadable (remove it to start over): %v", dir, errors.Join(certErr, keyErr))
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := "media-server local CA"
+	if host, err := os.Hostname(); err == nil {
+		name += " (" + host + ")"
+	}
+	tmpl, err := newTemplate(name, caLifetime)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.MaxPathLenZero = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeKeyPair(caPath, keyPath, der, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("🔏 Created local CA %s", caPath)
+	log.Printf("   Trust it on each client to avoid certificate warnings, e.g. on macOS:")
+	log.Printf("   security add-trusted-cert -r trustRoot -k ~/Library/Keychains/login.keychain-db %s", caPath)
+	return cert, key, nil
+}
+
+// newTemplate starts a certificate valid from an hour ago for lifetime
+func newTemplate(commonName string, lifetime time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"media-server"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(lifetime),
+	}, nil
+}
+
+// covers reports whether cert names every host
+func covers(cert *x509.Certificate, hosts []string) bool {
+	for _, h := range hosts {
+		if cert.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no PEM certificate", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func readKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM key", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// writeKeyPair writes a certificate (world-readable) and its key (owner only)
+func writeKeyPair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
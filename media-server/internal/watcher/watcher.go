@@ -1,31 +1,63 @@
 package watcher
 
 import (
+	"io/fs"
 	"log"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/tdsanchez/PostMac/internal/cache"
 	"github.com/tdsanchez/PostMac/internal/config"
+	"github.com/tdsanchez/PostMac/internal/models"
+	"github.com/tdsanchez/PostMac/internal/persistence"
 	"github.com/tdsanchez/PostMac/internal/scanner"
 	"github.com/tdsanchez/PostMac/internal/state"
 )
 
-// Watcher monitors filesystem changes and triggers automatic rescans
+const (
+	// debounceDelay batches bursts of events (copies, exports) into one update
+	debounceDelay = 1 * time.Second
+
+	// pollInterval is how often subtrees without inotify watches are re-walked
+	pollInterval = 30 * time.Second
+)
+
+// Watcher monitors filesystem changes and applies them as single-file updates
 type Watcher struct {
-	fsWatcher     *fsnotify.Watcher
-	dbCache       *cache.Cache
-	debounceTimer *time.Timer
-	eventQueue    chan bool
-	stopChan      chan bool
-	watchedPaths  []string // Original stdin paths for rescans
+	fsWatcher    *fsnotify.Watcher
+	dbCache      *cache.Cache
+	stopChan     chan bool
+	watchedPaths []string // Original stdin paths for rescans
+
+	mu          sync.Mutex
+	pending     map[string]bool      // Paths with changes awaiting the next flush
+	flushTimer  *time.Timer          // Debounce timer for pending changes
+	watchedDirs map[string]bool      // Directories with an active watch
+	polled      map[string]*pollTree // Subtrees polled because the watch limit was hit
+	limitLogged bool
+}
+
+// pollTree is a subtree watched by periodic walking instead of inotify
+type pollTree struct {
+	root     string
+	snapshot map[string]fileStamp
+}
+
+// fileStamp is the change signature used by the poller
+type fileStamp struct {
+	size  int64
+	mtime int64
 }
 
 // NewFromPaths creates a new filesystem watcher that monitors parent directories of the given paths.
-// Uses recursive FSEvents watching on minimal ancestor directories to avoid per-directory
+// On Linux every directory under the configured roots and the minimal ancestor
+// directories is watched (inotify is non-recursive, so each directory needs its own
+// watch). Elsewhere only the minimal ancestors are watched to avoid per-directory
 // kqueue file descriptor exhaustion when running multiple instances on large libraries.
 func NewFromPaths(paths []string, dbCache *cache.Cache) (*Watcher, error) {
 	fsWatcher, err := fsnotify.NewWatcher()
@@ -36,9 +68,11 @@ func NewFromPaths(paths []string, dbCache *cache.Cache) (*Watcher, error) {
 	w := &Watcher{
 		fsWatcher:    fsWatcher,
 		dbCache:      dbCache,
-		eventQueue:   make(chan bool, 100),
 		stopChan:     make(chan bool),
 		watchedPaths: paths,
+		pending:      make(map[string]bool),
+		watchedDirs:  make(map[string]bool),
+		polled:       make(map[string]*pollTree),
 	}
 
 	// Count total unique parent dirs for logging
@@ -50,42 +84,59 @@ func NewFromPaths(paths []string, dbCache *cache.Cache) (*Watcher, error) {
 
 	// Find the minimal set of ancestor directories that covers all parent dirs.
 	// Example: if files span /Volumes/X/photos/2020/Jan and /Volumes/X/photos/2020/Feb,
-	// we only need to watch /Volumes/X/photos — one recursive watch covers both.
+	// we only need to watch /Volumes/X/photos as the top of the tree.
 	ancestors := findCommonAncestors(paths)
+	for _, root := range state.GetRoots() {
+		ancestors = append(ancestors, root.Path)
+	}
+	ancestors = minimalDirs(ancestors)
 
-	// Watch each minimal ancestor directory. On macOS, each fsWatcher.Add()
-	// call costs 1 open file descriptor (kqueue). By watching only top-level
-	// ancestor directories instead of every unique parent directory, we reduce
-	// FD usage from O(unique_dirs) to O(volume_roots) — typically 2–10 FDs
-	// rather than thousands. Events from deeply nested subdirectories are not
-	// captured by this watch (kqueue is non-recursive), but the background
-	// freshness scanner provides a reliable safety net for those cases.
-	watchedCount := 0
-	for _, dir := range ancestors {
-		if err := fsWatcher.Add(dir); err != nil {
-			log.Printf("⚠️  Failed to watch %s: %v", dir, err)
-		} else {
-			watchedCount++
+	if recursiveWatches {
+		for _, dir := range ancestors {
+			w.addTree(dir, false)
+		}
+	} else {
+		// On macOS, each fsWatcher.Add() call costs 1 open file descriptor (kqueue).
+		// By watching only top-level ancestor directories instead of every unique
+		// parent directory, we reduce FD usage from O(unique_dirs) to O(volume_roots).
+		// Events from deeply nested subdirectories are not captured by this watch,
+		// but the background freshness scanner provides a safety net for those cases.
+		for _, dir := range ancestors {
+			if err := fsWatcher.Add(dir); err != nil {
+				log.Printf("⚠️  Failed to watch %s: %v", dir, err)
+			} else {
+				w.watchedDirs[dir] = true
+			}
 		}
 	}
 
-	log.Printf("📡 Filesystem watcher: %d recursive watches covering %d parent directories",
-		watchedCount, totalParentDirs)
+	log.Printf("📡 Filesystem watcher: %d directory watches, %d polled subtrees, covering %d parent directories",
+		len(w.watchedDirs), len(w.polled), totalParentDirs)
 
 	return w, nil
 }
 
 // findCommonAncestors computes the minimal set of directories that covers all
-// parent directories of the given paths. Sorted so shorter (higher-level) paths
-// are processed first; any dir whose prefix is already in the set is skipped.
+// parent directories of the given paths.
 func findCommonAncestors(paths []string) []string {
-	parentDirs := make(map[string]bool)
+	parentDirs := make([]string, 0, len(paths))
 	for _, p := range paths {
-		parentDirs[filepath.Dir(p)] = true
+		parentDirs = append(parentDirs, filepath.Dir(p))
 	}
+	return minimalDirs(parentDirs)
+}
 
-	sorted := make([]string, 0, len(parentDirs))
-	for d := range parentDirs {
+// minimalDirs reduces dirs to those not nested under another entry. Sorted so
+// shorter (higher-level) paths are processed first; any dir whose prefix is
+// already in the set is skipped.
+func minimalDirs(dirs []string) []string {
+	unique := make(map[string]bool)
+	for _, d := range dirs {
+		unique[d] = true
+	}
+
+	sorted := make([]string, 0, len(unique))
+	for d := range unique {
 		sorted = append(sorted, d)
 	}
 	sort.Strings(sorted)
@@ -106,14 +157,77 @@ func findCommonAncestors(paths []string) []string {
 	return minimal
 }
 
+// addTree watches root and every directory beneath it. If the inotify watch limit
+// is exhausted, the remaining subtree falls back to periodic polling. With
+// queueFiles, supported files found during the walk are queued as updates
+// (used when a populated directory is moved into the library).
+func (w *Watcher) addTree(root string, queueFiles bool) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if !d.IsDir() {
+			if queueFiles && isSupported(path) {
+				w.queue(path)
+			}
+			return nil
+		}
+
+		if path != root && skipDir(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		if err := w.fsWatcher.Add(path); err != nil {
+			if isWatchLimitError(err) {
+				w.startPolling(path)
+				return filepath.SkipDir
+			}
+			log.Printf("⚠️  Failed to watch %s: %v", path, err)
+			return nil
+		}
+
+		w.mu.Lock()
+		w.watchedDirs[path] = true
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// startPolling registers a subtree for periodic polling
+func (w *Watcher) startPolling(root string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.polled[root]; ok {
+		return
+	}
+	if !w.limitLogged {
+		log.Printf("⚠️  inotify watch limit reached at %s — falling back to polling every %v (raise fs.inotify.max_user_watches to avoid this)",
+			root, pollInterval)
+		w.limitLogged = true
+	}
+	w.polled[root] = &pollTree{root: root, snapshot: snapshotTree(root)}
+}
+
+// skipDir reports whether a directory should not be watched
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".photoslibrary")
+}
+
+// isSupported reports whether path has a supported media extension
+func isSupported(path string) bool {
+	return config.SupportedExts[strings.ToLower(filepath.Ext(path))]
+}
+
 // Start begins monitoring filesystem events
 func (w *Watcher) Start() {
 	go w.watchEvents()
-	go w.debouncedRescan()
-	log.Println("✅ Filesystem watcher started (auto-rescan enabled)")
+	go w.pollLoop()
+	log.Println("✅ Filesystem watcher started (single-file updates enabled)")
 }
 
-// watchEvents monitors filesystem events and queues rescans
+// watchEvents turns filesystem events into queued single-file updates
 func (w *Watcher) watchEvents() {
 	for {
 		select {
@@ -130,20 +244,30 @@ func (w *Watcher) watchEvents() {
 			// Log event for debugging
 			log.Printf("📝 FS event: %s %s", event.Op, event.Name)
 
-			// If this is a CREATE event for a supported file, add it to stdin paths
-			if event.Op&fsnotify.Create != 0 {
-				ext := strings.ToLower(filepath.Ext(event.Name))
-				if config.SupportedExts[ext] {
-					log.Printf("📥 Adding new file to scan list: %s", event.Name)
-					state.AddStdinPath(event.Name)
+			switch {
+			case event.Op&fsnotify.Create != 0:
+				info, err := os.Stat(event.Name)
+				if err == nil && info.IsDir() {
+					// New (or moved-in) directory: watch it and pick up its contents
+					if recursiveWatches {
+						w.addTree(event.Name, true)
+					}
+				} else if isSupported(event.Name) {
+					w.queue(event.Name)
 				}
-			}
 
-			// Queue rescan (non-blocking)
-			select {
-			case w.eventQueue <- true:
-			default:
-				// Queue full, skip this event
+			case event.Op&fsnotify.Write != 0:
+				if isSupported(event.Name) {
+					w.queue(event.Name)
+				}
+
+			case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				// The old name of a rename is gone; the new name arrives as a Create.
+				// The path may be a directory, so no extension check here.
+				w.mu.Lock()
+				delete(w.watchedDirs, event.Name)
+				w.mu.Unlock()
+				w.queue(event.Name)
 			}
 
 		case err, ok := <-w.fsWatcher.Errors:
@@ -158,60 +282,143 @@ func (w *Watcher) watchEvents() {
 	}
 }
 
-// debouncedRescan handles debouncing and triggering rescans
-func (w *Watcher) debouncedRescan() {
-	const debounceDelay = 3 * time.Second
+// queue records a changed path and (re)arms the debounce timer
+func (w *Watcher) queue(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	for {
-		select {
-		case <-w.eventQueue:
-			// Reset or create debounce timer
-			if w.debounceTimer != nil {
-				w.debounceTimer.Stop()
-			}
-
-			w.debounceTimer = time.AfterFunc(debounceDelay, func() {
-				w.triggerRescan()
-			})
-
-		case <-w.stopChan:
-			if w.debounceTimer != nil {
-				w.debounceTimer.Stop()
-			}
-			return
-		}
+	w.pending[path] = true
+	if w.flushTimer != nil {
+		w.flushTimer.Stop()
 	}
+	w.flushTimer = time.AfterFunc(debounceDelay, w.flush)
 }
 
-// triggerRescan performs the actual filesystem rescan
-func (w *Watcher) triggerRescan() {
-	// Don't trigger if already scanning
+// flush applies all pending changes as single-file updates and removals
+func (w *Watcher) flush() {
+	// A full rescan will pick everything up; try again once it finishes
 	if state.IsScanning() {
-		log.Println("⏭️  Skipping auto-rescan (scan already in progress)")
+		w.mu.Lock()
+		w.flushTimer = time.AfterFunc(debounceDelay, w.flush)
+		w.mu.Unlock()
 		return
 	}
 
-	log.Println("🔄 Auto-rescan triggered by filesystem changes...")
+	w.mu.Lock()
+	paths := w.pending
+	w.pending = make(map[string]bool)
+	w.mu.Unlock()
+
+	var updated []models.FileInfo
+	var removed []string
+	admits := libraryFilter()
+	for path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			removed = append(removed, path)
+			continue
+		}
+		if info.IsDir() || !admits(path) {
+			continue
+		}
+
+		f, err := scanner.ScanFile(path)
+		if err != nil {
+			continue
+		}
+		// Keep tag and rating edits that are still waiting in the write queue
+		persistence.ApplyPending(&f)
+		updated = append(updated, f)
+	}
 
-	state.SetScanning(true)
+	scanner.ApplyFileChanges(updated, removed)
+}
 
-	// Get stdin paths if they were provided at startup
-	stdinPaths := state.GetStdinPaths()
+// libraryFilter returns a check for whether a changed file belongs in the
+// library: it is already indexed, was listed on stdin, or a root's include,
+// exclude, hidden-file and depth rules admit it. Watches cover whole ancestor
+// directories, so their other files are seen too but must not be pulled in.
+func libraryFilter() func(path string) bool {
+	known := make(map[string]bool)
+	for _, f := range state.GetCurrent().AllFiles {
+		known[f.Path] = true
+	}
+	for _, p := range state.GetStdinPaths() {
+		known[p] = true
+	}
+	roots := state.GetRoots()
 
-	// Perform scan using stdin paths
-	if err := scanner.ProcessPaths(stdinPaths); err != nil {
-		log.Printf("❌ Auto-rescan failed: %v", err)
-		state.SetScanning(false)
-		return
+	return func(path string) bool {
+		if known[path] {
+			return true
+		}
+		for i := range roots {
+			if roots[i].Admits(path) {
+				return true
+			}
+		}
+		return false
 	}
+}
+
+// pollLoop periodically re-walks subtrees that could not get inotify watches
+func (w *Watcher) pollLoop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			trees := make([]*pollTree, 0, len(w.polled))
+			for _, t := range w.polled {
+				trees = append(trees, t)
+			}
+			w.mu.Unlock()
+
+			for _, t := range trees {
+				next := snapshotTree(t.root)
+				for path, stamp := range next {
+					if old, ok := t.snapshot[path]; !ok || old != stamp {
+						w.queue(path)
+					}
+				}
+				for path := range t.snapshot {
+					if _, ok := next[path]; !ok {
+						w.queue(path)
+					}
+				}
+				t.snapshot = next
+			}
 
-	// Save to cache
-	if w.dbCache != nil {
-		scanner.SaveToCache(w.dbCache)
+		case <-w.stopChan:
+			return
+		}
 	}
+}
 
-	state.SetScanCompleted()
-	log.Println("✅ Auto-rescan completed")
+// snapshotTree records size and mtime of every supported file under root
+func snapshotTree(root string) map[string]fileStamp {
+	snapshot := make(map[string]fileStamp)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isSupported(path) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			snapshot[path] = fileStamp{size: info.Size(), mtime: info.ModTime().UnixNano()}
+		}
+		return nil
+	})
+	return snapshot
 }
 
 // shouldIgnoreEvent filters out events we don't care about
@@ -228,7 +435,7 @@ func (w *Watcher) shouldIgnoreEvent(event fsnotify.Event) bool {
 		return true
 	}
 
-	// Ignore hidden files (except directories, which we handle in Walk)
+	// Ignore hidden files and directories
 	if strings.HasPrefix(name, ".") {
 		return true
 	}
@@ -254,4 +461,10 @@ func (w *Watcher) Stop() {
 	log.Println("🛑 Stopping filesystem watcher...")
 	close(w.stopChan)
 	w.fsWatcher.Close()
+
+	w.mu.Lock()
+	if w.flushTimer != nil {
+		w.flushTimer.Stop()
+	}
+	w.mu.Unlock()
 }
@@ -0,0 +1,18 @@
+//go:build linux
+
+package watcher
+
+import (
+	"errors"
+	"syscall"
+)
+
+// recursiveWatches is true on Linux: inotify watches are cheap (no file
+// descriptor per directory), so every directory under the roots is watched.
+const recursiveWatches = true
+
+// isWatchLimitError reports whether err means the inotify watch limit
+// (fs.inotify.max_user_watches) or instance limit has been exhausted.
+func isWatchLimitError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
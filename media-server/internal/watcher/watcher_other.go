@@ -0,0 +1,14 @@
+//go:build !linux
+
+package watcher
+
+// recursiveWatches is false outside Linux: kqueue costs one file descriptor per
+// watched directory, so only the minimal ancestor directories are watched and
+// the background freshness scanner covers nested subfolders.
+const recursiveWatches = false
+
+// isWatchLimitError always returns false; non-recursive watching never
+// approaches the kqueue descriptor limit.
+func isWatchLimitError(err error) bool {
+	return false
+}